@@ -0,0 +1,13 @@
+// Command fakeclaude mimics the `claude` CLI for worker tests and local
+// dry runs. See pkg/fakeclaude for the script and record formats.
+package main
+
+import (
+	"os"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+)
+
+func main() {
+	os.Exit(fakeclaude.Main(os.Args[1:], os.Stdout, os.Stderr))
+}
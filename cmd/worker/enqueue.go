@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/your-org/claude-dev-setup/pkg/worker"
+)
+
+func newEnqueueCmd() *cobra.Command {
+	var tf worker.TaskFile
+	var promptFile string
+	cmd := &cobra.Command{
+		Use:   "enqueue",
+		Short: "Queue a task for `worker run --drain`",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if promptFile != "" {
+				if tf.Prompt != "" {
+					return errors.New("use either --prompt or --prompt-file")
+				}
+				b, err := os.ReadFile(promptFile)
+				if err != nil {
+					return err
+				}
+				tf.Prompt = string(b)
+			}
+			path, err := worker.WriteTaskFile(cmdDirFromEnv(), tf)
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&tf.ID, "id", "", "task ID (generated when empty)")
+	cmd.Flags().StringVar(&tf.Prompt, "prompt", "", "prompt text")
+	cmd.Flags().StringVar(&promptFile, "prompt-file", "", "read the prompt from a file")
+	cmd.Flags().StringVar(&tf.PromptTemplate, "template", "", "render the prompt from a template (e.g. review); --prompt becomes its .Prompt")
+	cmd.Flags().StringVar(&tf.Repo, "repo", "", "GitHub repo (owner/name); defaults to the cmd dir's repo")
+	cmd.Flags().StringVar(&tf.Branch, "branch", "", "branch to check out")
+	cmd.Flags().StringVar(&tf.HeadSHA, "head-sha", "", "commit to check out (default: the tip of --branch)")
+	cmd.Flags().StringVar(&tf.Mode, "mode", "", "task mode: review, fix, resume, ask or create (default)")
+	cmd.Flags().IntVar(&tf.PRNumber, "pr", 0, "PR the review or answer is posted to")
+	cmd.Flags().Int64Var(&tf.CommentID, "comment-id", 0, "review comment an ask task replies to")
+	cmd.Flags().StringVar(&tf.ResumeSessionID, "resume-session", "", "session ID to resume in resume mode")
+	return cmd
+}
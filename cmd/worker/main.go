@@ -1,28 +1,106 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
 
 	"github.com/your-org/claude-dev-setup/pkg/config"
 	"github.com/your-org/claude-dev-setup/pkg/worker"
 )
 
+// exitInterrupted is the exit code after SIGINT/SIGTERM (128 + SIGINT).
+const exitInterrupted = 130
+
 func main() {
-	cmdDir := os.Getenv("CMD_DIR")
-	if cmdDir == "" {
-		cmdDir = "/home/owner/cmd"
+	// SIGINT/SIGTERM cancel the context: Claude's process group is killed,
+	// the current task is marked interrupted and state is saved. A second
+	// signal exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	root := &cobra.Command{
+		Use:          "worker",
+		Short:        "Run Claude tasks inside a worker sandbox",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		Run:          func(cmd *cobra.Command, args []string) { runWorker(cmd.Context(), runOnce) },
+	}
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.AddCommand(newRunCmd(), newServeCmd(), newEnqueueCmd(), newReplayCmd(), newUsageCmd())
+	err := root.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRunCmd() *cobra.Command {
+	var drain, dryRun bool
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Prepare the repo and run the current task (default)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if dryRun {
+				planWorker(cmd.Context())
+				return
+			}
+			if drain {
+				runWorker(cmd.Context(), func(ctx context.Context, r *worker.Runner, cmdDir, statePath, _ string) error {
+					return r.Drain(ctx, cmdDir, statePath)
+				})
+				return
+			}
+			runWorker(cmd.Context(), runOnce)
+		},
 	}
-	statePath := os.Getenv("STATE_PATH")
-	if statePath == "" {
-		statePath = filepath.Join(os.Getenv("HOME"), "state.json")
+	cmd.Flags().BoolVar(&drain, "drain", false, "run queued tasks one after another until the queue is empty")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what the task would run with; clone, run and write nothing")
+	cmd.MarkFlagsMutuallyExclusive("drain", "dry-run")
+	return cmd
+}
+
+// planWorker prints the plan of `worker run` without cloning, running
+// Claude or writing any file.
+func planWorker(ctx context.Context) {
+	cmdDir := cmdDirFromEnv()
+	if cfg, err := config.LoadFromDir(cmdDir); err == nil {
+		hydrateEnv(cmdDir, cfg)
 	}
-	sessionPath := os.Getenv("SESSION_PATH")
-	if sessionPath == "" {
-		sessionPath = filepath.Join(os.Getenv("HOME"), "session.json")
+	r := worker.NewRunner()
+	r.Worktrees = worker.NewWorktrees(filepath.Join(os.Getenv("HOME"), "claude"))
+	plan, err := r.Plan(ctx, cmdDir, statePathFromEnv(), sessionPathFromEnv())
+	if err == nil {
+		err = plan.Write(os.Stdout)
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] worker plan failed: %v\n", err)
+		os.Exit(worker.ExitCode(err))
+	}
+}
+
+// runFunc runs tasks with a prepared Runner (Run, Drain or Serve).
+type runFunc func(ctx context.Context, r *worker.Runner, cmdDir, statePath, sessionPath string) error
+
+func runOnce(ctx context.Context, r *worker.Runner, cmdDir, statePath, sessionPath string) error {
+	return r.Run(ctx, cmdDir, statePath, sessionPath)
+}
+
+// runWorker is the default worker flow: prepare config, then run tasks with
+// run, preparing repo and permissions for each.
+func runWorker(ctx context.Context, run runFunc) {
+	cmdDir := cmdDirFromEnv()
+	statePath := statePathFromEnv()
+	sessionPath := sessionPathFromEnv()
 
 	// Prepare external MCP central config (~/.mcp.json)
 	if err := worker.WriteCentralMCPConfig(cmdDir, os.Getenv("HOME")); err != nil {
@@ -32,72 +110,101 @@ func main() {
 	// Load config to get GitHub context
 	cfg, cfgErr := config.LoadFromDir(cmdDir)
 	if cfgErr == nil {
-		// Hydrate env vars from cmd files if not already set (no logging of values)
-		// Also reuse previously set GITHUB_TOKEN from environment (sandbox persists env between runs)
-		if os.Getenv("GITHUB_TOKEN") == "" {
-			if b, err := os.ReadFile(filepath.Join(cmdDir, "github_token.txt")); err == nil {
-				tok := strings.TrimSpace(string(b))
-				if tok != "" {
-					os.Setenv("GITHUB_TOKEN", tok)
-					if os.Getenv("GH_TOKEN") == "" {
-						os.Setenv("GH_TOKEN", tok)
-					}
-				}
-			}
-		} else if os.Getenv("GH_TOKEN") == "" {
-			// Mirror an existing GITHUB_TOKEN into GH_TOKEN for gh CLI compatibility
-			os.Setenv("GH_TOKEN", os.Getenv("GITHUB_TOKEN"))
+		hydrateEnv(cmdDir, cfg)
+	}
+
+	if cfgErr == nil {
+		// Authenticate with GitHub if possible (token presence only logged elsewhere)
+		if err := worker.EnsureGitHubAuth(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARNING] gh auth status: %v\n", err)
 		}
-		if os.Getenv("GITHUB_REPO") == "" && cfg.GitHub.Repo == "" {
-			if b, err := os.ReadFile(filepath.Join(cmdDir, "github_repo.txt")); err == nil {
-				os.Setenv("GITHUB_REPO", strings.TrimSpace(string(b)))
+	}
+
+	r := worker.NewRunner()
+	hooks, err := worker.LoadHooks(cmdDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] hooks disabled: %v\n", err)
+	}
+	r.Hooks = hooks
+	// Tasks naming a repo get a worktree of their own under ~/claude/worktrees
+	r.Worktrees = worker.NewWorktrees(filepath.Join(os.Getenv("HOME"), "claude"))
+	// Repo preparation runs inside the task so its failures are recorded on it
+	r.Prepare = func(ctx context.Context, spec worker.TaskSpec) error {
+		// Without a repo there is no worktree: switch the shared checkout to the branch
+		customRepo := strings.TrimSpace(os.Getenv("CUSTOM_REPO_PATH"))
+		if cfgErr == nil && customRepo == "" && spec.Repo == "" && spec.Branch != "" {
+			if err := worker.PrepareRepo(ctx, os.Getenv("HOME"), spec.RepoDir, spec.Repo, spec.Branch); err != nil {
+				return err
 			}
 		}
-		if os.Getenv("GITHUB_BRANCH") == "" && cfg.GitHub.Branch == "" {
-			if b, err := os.ReadFile(filepath.Join(cmdDir, "github_branch.txt")); err == nil {
-				os.Setenv("GITHUB_BRANCH", strings.TrimSpace(string(b)))
+
+		// Generate permissions for the repo if present, limited to the mode's tools
+		if st, err := os.Stat(spec.RepoDir); err == nil && st.IsDir() {
+			if err := worker.WriteRepoPermissions(spec.RepoDir, spec.AllowedTools); err != nil {
+				fmt.Fprintf(os.Stderr, "[WARNING] failed generating repo permissions: %v\n", err)
 			}
 		}
+		return nil
+	}
 
-		// Authenticate with GitHub if possible (token presence only logged elsewhere)
-		if err := worker.EnsureGitHubAuth(); err != nil {
-			fmt.Fprintf(os.Stderr, "[WARNING] gh auth status: %v\n", err)
-		}
-		// Prepare repository only when we have repo/branch context AND when no custom repo path is provided
-		repo := cfg.GitHub.Repo
-		if repo == "" {
-			repo = os.Getenv("GITHUB_REPO")
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "[WARNING] interrupted before the task started")
+		os.Exit(exitInterrupted)
+	}
+
+	if err := run(ctx, r, cmdDir, statePath, sessionPath); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] worker run failed: %v\n", err)
+		os.Exit(worker.ExitCode(err))
+	}
+}
+
+// hydrateEnv sets GitHub env vars from cmd files if not already set (no
+// logging of values).
+func hydrateEnv(cmdDir string, cfg *config.Config) {
+	// Reuse previously set GITHUB_TOKEN from environment (sandbox persists env between runs)
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		if b, err := os.ReadFile(filepath.Join(cmdDir, "github_token.txt")); err == nil {
+			tok := strings.TrimSpace(string(b))
+			if tok != "" {
+				os.Setenv("GITHUB_TOKEN", tok)
+				if os.Getenv("GH_TOKEN") == "" {
+					os.Setenv("GH_TOKEN", tok)
+				}
+			}
 		}
-		branch := cfg.GitHub.Branch
-		if branch == "" {
-			branch = os.Getenv("GITHUB_BRANCH")
+	} else if os.Getenv("GH_TOKEN") == "" {
+		// Mirror an existing GITHUB_TOKEN into GH_TOKEN for gh CLI compatibility
+		os.Setenv("GH_TOKEN", os.Getenv("GITHUB_TOKEN"))
+	}
+	if os.Getenv("GITHUB_REPO") == "" && cfg.GitHub.Repo == "" {
+		if b, err := os.ReadFile(filepath.Join(cmdDir, "github_repo.txt")); err == nil {
+			os.Setenv("GITHUB_REPO", strings.TrimSpace(string(b)))
 		}
-		customRepo := strings.TrimSpace(os.Getenv("CUSTOM_REPO_PATH"))
-		if customRepo == "" && (repo != "" || branch != "") {
-			// Clone into default target-repo path
-			repoDir := filepath.Join(os.Getenv("HOME"), "claude", "target-repo")
-			_ = worker.PrepareRepo(os.Getenv("HOME"), repoDir, repo, branch)
+	}
+	if os.Getenv("GITHUB_BRANCH") == "" && cfg.GitHub.Branch == "" {
+		if b, err := os.ReadFile(filepath.Join(cmdDir, "github_branch.txt")); err == nil {
+			os.Setenv("GITHUB_BRANCH", strings.TrimSpace(string(b)))
 		}
 	}
+}
 
-	// Generate permissions for the repo if present
-	repoDir := os.Getenv("CUSTOM_REPO_PATH")
-	if repoDir != "" {
-		if !filepath.IsAbs(repoDir) {
-			repoDir = filepath.Join(os.Getenv("HOME"), repoDir)
-		}
-	} else {
-		repoDir = filepath.Join(os.Getenv("HOME"), "claude", "target-repo")
+func cmdDirFromEnv() string {
+	if d := os.Getenv("CMD_DIR"); d != "" {
+		return d
 	}
-	if st, err := os.Stat(repoDir); err == nil && st.IsDir() {
-		if err := worker.GenerateRepoPermissions(cmdDir, repoDir); err != nil {
-			fmt.Fprintf(os.Stderr, "[WARNING] failed generating repo permissions: %v\n", err)
-		}
+	return "/home/owner/cmd"
+}
+
+func sessionPathFromEnv() string {
+	if p := os.Getenv("SESSION_PATH"); p != "" {
+		return p
 	}
+	return filepath.Join(os.Getenv("HOME"), "session.json")
+}
 
-	r := worker.NewRunner()
-	if err := r.Run(cmdDir, statePath, sessionPath); err != nil {
-		fmt.Fprintf(os.Stderr, "[ERROR] worker run failed: %v\n", err)
-		os.Exit(23)
+func statePathFromEnv() string {
+	if p := os.Getenv("STATE_PATH"); p != "" {
+		return p
 	}
+	return filepath.Join(os.Getenv("HOME"), "state.json")
 }
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/your-org/claude-dev-setup/pkg/worker"
+)
+
+func newReplayCmd() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "replay <transcript.jsonl>",
+		Short: "Render a recorded stream-json transcript",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return worker.Replay(args[0], format)
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "concise", "output formats, comma-separated: concise, pretty, raw, markdown, github (format:path writes to a file)")
+	return cmd
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/your-org/claude-dev-setup/pkg/worker"
+)
+
+func newServeCmd() *cobra.Command {
+	var opts worker.ServeOptions
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Stay running and run task files dropped into $CMD_DIR/queue",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runWorker(cmd.Context(), func(ctx context.Context, r *worker.Runner, cmdDir, statePath, _ string) error {
+				return r.Serve(ctx, cmdDir, statePath, opts)
+			})
+		},
+	}
+	cmd.Flags().DurationVar(&opts.PollInterval, "poll-interval", 2*time.Second, "how often to check the queue dir while idle")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 1, "number of tasks to run at once")
+	return cmd
+}
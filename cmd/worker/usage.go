@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func newUsageCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show token and cost totals per repo and per day from state.json",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := taskstate.Load(statePathFromEnv())
+			if err != nil {
+				return err
+			}
+			st := mgr.GetState()
+			byRepo, byDay := st.UsageByRepo(), st.UsageByDay()
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(map[string]any{"byRepo": byRepo, "byDay": byDay})
+			}
+			printUsageTable("REPO", byRepo)
+			fmt.Println()
+			printUsageTable("DAY", byDay)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print totals as JSON")
+	return cmd
+}
+
+func printUsageTable(keyHeader string, rows []taskstate.UsageTotals) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tTASKS\tINPUT\tOUTPUT\tCACHE READ\tCACHE WRITE\tTURNS\tCOST (USD)\n", keyHeader)
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.4f\n",
+			r.Key, r.Tasks, r.InputTokens, r.OutputTokens, r.CacheReadTokens, r.CacheCreationTokens, r.NumTurns, r.CostUSD)
+	}
+	tw.Flush()
+}
@@ -36,29 +36,41 @@ fi
 # Ensure PATH includes npm global (Claude CLI), node/go common locations
 export PATH="$HOME/.npm-global/bin:$HOME/.local/go/bin:/usr/local/go/bin:/usr/local/node/bin:$PATH"
 
+# Run the worker binary in the background and forward SIGINT/SIGTERM to it, so
+# it can stop Claude, mark the task interrupted and save state before exiting.
+# (`go run` would not pass SIGTERM on to the worker.)
+run_worker() {
+	local bin="$HOME/.cache/claude-worker/worker"
+	(cd "$HOME/claude" && go build -o "$bin" ./cmd/worker) || return 1
+	# WORKER_ARGS selects the subcommand, e.g. "serve" or "run --drain"
+	# shellcheck disable=SC2086
+	"$bin" ${WORKER_ARGS:-} &
+	local pid=$!
+	trap 'kill -TERM '"$pid"' 2>/dev/null' INT TERM
+	while kill -0 "$pid" 2>/dev/null; do
+		wait "$pid" || true
+	done
+	trap - INT TERM
+	wait "$pid"
+}
+
 # Invoke Go worker from repo root
 if [ -d "$HOME/claude" ]; then
 	print_status "Attempting Go worker path..."
-	if (cd "$HOME/claude" && go run ./cmd/worker); then
+	WORKER_STATUS=0
+	run_worker || WORKER_STATUS=$?
+	if [ "$WORKER_STATUS" -eq 130 ]; then
+		print_error "Go worker interrupted; task marked interrupted"
+		exit 130
+	fi
+	if [ "$WORKER_STATUS" -eq 0 ]; then
 		print_success "Go worker completed"
-		# Historical completion hook: call /home/owner/completion.sh with the last task ID if available
-		COMPLETION_SCRIPT="/home/owner/completion.sh"
-		if [ -x "$COMPLETION_SCRIPT" ] || [ -f "$COMPLETION_SCRIPT" ]; then
-			# Try to extract a task ID from state.json (current or last history entry)
-			TASK_ID=""
-			if command -v jq >/dev/null 2>&1 && [ -f "$HOME/state.json" ]; then
-				TASK_ID=$(jq -r '.current.id // empty | select(. != "")' "$HOME/state.json" 2>/dev/null)
-				if [ -z "$TASK_ID" ] || [ "$TASK_ID" = "null" ]; then
-					TASK_ID=$(jq -r '.history[-1].id // empty | select(. != "")' "$HOME/state.json" 2>/dev/null)
-				fi
-			fi
-			print_status "Running completion script: $COMPLETION_SCRIPT ${TASK_ID:+(task: $TASK_ID)}"
-			bash "$COMPLETION_SCRIPT" ${TASK_ID:+"$TASK_ID"} || print_error "Completion script failed"
-		fi
+		# Post-task hooks (including /home/owner/completion.sh) run inside the worker
 		exit 0
 	else
-		print_error "Go worker failed; aborting per migration plan"
-		exit 1
+		# Pass the worker's exit code through (see "Exit codes" in readme.md)
+		print_error "Go worker failed (exit $WORKER_STATUS); aborting per migration plan"
+		exit "$WORKER_STATUS"
 	fi
 else
 	print_error "Repository directory not found: $HOME/claude"
@@ -0,0 +1,299 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAPISessions bounds the conversations an APIBackend keeps for resuming.
+const maxAPISessions = 32
+
+// DefaultAPIModel is used by APIBackend when neither the backend nor the
+// request names a model.
+const DefaultAPIModel = "claude-sonnet-4-5"
+
+// APIBackend talks to the Anthropic Messages API directly and runs a small
+// tool loop with read-only review tools (Read, Grep, LS) rooted at
+// Request.Dir. It needs neither Node nor the CLI, and emits the same events
+// the CLI would. MCP servers and write tools are not available. Finished
+// conversations are kept in memory, so a later Run of the same backend can
+// resume them; they do not survive the process.
+type APIBackend struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	MaxTokens  int
+	MaxTurns   int
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	sessions map[string][]apiMessage
+	// order is the session IDs oldest first, for eviction.
+	order []string
+}
+
+// APIError is a non-2xx response from the Messages API.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("anthropic api: %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+func NewAPIBackend(apiKey string) *APIBackend {
+	return &APIBackend{
+		BaseURL:    "https://api.anthropic.com",
+		APIKey:     apiKey,
+		Model:      DefaultAPIModel,
+		MaxTokens:  8192,
+		MaxTurns:   30,
+		HTTPClient: &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (b *APIBackend) Name() string { return "api" }
+
+const apiSystemPrompt = "You are working in a read-only checkout of a repository. " +
+	"Use the Read, Grep and LS tools to inspect it; paths are relative to the repository root."
+
+type apiMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type apiResponse struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Role       string          `json:"role"`
+	Model      string          `json:"model"`
+	Content    json.RawMessage `json:"content"`
+	StopReason string          `json:"stop_reason"`
+	Usage      Usage           `json:"usage"`
+}
+
+func (b *APIBackend) Run(ctx context.Context, req Request, handle func(Event) error) error {
+	sessionID := newSessionID()
+	var messages []apiMessage
+	if req.ResumeSessionID != "" {
+		prev, ok := b.session(req.ResumeSessionID)
+		if !ok {
+			return ErrSessionNotFound
+		}
+		sessionID, messages = req.ResumeSessionID, prev
+	}
+	model := req.Model
+	if model == "" {
+		model = b.Model
+	}
+	if model == "" {
+		model = DefaultAPIModel
+	}
+	maxTurns := req.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = b.MaxTurns
+	}
+	tools := reviewTools(req.AllowedTools, req.DisallowedTools)
+	started := time.Now()
+
+	emit := func(v map[string]any) error {
+		v["session_id"] = sessionID
+		ev, err := NewEvent(v)
+		if err != nil {
+			return err
+		}
+		return handle(ev)
+	}
+	toolNames := make([]string, 0, len(tools))
+	for _, t := range tools {
+		toolNames = append(toolNames, t.Name)
+	}
+	if err := emit(map[string]any{
+		"type": TypeSystem, "subtype": "init", "cwd": req.Dir, "model": model,
+		"tools": toolNames, "permissionMode": "default", "apiKeySource": "ANTHROPIC_API_KEY",
+	}); err != nil {
+		return err
+	}
+
+	prompt, _ := json.Marshal(req.Prompt)
+	messages = append(messages, apiMessage{Role: "user", Content: prompt})
+	var total Usage
+	var apiDuration time.Duration
+	turns := 0
+	finalText := ""
+	subtype := "success"
+	var runErr error
+	for {
+		if turns >= maxTurns {
+			subtype = "error_max_turns"
+			break
+		}
+		turns++
+		callStart := time.Now()
+		resp, err := b.createMessage(ctx, model, tools, messages)
+		apiDuration += time.Since(callStart)
+		if err != nil {
+			subtype = "error_during_execution"
+			runErr = err
+			break
+		}
+		total.Add(resp.Usage)
+		if err := emit(map[string]any{"type": TypeAssistant, "parent_tool_use_id": nil, "message": resp}); err != nil {
+			return err
+		}
+		messages = append(messages, apiMessage{Role: "assistant", Content: resp.Content})
+		var blocks Content
+		if err := json.Unmarshal(resp.Content, &blocks); err != nil {
+			subtype = "error_during_execution"
+			runErr = err
+			break
+		}
+		if t := blocks.Text(); t != "" {
+			finalText = t
+		}
+		if resp.StopReason != "tool_use" {
+			break
+		}
+		var results []ContentBlock
+		for _, blk := range blocks {
+			if blk.Type != BlockToolUse {
+				continue
+			}
+			out, isErr := runReviewTool(req.Dir, tools, blk)
+			results = append(results, ContentBlock{Type: BlockToolResult, ToolUseID: blk.ID, Content: Content{{Type: BlockText, Text: out}}, IsError: isErr})
+		}
+		rb, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		if err := emit(map[string]any{
+			"type": TypeUser, "parent_tool_use_id": nil,
+			"message": map[string]any{"role": "user", "content": json.RawMessage(rb)},
+		}); err != nil {
+			return err
+		}
+		messages = append(messages, apiMessage{Role: "user", Content: rb})
+	}
+
+	result := map[string]any{
+		"type": TypeResult, "subtype": subtype, "is_error": subtype != "success",
+		"duration_ms": time.Since(started).Milliseconds(), "duration_api_ms": apiDuration.Milliseconds(),
+		"num_turns": turns, "result": finalText, "total_cost_usd": EstimateCostUSD(model, total), "usage": total,
+	}
+	if runErr != nil {
+		result["result"] = runErr.Error()
+	}
+	if subtype == "success" {
+		// Ends on an assistant turn, so a resume can add the next prompt
+		b.saveSession(sessionID, messages)
+	}
+	if err := emit(result); err != nil {
+		return err
+	}
+	return runErr
+}
+
+func (b *APIBackend) session(id string) ([]apiMessage, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, ok := b.sessions[id]
+	return slices.Clone(m), ok
+}
+
+func (b *APIBackend) saveSession(id string, messages []apiMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sessions == nil {
+		b.sessions = map[string][]apiMessage{}
+	}
+	if _, ok := b.sessions[id]; !ok {
+		b.order = append(b.order, id)
+	}
+	b.sessions[id] = messages
+	for len(b.order) > maxAPISessions {
+		delete(b.sessions, b.order[0])
+		b.order = b.order[1:]
+	}
+}
+
+func (b *APIBackend) createMessage(ctx context.Context, model string, tools []reviewTool, messages []apiMessage) (*apiResponse, error) {
+	maxTokens := b.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 8192
+	}
+	defs := make([]map[string]any, 0, len(tools))
+	for _, t := range tools {
+		defs = append(defs, map[string]any{"name": t.Name, "description": t.Description, "input_schema": t.Schema})
+	}
+	body, err := json.Marshal(map[string]any{
+		"model":      model,
+		"max_tokens": maxTokens,
+		"system":     apiSystemPrompt,
+		"messages":   messages,
+		"tools":      defs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimRight(b.BaseURL, "/")
+	if base == "" {
+		base = "https://api.anthropic.com"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("x-api-key", b.APIKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	client := b.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	rb, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		apiErr := &APIError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(rb))}
+		var env struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(rb, &env) == nil && env.Error.Type != "" {
+			apiErr.Type, apiErr.Message = env.Error.Type, env.Error.Message
+		}
+		return nil, apiErr
+	}
+	var out apiResponse
+	if err := json.Unmarshal(rb, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func newSessionID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,175 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIBackend_ToolLoop(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	var secondRequest map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "k" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("unexpected request: %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		calls++
+		switch calls {
+		case 1:
+			var req map[string]any
+			_ = json.Unmarshal(body, &req)
+			if tools, _ := req["tools"].([]any); len(tools) != 2 {
+				t.Errorf("expected Read and Grep only (LS not allowed), got %v", req["tools"])
+			}
+			io.WriteString(w, `{"id":"m1","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"tool_use",
+				"content":[{"type":"text","text":"Reading"},{"type":"tool_use","id":"tu1","name":"Read","input":{"file_path":"main.go"}},
+				{"type":"tool_use","id":"tu2","name":"Read","input":{"file_path":"../etc/passwd"}}],
+				"usage":{"input_tokens":1000,"output_tokens":100}}`)
+		default:
+			_ = json.Unmarshal(body, &secondRequest)
+			io.WriteString(w, `{"id":"m2","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"end_turn",
+				"content":[{"type":"text","text":"LGTM"}],"usage":{"input_tokens":2000,"output_tokens":50}}`)
+		}
+	}))
+	defer srv.Close()
+
+	b := NewAPIBackend("k")
+	b.BaseURL = srv.URL
+	var evs []Event
+	err := b.Run(context.Background(), Request{Prompt: "review", Dir: repo, AllowedTools: []string{"Read", "Grep(*.go)"}}, func(ev Event) error {
+		evs = append(evs, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	types := make([]string, len(evs))
+	for i, ev := range evs {
+		types[i] = ev.Type
+	}
+	if strings.Join(types, ",") != "system,assistant,user,assistant,result" {
+		t.Fatalf("unexpected event sequence: %v", types)
+	}
+	if evs[0].Init == nil || evs[0].SessionID == "" || evs[0].Init.CWD != repo {
+		t.Fatalf("unexpected init: %+v", evs[0])
+	}
+	results := evs[2].Blocks()
+	if len(results) != 2 || results[0].ToolUseID != "tu1" || !strings.Contains(results[0].Content.Text(), "func main()") || results[0].IsError {
+		t.Fatalf("unexpected first tool result: %+v", results)
+	}
+	if !results[1].IsError || !strings.Contains(results[1].Content.Text(), "outside the repository") {
+		t.Fatalf("expected path escape to be refused: %+v", results[1])
+	}
+	if msgs, _ := secondRequest["messages"].([]any); len(msgs) != 3 {
+		t.Fatalf("expected user/assistant/tool_result history, got %v", secondRequest["messages"])
+	}
+	s, ok := StatsFromResult(evs[4])
+	if !ok || s.NumTurns != 2 || s.InputTokens != 3000 || s.OutputTokens != 150 || s.CostUSD <= 0 || evs[4].Result.Result != "LGTM" {
+		t.Fatalf("unexpected result: %+v %+v", s, evs[4].Result)
+	}
+}
+
+func TestAPIBackend_ErrorsAndResume(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		io.WriteString(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	}))
+	defer srv.Close()
+	b := NewAPIBackend("k")
+	b.BaseURL = srv.URL
+
+	var last Event
+	err := b.Run(context.Background(), Request{Prompt: "x", Dir: t.TempDir()}, func(ev Event) error { last = ev; return nil })
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 529 || apiErr.Type != "overloaded_error" {
+		t.Fatalf("expected overloaded APIError, got %v", err)
+	}
+	if last.Result == nil || !last.Result.IsError || last.Subtype != "error_during_execution" {
+		t.Fatalf("expected error result event, got %+v", last)
+	}
+
+	err = b.Run(context.Background(), Request{Prompt: "x", ResumeSessionID: "s"}, func(Event) error { return nil })
+	if !IsSessionNotFound(err) {
+		t.Fatalf("expected session-not-found for resume, got %v", err)
+	}
+}
+
+func TestAPIBackend_ResumesKeptSession(t *testing.T) {
+	var last map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		last = nil
+		_ = json.Unmarshal(body, &last)
+		io.WriteString(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"end_turn",
+			"content":[{"type":"text","text":"not json"}],"usage":{"input_tokens":10,"output_tokens":5}}`)
+	}))
+	defer srv.Close()
+	b := NewAPIBackend("k")
+	b.BaseURL = srv.URL
+
+	var first Event
+	if err := b.Run(context.Background(), Request{Prompt: "review", Dir: t.TempDir()}, func(ev Event) error { first = ev; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	var resumed []Event
+	err := b.Run(context.Background(), Request{Prompt: "repair it", Dir: t.TempDir(), ResumeSessionID: first.SessionID}, func(ev Event) error {
+		resumed = append(resumed, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	msgs, _ := last["messages"].([]any)
+	if len(msgs) != 3 || !strings.Contains(fmt.Sprint(msgs[0]), "review") || !strings.Contains(fmt.Sprint(msgs[2]), "repair it") {
+		t.Fatalf("expected the first conversation plus the new prompt, got %v", msgs)
+	}
+	if resumed[0].SessionID != first.SessionID {
+		t.Fatalf("expected the resumed run to keep session %s, got %s", first.SessionID, resumed[0].SessionID)
+	}
+}
+
+func TestCLIArgs(t *testing.T) {
+	args := strings.Join(CLIArgs(Request{
+		Prompt: "p", AllowedTools: []string{"Read", "Grep"}, DisallowedTools: []string{"Task"},
+		MCPConfigPath: "/h/.mcp.json", ResumeSessionID: "s1", MaxTurns: 5,
+	}), " ")
+	want := "--mcp-config /h/.mcp.json --print --output-format stream-json --verbose --permission-mode default --allowedTools Read,Grep --disallowedTools Task --max-turns 5 --resume s1 -p p"
+	if args != want {
+		t.Fatalf("args:\n got %s\nwant %s", args, want)
+	}
+}
+
+func TestToolGrep_SkipsSymlinks(t *testing.T) {
+	repo, outside := t.TempDir(), t.TempDir()
+	secret := filepath.Join(outside, "github_token.txt")
+	if err := os.WriteFile(secret, []byte("token ghp_secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("no token here\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(repo, "x")); err != nil {
+		t.Fatal(err)
+	}
+	out, err := toolGrep(repo, map[string]any{"pattern": "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "ghp_secret") || !strings.Contains(out, "a.txt:1:no token here") {
+		t.Fatalf("expected only the regular file to match: %q", out)
+	}
+}
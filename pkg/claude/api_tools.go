@@ -0,0 +1,277 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// reviewTool is a read-only tool offered by APIBackend. Names and input
+// fields follow the CLI's built-in tools so renderers and audits treat both
+// backends alike.
+type reviewTool struct {
+	Name        string
+	Description string
+	Schema      map[string]any
+	run         func(root string, in map[string]any) (string, error)
+}
+
+const (
+	maxReadLines   = 2000
+	maxGrepMatches = 200
+	maxFileBytes   = 1 << 20
+)
+
+var allReviewTools = []reviewTool{
+	{
+		Name:        "Read",
+		Description: "Read a text file. Lines are numbered starting at 1; use offset/limit for large files.",
+		Schema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"file_path": map[string]any{"type": "string", "description": "Path relative to the repository root"},
+				"offset":    map[string]any{"type": "integer", "description": "First line to read (1-based)"},
+				"limit":     map[string]any{"type": "integer", "description": "Number of lines to read"},
+			},
+			"required": []string{"file_path"},
+		},
+		run: toolRead,
+	},
+	{
+		Name:        "Grep",
+		Description: "Search file contents with a regular expression. Returns path:line:text matches.",
+		Schema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"pattern": map[string]any{"type": "string", "description": "Go regular expression"},
+				"path":    map[string]any{"type": "string", "description": "Directory or file to search, relative to the repository root"},
+				"glob":    map[string]any{"type": "string", "description": "Only search files whose name matches this glob, e.g. *.go"},
+			},
+			"required": []string{"pattern"},
+		},
+		run: toolGrep,
+	},
+	{
+		Name:        "LS",
+		Description: "List a directory. Directories are shown with a trailing slash.",
+		Schema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string", "description": "Directory relative to the repository root"},
+			},
+		},
+		run: toolLS,
+	},
+}
+
+// reviewTools filters the built-in tools by allow/deny lists. Entries may
+// carry CLI-style specifiers such as "Read(src/**)"; only the name is used.
+func reviewTools(allowed, disallowed []string) []reviewTool {
+	names := func(list []string) map[string]bool {
+		m := map[string]bool{}
+		for _, t := range list {
+			name, _, _ := strings.Cut(strings.TrimSpace(t), "(")
+			m[name] = true
+		}
+		return m
+	}
+	allow, deny := names(allowed), names(disallowed)
+	var out []reviewTool
+	for _, t := range allReviewTools {
+		if deny[t.Name] || (len(allow) > 0 && !allow[t.Name]) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// runReviewTool executes a tool_use block and returns the tool_result text.
+func runReviewTool(root string, tools []reviewTool, blk ContentBlock) (string, bool) {
+	for _, t := range tools {
+		if t.Name == blk.Name {
+			out, err := t.run(root, blk.Input)
+			if err != nil {
+				return err.Error(), true
+			}
+			return out, false
+		}
+	}
+	return fmt.Sprintf("tool %q is not available", blk.Name), true
+}
+
+// resolveInRoot maps a tool path onto root and refuses anything that escapes it.
+func resolveInRoot(root, p string) (string, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if realRoot, err := filepath.EvalSymlinks(rootAbs); err == nil {
+		rootAbs = realRoot
+	}
+	target := p
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(rootAbs, target)
+	}
+	target = filepath.Clean(target)
+	if real, err := filepath.EvalSymlinks(target); err == nil {
+		target = real
+	}
+	rel, err := filepath.Rel(rootAbs, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the repository", p)
+	}
+	return target, nil
+}
+
+func stringInput(in map[string]any, key string) string {
+	s, _ := in[key].(string)
+	return s
+}
+
+func intInput(in map[string]any, key string) int {
+	switch v := in[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func toolRead(root string, in map[string]any) (string, error) {
+	fp := stringInput(in, "file_path")
+	if fp == "" {
+		return "", errors.New("file_path is required")
+	}
+	path, err := resolveInRoot(root, fp)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	offset := intInput(in, "offset")
+	if offset < 1 {
+		offset = 1
+	}
+	limit := intInput(in, "limit")
+	if limit <= 0 || limit > maxReadLines {
+		limit = maxReadLines
+	}
+	var b strings.Builder
+	r := bufio.NewReader(f)
+	for n := 1; n < offset+limit; n++ {
+		line, err := r.ReadString('\n')
+		if line == "" && err != nil {
+			break
+		}
+		if n >= offset {
+			fmt.Fprintf(&b, "%6d\t%s\n", n, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			break
+		}
+	}
+	return b.String(), nil
+}
+
+func toolGrep(root string, in map[string]any) (string, error) {
+	re, err := regexp.Compile(stringInput(in, "pattern"))
+	if err != nil {
+		return "", err
+	}
+	start := root
+	if p := stringInput(in, "path"); p != "" {
+		if start, err = resolveInRoot(root, p); err != nil {
+			return "", err
+		}
+	} else if start, err = resolveInRoot(root, "."); err != nil {
+		return "", err
+	}
+	base, _ := resolveInRoot(root, ".")
+	glob := stringInput(in, "glob")
+	var matches []string
+	walkErr := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || len(matches) >= maxGrepMatches {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			// ReadFile would follow a symlink out of the repo
+			return nil
+		}
+		if glob != "" {
+			if ok, _ := filepath.Match(glob, d.Name()); !ok {
+				return nil
+			}
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxFileBytes {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(base, path)
+		for i, line := range strings.Split(string(data), "\n") {
+			if re.MatchString(line) {
+				matches = append(matches, fmt.Sprintf("%s:%d:%s", filepath.ToSlash(rel), i+1, line))
+				if len(matches) >= maxGrepMatches {
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return "", walkErr
+	}
+	if len(matches) == 0 {
+		return "No matches found", nil
+	}
+	out := strings.Join(matches, "\n")
+	if len(matches) >= maxGrepMatches {
+		out += fmt.Sprintf("\n(results truncated at %d matches)", maxGrepMatches)
+	}
+	return out, nil
+}
+
+func toolLS(root string, in map[string]any) (string, error) {
+	p := stringInput(in, "path")
+	if p == "" {
+		p = "."
+	}
+	dir, err := resolveInRoot(root, p)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name()+"/")
+		} else {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n"), nil
+}
@@ -0,0 +1,243 @@
+package claude
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ToolCall is one tool_use matched with its tool_result by ID.
+type ToolCall struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Input           map[string]any `json:"input,omitempty"`
+	ParentToolUseID string         `json:"parentToolUseId,omitempty"`
+	StartedAt       time.Time      `json:"startedAt"`
+	DurationMS      int64          `json:"durationMs"`
+	Completed       bool           `json:"completed"`
+	IsError         bool           `json:"isError,omitempty"`
+	Denied          bool           `json:"denied,omitempty"`
+	// Error is the (truncated) result text of failed calls.
+	Error string `json:"error,omitempty"`
+}
+
+// denialMessage matches the start of the tool_result errors the CLI writes
+// when a call is refused by --allowedTools/--disallowedTools or
+// settings.local.json rather than failing on its own. Only the start counts,
+// so tool output that merely quotes the wording is not a denial.
+var denialMessage = regexp.MustCompile(`(?i)^(?:<tool_use_error>)?\s*(?:` +
+	`claude requested permissions to .+, but you haven't granted it yet|` +
+	`permission to use \S+.* has been denied|` +
+	`no such tool available: )`)
+
+// IsPermissionDenial reports whether a tool_result error text is a
+// permission refusal.
+func IsPermissionDenial(text string) bool {
+	return denialMessage.MatchString(strings.TrimSpace(text))
+}
+
+// ToolAudit records every tool call in a stream. It is safe for concurrent use.
+type ToolAudit struct {
+	mu    sync.Mutex
+	calls []*ToolCall
+	byID  map[string]*ToolCall
+	now   func() time.Time
+}
+
+func NewToolAudit() *ToolAudit {
+	return &ToolAudit{byID: map[string]*ToolCall{}, now: time.Now}
+}
+
+// Observe updates the audit from one event.
+func (a *ToolAudit) Observe(ev Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for _, b := range ev.Blocks() {
+		switch b.Type {
+		case BlockToolUse:
+			c := &ToolCall{
+				ID:              b.ID,
+				Name:            b.Name,
+				Input:           truncateInput(b.Input),
+				ParentToolUseID: ev.ParentToolUseID,
+				StartedAt:       now.UTC(),
+			}
+			a.calls = append(a.calls, c)
+			if b.ID != "" {
+				a.byID[b.ID] = c
+			}
+		case BlockToolResult:
+			c := a.byID[b.ToolUseID]
+			if c == nil {
+				continue
+			}
+			c.Completed = true
+			c.DurationMS = now.Sub(c.StartedAt).Milliseconds()
+			c.IsError = b.IsError
+			if b.IsError {
+				txt := b.Content.Text()
+				c.Error = truncateString(txt, 500)
+				c.Denied = IsPermissionDenial(txt)
+			}
+		}
+	}
+	if ev.Result != nil {
+		for _, d := range ev.Result.PermissionDenials {
+			c := a.byID[d.ToolUseID]
+			if c == nil {
+				c = &ToolCall{ID: d.ToolUseID, Name: d.ToolName, Input: truncateInput(d.ToolInput), StartedAt: now.UTC()}
+				a.calls = append(a.calls, c)
+				a.byID[d.ToolUseID] = c
+			}
+			c.Denied, c.IsError = true, true
+		}
+	}
+}
+
+// Calls returns a copy of all recorded calls in the order they were made.
+func (a *ToolAudit) Calls() []ToolCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]ToolCall, len(a.calls))
+	for i, c := range a.calls {
+		out[i] = *c
+	}
+	return out
+}
+
+// AuditReport summarises a ToolAudit for the task record.
+type AuditReport struct {
+	TotalCalls int            `json:"totalCalls"`
+	Errors     int            `json:"errors"`
+	ByTool     map[string]int `json:"byTool"`
+	// BlockedTools counts denied calls per tool name.
+	BlockedTools map[string]int `json:"blockedTools,omitempty"`
+	// BlockedCommands lists distinct Bash commands that were denied.
+	BlockedCommands []string `json:"blockedCommands,omitempty"`
+	// SuggestedAllow are whitelist entries that would have allowed the
+	// blocked calls, in TOOL_WHITELIST_JSON syntax.
+	SuggestedAllow []string `json:"suggestedAllow,omitempty"`
+}
+
+// Report summarises the audit.
+func (a *ToolAudit) Report() AuditReport {
+	r := AuditReport{ByTool: map[string]int{}}
+	seenCmd, seenAllow := map[string]bool{}, map[string]bool{}
+	for _, c := range a.Calls() {
+		r.TotalCalls++
+		r.ByTool[c.Name]++
+		if c.IsError {
+			r.Errors++
+		}
+		if !c.Denied {
+			continue
+		}
+		if r.BlockedTools == nil {
+			r.BlockedTools = map[string]int{}
+		}
+		r.BlockedTools[c.Name]++
+		allow := c.Name
+		if c.Name == "Bash" {
+			cmd, _ := c.Input["command"].(string)
+			cmd = strings.TrimSpace(cmd)
+			if cmd != "" && !seenCmd[cmd] {
+				seenCmd[cmd] = true
+				r.BlockedCommands = append(r.BlockedCommands, cmd)
+			}
+			prefix := commandPrefix(cmd)
+			if prefix == "" {
+				continue
+			}
+			allow = "Bash(" + prefix + ":*)"
+		}
+		if !seenAllow[allow] {
+			seenAllow[allow] = true
+			r.SuggestedAllow = append(r.SuggestedAllow, allow)
+		}
+	}
+	sort.Strings(r.SuggestedAllow)
+	return r
+}
+
+// subcommandTools take their subcommand into account when suggesting a
+// Bash whitelist prefix; the value is how many leading words to keep.
+var subcommandTools = map[string]int{
+	"gh": 3, "git": 2, "go": 2, "npm": 2, "npx": 2, "yarn": 2, "pnpm": 2,
+	"cargo": 2, "make": 2, "docker": 2, "kubectl": 2,
+}
+
+// valueFlags are the flags of subcommandTools that take the next word as
+// their value, e.g. the repo in "git -C repo push".
+var valueFlags = map[string][]string{
+	"gh":      {"-R", "--repo", "-X", "--method", "-H", "--header", "-f", "-F", "--field", "--raw-field", "-q", "--jq"},
+	"git":     {"-C", "-c", "--git-dir", "--work-tree", "--namespace"},
+	"make":    {"-C", "-f", "--directory", "--file", "--makefile"},
+	"docker":  {"-H", "--host", "--context", "--config", "-l", "--log-level"},
+	"kubectl": {"-n", "--namespace", "--context", "--kubeconfig", "--cluster", "--user", "-s", "--server"},
+	"npm":     {"--prefix", "-w", "--workspace"},
+	"yarn":    {"--cwd"},
+	"pnpm":    {"-C", "--dir", "--filter", "-F"},
+	"cargo":   {"--manifest-path", "-Z", "--config"},
+}
+
+// envAssignment matches a leading VAR=value of a shell command.
+var envAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// commandPrefix returns the leading words of a shell command that identify
+// what it does, e.g. "gh pr diff" for "gh pr diff 12 --name-only". Leading
+// VAR=value assignments and a leading "cd dir &&" are skipped, as are flags
+// (with their values) between the subcommand words. It returns "" when a
+// subcommandTools command cannot be narrowed past its name, since allowing
+// all of git or kubectl is far broader than the call that was blocked.
+func commandPrefix(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) > 0 && fields[0] == "cd" {
+		for i, f := range fields {
+			if f == "&&" || f == ";" || strings.HasSuffix(f, ";") || strings.HasSuffix(f, "&&") {
+				fields = fields[i+1:]
+				break
+			}
+		}
+	}
+	for len(fields) > 0 && envAssignment.MatchString(fields[0]) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	name := fields[0]
+	n, sub := subcommandTools[name]
+	if !sub {
+		n = 1
+	}
+	out := []string{name}
+	for i := 1; i < len(fields) && len(out) < n; i++ {
+		f := fields[i]
+		if strings.ContainsAny(f, "|;&<>") {
+			break
+		}
+		if strings.HasPrefix(f, "-") {
+			if !strings.Contains(f, "=") && slices.Contains(valueFlags[name], f) {
+				i++
+			}
+			continue
+		}
+		out = append(out, f)
+	}
+	if sub && len(out) < 2 {
+		return ""
+	}
+	return strings.Join(out, " ")
+}
+
+func truncateInput(in map[string]any) map[string]any {
+	if in == nil {
+		return nil
+	}
+	out, _ := truncateLongStrings(in, 500).(map[string]any)
+	return out
+}
@@ -0,0 +1,91 @@
+package claude
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToolAudit_MatchesCallsAndDetectsDenials(t *testing.T) {
+	input := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"a","name":"Read","input":{"file_path":"x.go"}},{"type":"tool_use","id":"b","name":"Bash","input":{"command":"gh pr diff 12 --name-only"}}]}}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"a","content":"ok"}]}}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"b","is_error":true,"content":"Claude requested permissions to use Bash, but you haven't granted it yet."}]}}
+{"type":"assistant","parent_tool_use_id":"t0","message":{"role":"assistant","content":[{"type":"tool_use","id":"c","name":"WebFetch","input":{"url":"https://example.com"}}]}}
+{"type":"result","subtype":"success","permission_denials":[{"tool_name":"WebFetch","tool_use_id":"c","tool_input":{"url":"https://example.com"}}]}
+`
+	evs, err := ParseStream(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewToolAudit()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return clock }
+	for _, ev := range evs {
+		a.Observe(ev)
+		clock = clock.Add(250 * time.Millisecond)
+	}
+
+	calls := a.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 calls, got %+v", calls)
+	}
+	if c := calls[0]; !c.Completed || c.IsError || c.DurationMS != 250 || c.Input["file_path"] != "x.go" {
+		t.Fatalf("unexpected Read call: %+v", c)
+	}
+	if c := calls[1]; !c.Denied || c.DurationMS != 500 || !strings.Contains(c.Error, "haven't granted") {
+		t.Fatalf("unexpected Bash call: %+v", c)
+	}
+	if c := calls[2]; !c.Denied || c.ParentToolUseID != "t0" {
+		t.Fatalf("expected WebFetch denied via result permission_denials: %+v", c)
+	}
+
+	r := a.Report()
+	if r.TotalCalls != 3 || r.Errors != 2 || r.ByTool["Read"] != 1 || r.BlockedTools["Bash"] != 1 || r.BlockedTools["WebFetch"] != 1 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if len(r.BlockedCommands) != 1 || r.BlockedCommands[0] != "gh pr diff 12 --name-only" {
+		t.Fatalf("unexpected blocked commands: %v", r.BlockedCommands)
+	}
+	if strings.Join(r.SuggestedAllow, ",") != "Bash(gh pr diff:*),WebFetch" {
+		t.Fatalf("unexpected suggestions: %v", r.SuggestedAllow)
+	}
+}
+
+func TestCommandPrefix(t *testing.T) {
+	cases := map[string]string{
+		"git log --oneline -5": "git log",
+		"ls -la":               "ls",
+		"npm test | tail":      "npm test",
+		"go test ./...":        "go test",
+		"":                     "",
+		"git -C repo push":     "git push",
+		"cd x && git push":     "git push",
+		"cd x; npm install":    "npm install",
+		"FOO=1 npm test":       "npm test",
+		"gh -R o/r pr diff 3":  "gh pr diff",
+		"git --version":        "",
+		"kubectl -n prod":      "",
+	}
+	for in, want := range cases {
+		if got := commandPrefix(in); got != want {
+			t.Errorf("commandPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIsPermissionDenial(t *testing.T) {
+	cases := map[string]bool{
+		"Claude requested permissions to use Bash, but you haven't granted it yet.":            true,
+		"Claude requested permissions to write to /repo/a.go, but you haven't granted it yet.": true,
+		"Permission to use Bash with command rm -rf / has been denied.":                        true,
+		"<tool_use_error>No such tool available: WebFetch</tool_use_error>":                    true,
+		"Error: grant the bot permission to use the API first":                                 false,
+		"exit status 1: user has been denied access to the registry":                           false,
+		"docs.md:3: ask for permission to use the staging cluster":                             false,
+	}
+	for text, want := range cases {
+		if got := IsPermissionDenial(text); got != want {
+			t.Errorf("IsPermissionDenial(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
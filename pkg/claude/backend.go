@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Request describes one Claude run independently of how it is executed.
+type Request struct {
+	Prompt string
+	// Dir is the working directory (the checked-out repository).
+	Dir             string
+	AllowedTools    []string
+	DisallowedTools []string
+	PermissionMode  string
+	// MCPConfigPath is passed to the CLI via --mcp-config when set.
+	MCPConfigPath string
+	// ResumeSessionID continues an earlier conversation.
+	ResumeSessionID string
+	Model           string
+	MaxTurns        int
+}
+
+// Backend runs a Request and delivers its events, in order, to handle.
+// Lines that are not valid JSON arrive as an Event with only Raw set.
+// Returning an error from handle stops the run and Run returns that error.
+type Backend interface {
+	Name() string
+	Run(ctx context.Context, req Request, handle func(Event) error) error
+}
+
+// ErrSessionNotFound is returned when ResumeSessionID names a session the
+// backend does not have.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrCLINotFound is returned when the claude executable cannot be found.
+var ErrCLINotFound = errors.New("claude CLI not found")
+
+// ExitError is returned when the `claude` process exits non-zero. Stderr
+// holds the tail of its error output.
+type ExitError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if s := strings.TrimSpace(e.Stderr); s != "" {
+		return fmt.Sprintf("claude: %v: %s", e.Err, lastLine(s))
+	}
+	return fmt.Sprintf("claude: %v", e.Err)
+}
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// ExitCode is the process exit code, or -1 when it was killed by a signal
+// or did not exit normally.
+func (e *ExitError) ExitCode() int {
+	var ee *exec.ExitError
+	if errors.As(e.Err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
+
+// IsSessionNotFound reports whether a run failed because the session it was
+// asked to resume no longer exists.
+func IsSessionNotFound(err error) bool {
+	if errors.Is(err, ErrSessionNotFound) {
+		return true
+	}
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(exitErr.Stderr), "no conversation found")
+}
+
+// NewEvent builds an Event from any JSON-encodable value, filling Raw and the
+// typed payloads exactly as if the line had been decoded from a stream.
+func NewEvent(v any) (Event, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, err
+	}
+	var ev Event
+	if err := json.Unmarshal(b, &ev); err != nil {
+		return Event{}, err
+	}
+	return ev, nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
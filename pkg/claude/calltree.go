@@ -0,0 +1,178 @@
+package claude
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Task (formerly also "Agent") is the tool Claude uses to start a subagent.
+// Events produced inside a subagent carry the Task call's tool_use ID in
+// parent_tool_use_id.
+func isSubagentTool(name string) bool { return name == "Task" || name == "Agent" }
+
+// callNode is one tool_use in the call tree.
+type callNode struct {
+	id     string
+	name   string
+	parent string
+	// agent is set for Task calls.
+	agent *AgentRun
+}
+
+// AgentRun summarises one subagent (Task tool call).
+type AgentRun struct {
+	ToolUseID string `json:"toolUseId"`
+	Subagent  string `json:"subagent"`
+	// Path is the chain of subagents from the top level, e.g.
+	// ["reviewer", "test-runner"] for a subagent started by another one.
+	Path        []string  `json:"path"`
+	Description string    `json:"description,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	DurationMS  int64     `json:"durationMs"`
+	Completed   bool      `json:"completed"`
+	IsError     bool      `json:"isError,omitempty"`
+	Turns       int       `json:"turns"`
+	ToolCalls   int       `json:"toolCalls"`
+	Usage       Usage     `json:"usage"`
+	// CostUSD is estimated from the subagent's own messages; the CLI does
+	// not report per-subagent cost.
+	CostUSD float64 `json:"costUsd"`
+
+	messages map[string]bool
+}
+
+// CallTree links tool calls to the subagent that made them using tool_use
+// IDs and parent_tool_use_id, so events are attributed correctly even when
+// subagents run in parallel or interleave. It is safe for concurrent use.
+type CallTree struct {
+	mu     sync.Mutex
+	nodes  map[string]*callNode
+	agents []*AgentRun
+	model  string
+	now    func() time.Time
+}
+
+func NewCallTree() *CallTree {
+	return &CallTree{nodes: map[string]*callNode{}, now: time.Now}
+}
+
+// Observe adds the tool calls and results of ev to the tree.
+func (t *CallTree) Observe(ev Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ev.Init != nil && ev.Init.Model != "" {
+		t.model = ev.Init.Model
+	}
+	now := t.now()
+	owner := t.agentLocked(ev.ParentToolUseID)
+	if owner != nil && ev.Type == TypeAssistant && ev.Message != nil {
+		msg := ev.Message
+		if msg.ID == "" || !owner.messages[msg.ID] {
+			if msg.ID != "" {
+				owner.messages[msg.ID] = true
+			}
+			owner.Turns++
+			if msg.Usage != nil {
+				owner.Usage.Add(*msg.Usage)
+				model := msg.Model
+				if model == "" {
+					model = t.model
+				}
+				owner.CostUSD += EstimateCostUSD(model, *msg.Usage)
+			}
+		}
+	}
+	for _, b := range ev.Blocks() {
+		switch b.Type {
+		case BlockToolUse:
+			if b.ID == "" || t.nodes[b.ID] != nil {
+				continue
+			}
+			n := &callNode{id: b.ID, name: b.Name, parent: ev.ParentToolUseID}
+			t.nodes[b.ID] = n
+			if owner != nil {
+				owner.ToolCalls++
+			}
+			if isSubagentTool(b.Name) {
+				name, _ := b.Input["subagent_type"].(string)
+				if strings.TrimSpace(name) == "" {
+					name = "general-purpose"
+				}
+				desc, _ := b.Input["description"].(string)
+				n.agent = &AgentRun{
+					ToolUseID:   b.ID,
+					Subagent:    name,
+					Path:        append(t.pathLocked(ev.ParentToolUseID), name),
+					Description: desc,
+					StartedAt:   now.UTC(),
+					messages:    map[string]bool{},
+				}
+				t.agents = append(t.agents, n.agent)
+			}
+		case BlockToolResult:
+			n := t.nodes[b.ToolUseID]
+			if n == nil || n.agent == nil || n.agent.Completed {
+				continue
+			}
+			n.agent.Completed = true
+			n.agent.IsError = b.IsError
+			n.agent.DurationMS = now.Sub(n.agent.StartedAt).Milliseconds()
+		}
+	}
+}
+
+// agentLocked returns the innermost subagent that owns toolUseID (the
+// subagent itself when toolUseID is a Task call).
+func (t *CallTree) agentLocked(toolUseID string) *AgentRun {
+	for id, hops := toolUseID, 0; id != "" && hops < 64; hops++ {
+		n := t.nodes[id]
+		if n == nil {
+			return nil
+		}
+		if n.agent != nil {
+			return n.agent
+		}
+		id = n.parent
+	}
+	return nil
+}
+
+func (t *CallTree) pathLocked(toolUseID string) []string {
+	if a := t.agentLocked(toolUseID); a != nil {
+		return append([]string(nil), a.Path...)
+	}
+	return nil
+}
+
+// Path returns the subagent chain that owns toolUseID: for an event, pass
+// its ParentToolUseID; for a tool call or result, pass the call's ID to
+// include the subagent it started. Top-level calls return nil.
+func (t *CallTree) Path(toolUseID string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pathLocked(toolUseID)
+}
+
+// CallerPath returns the subagent chain that made tool call toolUseID.
+func (t *CallTree) CallerPath(toolUseID string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := t.nodes[toolUseID]; n != nil {
+		return t.pathLocked(n.parent)
+	}
+	return nil
+}
+
+// Agents returns a copy of every subagent run in start order.
+func (t *CallTree) Agents() []AgentRun {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]AgentRun, len(t.agents))
+	for i, a := range t.agents {
+		out[i] = *a
+		out[i].Path = append([]string(nil), a.Path...)
+		out[i].messages = nil
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package claude
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Two subagents run in parallel and their events interleave; the second one
+// starts a nested subagent.
+const parallelAgentsFixture = `{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4-5"}
+{"type":"assistant","message":{"id":"m0","content":[{"type":"tool_use","id":"ta","name":"Task","input":{"subagent_type":"security","description":"audit auth"}},{"type":"tool_use","id":"tb","name":"Task","input":{"subagent_type":"tests","prompt":"run"}}]}}
+{"type":"assistant","parent_tool_use_id":"tb","message":{"id":"b1","content":[{"type":"tool_use","id":"tb1","name":"Bash","input":{"command":"go test ./..."}}],"usage":{"input_tokens":1000000}}}
+{"type":"assistant","parent_tool_use_id":"ta","message":{"id":"a1","content":[{"type":"tool_use","id":"ta1","name":"Read","input":{"file_path":"auth.go"}}]}}
+{"type":"user","parent_tool_use_id":"tb","message":{"content":[{"type":"tool_result","tool_use_id":"tb1","content":"FAIL"}]}}
+{"type":"assistant","parent_tool_use_id":"tb","message":{"id":"b2","content":[{"type":"tool_use","id":"tc","name":"Task","input":{"subagent_type":"flaky-finder"}}]}}
+{"type":"assistant","parent_tool_use_id":"tc","message":{"id":"c1","content":[{"type":"tool_use","id":"tc1","name":"Grep","input":{"pattern":"Sleep"}}]}}
+{"type":"user","parent_tool_use_id":"ta","message":{"content":[{"type":"tool_result","tool_use_id":"ta1","content":"package auth"}]}}
+{"type":"user","parent_tool_use_id":"tb","message":{"content":[{"type":"tool_result","tool_use_id":"tc","content":"none"}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"ta","content":"no issues"},{"type":"tool_result","tool_use_id":"tb","content":"tests fail","is_error":true}]}}
+`
+
+func TestCallTree_AttributesInterleavedSubagents(t *testing.T) {
+	evs, err := ParseStream(strings.NewReader(parallelAgentsFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewCallTree()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tree.now = func() time.Time { return clock }
+	for _, ev := range evs {
+		tree.Observe(ev)
+		clock = clock.Add(time.Second)
+	}
+
+	if got := strings.Join(tree.CallerPath("ta1"), ">"); got != "security" {
+		t.Fatalf("Read should belong to security, got %q", got)
+	}
+	if got := strings.Join(tree.CallerPath("tc1"), ">"); got != "tests>flaky-finder" {
+		t.Fatalf("Grep should belong to tests>flaky-finder, got %q", got)
+	}
+	if tree.CallerPath("ta") != nil {
+		t.Fatalf("top-level Task call should have no caller path")
+	}
+
+	agents := tree.Agents()
+	if len(agents) != 3 {
+		t.Fatalf("expected 3 subagents, got %+v", agents)
+	}
+	sec, tests, nested := agents[0], agents[1], agents[2]
+	if sec.Subagent != "security" || sec.Description != "audit auth" || sec.ToolCalls != 1 || sec.DurationMS != 8000 || sec.IsError {
+		t.Fatalf("unexpected security agent: %+v", sec)
+	}
+	if !tests.Completed || !tests.IsError || tests.Turns != 2 || tests.ToolCalls != 2 || tests.CostUSD != 3 {
+		t.Fatalf("unexpected tests agent: %+v", tests)
+	}
+	if strings.Join(nested.Path, ">") != "tests>flaky-finder" || nested.ToolCalls != 1 || nested.DurationMS != 3000 {
+		t.Fatalf("unexpected nested agent: %+v", nested)
+	}
+}
+
+func TestConciseRenderer_LabelsSubagentEvents(t *testing.T) {
+	evs, err := ParseStream(strings.NewReader(parallelAgentsFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r := NewConciseRenderer(&buf)
+	for _, ev := range evs {
+		if err := r.Render(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"🔧 [tests] tool_use: Task",
+		"  🔧 [tests] tool_use: Bash - cmd=go test ./...",
+		"  🔧 [security] tool_use: Read - file=auth.go",
+		"    🔧 [tests > flaky-finder] tool_use: Grep",
+		"  🟢 [tests > flaky-finder] tool_result: \"none\"",
+		"🔴 [tests] tool_result: \"tests fail\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -1,30 +1,22 @@
 package claude
 
 import (
-	"bufio"
-	"encoding/json"
+	"errors"
 	"io"
 )
 
-// Minimal stream-json event
-type Event struct {
-	Type string `json:"type"`
-	Data any    `json:"data,omitempty"`
-}
-
 // ParseStream decodes line-delimited JSON events.
 func ParseStream(r io.Reader) ([]Event, error) {
 	var out []Event
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		var e Event
-		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+	dec := NewDecoder(r)
+	for {
+		e, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, e)
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	return out, nil
 }
@@ -15,3 +15,67 @@ func TestParseStream(t *testing.T) {
 		t.Fatalf("unexpected events: %+v", evs)
 	}
 }
+
+func TestEventUnmarshal_Typed(t *testing.T) {
+	input := `{"type":"system","subtype":"init","session_id":"s1","cwd":"/repo","model":"m","tools":["Read","Bash"],"mcp_servers":[{"name":"gh","status":"connected"}]}
+{"type":"assistant","session_id":"s1","parent_tool_use_id":null,"message":{"role":"assistant","content":[{"type":"text","text":"hi"},{"type":"tool_use","id":"tu1","name":"Read","input":{"file_path":"a.go"}}],"usage":{"input_tokens":10,"output_tokens":2}}}
+{"type":"user","session_id":"s1","parent_tool_use_id":"tu0","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":[{"type":"text","text":"package a"}],"is_error":true}]}}
+{"type":"result","subtype":"success","session_id":"s1","is_error":false,"duration_ms":1200,"num_turns":3,"result":"ok","total_cost_usd":0.25,"usage":{"input_tokens":100,"output_tokens":20,"cache_read_input_tokens":5}}
+`
+	evs, err := ParseStream(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(evs) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(evs))
+	}
+	if in := evs[0].Init; in == nil || evs[0].SessionID != "s1" || in.CWD != "/repo" || len(in.Tools) != 2 || in.MCPServers[0].Name != "gh" {
+		t.Fatalf("unexpected init: %+v", evs[0])
+	}
+	blocks := evs[1].Blocks()
+	if len(blocks) != 2 || blocks[0].Text != "hi" || blocks[1].Type != BlockToolUse || blocks[1].Input["file_path"] != "a.go" {
+		t.Fatalf("unexpected assistant blocks: %+v", blocks)
+	}
+	if u := evs[1].Message.Usage; u == nil || u.InputTokens != 10 {
+		t.Fatalf("unexpected assistant usage: %+v", u)
+	}
+	res := evs[2].Blocks()
+	if evs[2].ParentToolUseID != "tu0" || len(res) != 1 || res[0].ToolUseID != "tu1" || !res[0].IsError || res[0].Content.Text() != "package a" {
+		t.Fatalf("unexpected tool_result: %+v", evs[2])
+	}
+	r := evs[3].Result
+	if r == nil || r.NumTurns != 3 || r.TotalCostUSD != 0.25 || r.Usage.CacheReadInputTokens != 5 || r.Result != "ok" {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	if len(evs[3].Raw) == 0 {
+		t.Fatalf("expected raw bytes to be retained")
+	}
+}
+
+func TestContent_AcceptsString(t *testing.T) {
+	evs, err := ParseStream(strings.NewReader(`{"type":"user","message":{"role":"user","content":"plain prompt"}}` + "\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := evs[0].Blocks().Text(); got != "plain prompt" {
+		t.Fatalf("unexpected text: %q", got)
+	}
+}
+
+func TestStatsFromResult(t *testing.T) {
+	evs, err := ParseStream(strings.NewReader(`{"type":"result","subtype":"success","duration_ms":5000,"duration_api_ms":4000,"num_turns":7,"total_cost_usd":0.42,"usage":{"input_tokens":11,"output_tokens":22,"cache_creation_input_tokens":33,"cache_read_input_tokens":44}}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := StatsFromResult(evs[0])
+	if !ok {
+		t.Fatalf("expected stats from result event")
+	}
+	want := Stats{InputTokens: 11, OutputTokens: 22, CacheCreationTokens: 33, CacheReadTokens: 44, CostUSD: 0.42, NumTurns: 7, DurationMS: 5000, DurationAPIMS: 4000}
+	if s != want {
+		t.Fatalf("stats = %+v, want %+v", s, want)
+	}
+	if _, ok := StatsFromResult(Event{Type: TypeAssistant}); ok {
+		t.Fatalf("expected no stats for assistant event")
+	}
+}
@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CLIBackend runs the `claude` binary with --output-format stream-json.
+type CLIBackend struct {
+	// Path is the executable to run; defaults to "claude" on PATH.
+	Path string
+	// Stderr receives the CLI's stderr in addition to the captured tail; defaults to os.Stderr.
+	Stderr io.Writer
+	// KillGrace is how long a cancelled run gets to exit after SIGTERM
+	// before its process group is killed; defaults to 5s.
+	KillGrace time.Duration
+}
+
+func NewCLIBackend() *CLIBackend { return &CLIBackend{} }
+
+func (b *CLIBackend) Name() string { return "cli" }
+
+// CLIArgs builds the `claude` arguments for req.
+func CLIArgs(req Request) []string {
+	// Use --print for non-interactive mode; stream-json requires --verbose per CLI docs
+	args := []string{"--print", "--output-format", "stream-json", "--verbose"}
+	permissionMode := req.PermissionMode
+	if permissionMode == "" {
+		permissionMode = "default"
+	}
+	args = append(args, "--permission-mode", permissionMode)
+	if len(req.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(req.AllowedTools, ","))
+	}
+	if len(req.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(req.DisallowedTools, ","))
+	}
+	if req.Model != "" {
+		args = append(args, "--model", req.Model)
+	}
+	if req.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(req.MaxTurns))
+	}
+	if req.ResumeSessionID != "" {
+		args = append(args, "--resume", req.ResumeSessionID)
+	}
+	// Provide prompt via -p to ensure non-interactive input is accepted even for multi-line prompts
+	args = append(args, "-p", req.Prompt)
+	if req.MCPConfigPath != "" {
+		args = append([]string{"--mcp-config", req.MCPConfigPath}, args...)
+	}
+	return args
+}
+
+func (b *CLIBackend) Run(ctx context.Context, req Request, handle func(Event) error) error {
+	path := b.Path
+	if path == "" {
+		path = "claude"
+	}
+	stderr := b.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, CLIArgs(req)...)
+	cmd.Dir = req.Dir
+	setProcessGroup(cmd)
+	cmd.WaitDelay = b.KillGrace
+	if cmd.WaitDelay <= 0 {
+		cmd.WaitDelay = 5 * time.Second
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderrTail := &tailBuffer{max: 16 * 1024}
+	cmd.Stderr = io.MultiWriter(stderr, stderrTail)
+	if err := cmd.Start(); err != nil {
+		if _, lookErr := exec.LookPath(path); lookErr != nil {
+			return fmt.Errorf("%w: %v", ErrCLINotFound, lookErr)
+		}
+		return err
+	}
+
+	var stopErr error
+	dec := NewDecoder(stdout)
+	for {
+		ev, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var lineErr *LineError
+		if err != nil && !errors.As(err, &lineErr) {
+			stopErr = err
+			break
+		}
+		if err := handle(ev); err != nil {
+			stopErr = err
+			break
+		}
+	}
+	if stopErr != nil {
+		cancel()
+	}
+	waitErr := cmd.Wait()
+	if ctx.Err() != nil {
+		// Cancelled (handler error, timeout or caller): make sure nothing
+		// Claude spawned outlives the run.
+		killProcessGroup(cmd)
+	}
+	if stopErr != nil {
+		return stopErr
+	}
+	if waitErr != nil {
+		return &ExitError{Err: waitErr, Stderr: stderrTail.String()}
+	}
+	return nil
+}
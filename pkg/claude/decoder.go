@@ -0,0 +1,65 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Decoder reads stream-json events one line at a time as they arrive.
+// Unlike bufio.Scanner it has no maximum line length, so large tool results
+// (file reads, diffs) decode like any other event.
+type Decoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+// LineError reports a line that could not be decoded. It is recoverable:
+// calling Next again continues with the following line.
+type LineError struct {
+	Line int
+	Raw  []byte
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("stream-json line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the next event, skipping blank lines. It returns io.EOF once
+// the stream is exhausted and a *LineError (alongside an Event whose Raw
+// holds the offending line) when a line is not valid JSON.
+func (d *Decoder) Next() (Event, error) {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return Event{}, err
+		}
+		d.line++
+		line = bytes.TrimRight(line, "\r\n")
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return Event{}, err
+			}
+			continue
+		}
+		var ev Event
+		if uerr := json.Unmarshal(line, &ev); uerr != nil {
+			return Event{Raw: line}, &LineError{Line: d.line, Raw: line, Err: uerr}
+		}
+		// A final line without a trailing newline is still a complete event;
+		// the read error (normally io.EOF) surfaces on the next call.
+		return ev, nil
+	}
+}
+
+// Line returns the number of lines consumed so far.
+func (d *Decoder) Line() int { return d.line }
@@ -0,0 +1,61 @@
+package claude
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_VeryLongLine(t *testing.T) {
+	big := strings.Repeat("x", 1<<20)
+	input := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t","content":"` + big + `"}]}}` + "\n" +
+		`{"type":"result","subtype":"success"}`
+	dec := NewDecoder(strings.NewReader(input))
+	ev, err := dec.Next()
+	if err != nil {
+		t.Fatalf("next: %v", err)
+	}
+	if got := len(ev.Blocks()[0].Content.Text()); got != len(big) {
+		t.Fatalf("tool_result truncated: %d bytes", got)
+	}
+	ev, err = dec.Next()
+	if err != nil || ev.Type != TypeResult {
+		t.Fatalf("expected trailing result without newline, got %+v err=%v", ev, err)
+	}
+	if _, err := dec.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecoder_MalformedLineIsRecoverable(t *testing.T) {
+	input := "{\"type\":\"system\"}\nnot json\n\n{\"type\":\"result\"}\n"
+	dec := NewDecoder(strings.NewReader(input))
+	if ev, err := dec.Next(); err != nil || ev.Type != TypeSystem {
+		t.Fatalf("first: %+v %v", ev, err)
+	}
+	ev, err := dec.Next()
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 2 || string(lineErr.Raw) != "not json" || string(ev.Raw) != "not json" {
+		t.Fatalf("expected line error for line 2, got %v", err)
+	}
+	if ev, err := dec.Next(); err != nil || ev.Type != TypeResult {
+		t.Fatalf("expected decoding to resume, got %+v %v", ev, err)
+	}
+}
+
+func TestDecoder_ReadsWhileWriterIsOpen(t *testing.T) {
+	pr, pw := io.Pipe()
+	dec := NewDecoder(pr)
+	go func() {
+		_, _ = io.WriteString(pw, "{\"type\":\"system\",\"session_id\":\"s\"}\n")
+	}()
+	ev, err := dec.Next()
+	if err != nil || ev.SessionID != "s" {
+		t.Fatalf("expected event before writer closed, got %+v %v", ev, err)
+	}
+	pw.Close()
+	if _, err := dec.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF after close, got %v", err)
+	}
+}
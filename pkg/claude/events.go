@@ -0,0 +1,174 @@
+package claude
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Event types emitted by `claude --output-format stream-json`.
+const (
+	TypeSystem    = "system"
+	TypeAssistant = "assistant"
+	TypeUser      = "user"
+	TypeResult    = "result"
+)
+
+// Content block types found in assistant and user messages.
+const (
+	BlockText       = "text"
+	BlockThinking   = "thinking"
+	BlockToolUse    = "tool_use"
+	BlockToolResult = "tool_result"
+)
+
+// Event is a single stream-json line. Fields common to every event live on
+// the envelope; system/init and result payloads are decoded into Init and
+// Result according to Type.
+type Event struct {
+	Type            string   `json:"type"`
+	Subtype         string   `json:"subtype,omitempty"`
+	SessionID       string   `json:"session_id,omitempty"`
+	ParentToolUseID string   `json:"parent_tool_use_id,omitempty"`
+	Message         *Message `json:"message,omitempty"`
+	Data            any      `json:"data,omitempty"`
+
+	Init   *SystemInit `json:"-"`
+	Result *Result     `json:"-"`
+
+	// Raw holds the exact bytes the event was decoded from.
+	Raw json.RawMessage `json:"-"`
+}
+
+// SystemInit is the payload of the first `system` event (subtype "init").
+type SystemInit struct {
+	CWD            string      `json:"cwd,omitempty"`
+	Model          string      `json:"model,omitempty"`
+	Tools          []string    `json:"tools,omitempty"`
+	MCPServers     []MCPServer `json:"mcp_servers,omitempty"`
+	PermissionMode string      `json:"permissionMode,omitempty"`
+	APIKeySource   string      `json:"apiKeySource,omitempty"`
+}
+
+type MCPServer struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Message is the Anthropic message carried by assistant and user events.
+type Message struct {
+	ID         string  `json:"id,omitempty"`
+	Role       string  `json:"role,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Content    Content `json:"content,omitempty"`
+	StopReason string  `json:"stop_reason,omitempty"`
+	Usage      *Usage  `json:"usage,omitempty"`
+}
+
+// Content is a list of content blocks. The API allows a bare string in place
+// of a single text block, so both shapes are accepted when decoding.
+type Content []ContentBlock
+
+func (c *Content) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*c = Content{{Type: BlockText, Text: s}}
+		return nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(b, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// Text concatenates all text blocks, separated by newlines.
+func (c Content) Text() string {
+	parts := make([]string, 0, len(c))
+	for _, b := range c {
+		if b.Type == BlockText && b.Text != "" {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ContentBlock covers text, thinking, tool_use and tool_result blocks.
+type ContentBlock struct {
+	Type string `json:"type"`
+
+	// text / thinking
+	Text     string `json:"text,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+
+	// tool_use
+	ID    string         `json:"id,omitempty"`
+	Name  string         `json:"name,omitempty"`
+	Input map[string]any `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string  `json:"tool_use_id,omitempty"`
+	Content   Content `json:"content,omitempty"`
+	IsError   bool    `json:"is_error,omitempty"`
+}
+
+// Usage reports token counts for a message or a whole run.
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens,omitempty"`
+}
+
+// Result is the payload of the final `result` event.
+type Result struct {
+	IsError           bool               `json:"is_error"`
+	DurationMS        int64              `json:"duration_ms"`
+	DurationAPIMS     int64              `json:"duration_api_ms"`
+	NumTurns          int                `json:"num_turns"`
+	Result            string             `json:"result,omitempty"`
+	TotalCostUSD      float64            `json:"total_cost_usd"`
+	Usage             *Usage             `json:"usage,omitempty"`
+	PermissionDenials []PermissionDenial `json:"permission_denials,omitempty"`
+}
+
+// PermissionDenial is a tool call the CLI refused to run.
+type PermissionDenial struct {
+	ToolName  string         `json:"tool_name"`
+	ToolUseID string         `json:"tool_use_id"`
+	ToolInput map[string]any `json:"tool_input,omitempty"`
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	// Alias drops the method set so the envelope decodes with default rules.
+	type envelope Event
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return err
+	}
+	*e = Event(env)
+	switch {
+	case e.Type == TypeSystem && e.Subtype == "init":
+		var in SystemInit
+		if err := json.Unmarshal(b, &in); err != nil {
+			return err
+		}
+		e.Init = &in
+	case e.Type == TypeResult:
+		var r Result
+		if err := json.Unmarshal(b, &r); err != nil {
+			return err
+		}
+		e.Result = &r
+	}
+	e.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// Blocks returns the message content blocks, or nil for events without a message.
+func (e Event) Blocks() Content {
+	if e.Message == nil {
+		return nil
+	}
+	return e.Message.Content
+}
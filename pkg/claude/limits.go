@@ -0,0 +1,202 @@
+package claude
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits bound a Claude run. Zero values mean no limit.
+type Limits struct {
+	// Timeout is the wall-clock limit for the whole task.
+	Timeout time.Duration
+	// MaxTurns counts assistant messages (model responses).
+	MaxTurns     int
+	MaxToolCalls int
+	// MaxTokens counts input (including cache writes) plus output tokens.
+	// Cache reads are excluded: they are cheap and re-counted every turn.
+	MaxTokens  int64
+	MaxCostUSD float64
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool { return l == Limits{} }
+
+type LimitKind string
+
+const (
+	LimitTimeout   LimitKind = "timeout"
+	LimitTurns     LimitKind = "max_turns"
+	LimitToolCalls LimitKind = "max_tool_calls"
+	LimitTokens    LimitKind = "max_tokens"
+	LimitCost      LimitKind = "max_cost"
+)
+
+// Task statuses for runs stopped by a limit.
+const (
+	StatusTimedOut       = "timed_out"
+	StatusBudgetExceeded = "budget_exceeded"
+)
+
+// LimitError is returned when a run is stopped because it hit a limit.
+type LimitError struct {
+	Kind     LimitKind `json:"kind"`
+	Limit    string    `json:"limit"`
+	Observed string    `json:"observed,omitempty"`
+}
+
+func (e *LimitError) Error() string {
+	if e.Observed == "" {
+		return fmt.Sprintf("claude run stopped: %s limit %s reached", e.Kind, e.Limit)
+	}
+	return fmt.Sprintf("claude run stopped: %s limit %s reached (%s)", e.Kind, e.Limit, e.Observed)
+}
+
+// Status is the task status for the limit: timed_out for the wall-clock
+// limit, budget_exceeded for everything else.
+func (e *LimitError) Status() string {
+	if e.Kind == LimitTimeout {
+		return StatusTimedOut
+	}
+	return StatusBudgetExceeded
+}
+
+// LimitMeter checks Limits against a live event stream. Usage is taken from
+// assistant messages as they arrive (deduplicated by message ID, since the
+// CLI repeats a message once per content block) and replaced by the
+// authoritative totals of each result event. A meter may span several runs,
+// e.g. a review repair turn. It is safe for concurrent use.
+type LimitMeter struct {
+	mu        sync.Mutex
+	limits    Limits
+	model     string
+	turns     int
+	toolCalls int
+	// done is usage of runs that have finished or been settled.
+	done     Usage
+	doneCost float64
+	// live is usage of the running session by message ID.
+	live map[string]Usage
+	anon int
+	err  *LimitError
+}
+
+func NewLimitMeter(l Limits) *LimitMeter {
+	return &LimitMeter{limits: l, live: map[string]Usage{}}
+}
+
+// Observe updates the meter from one event and returns a *LimitError once a
+// limit is exceeded.
+func (m *LimitMeter) Observe(ev Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	switch {
+	case ev.Init != nil && ev.Init.Model != "":
+		m.model = ev.Init.Model
+	case ev.Type == TypeAssistant && ev.Message != nil:
+		msg := ev.Message
+		if msg.Model != "" {
+			m.model = msg.Model
+		}
+		id := msg.ID
+		if id == "" {
+			m.anon++
+			id = fmt.Sprintf("#%d", m.anon)
+		}
+		if _, seen := m.live[id]; !seen {
+			m.turns++
+		}
+		var u Usage
+		if msg.Usage != nil {
+			u = *msg.Usage
+		}
+		m.live[id] = u
+		for _, b := range msg.Content {
+			if b.Type == BlockToolUse {
+				m.toolCalls++
+			}
+		}
+	case ev.Result != nil:
+		r := ev.Result
+		if r.Usage != nil {
+			m.done.Add(*r.Usage)
+		} else {
+			m.done.Add(m.liveUsage())
+		}
+		if r.TotalCostUSD > 0 {
+			m.doneCost += r.TotalCostUSD
+		} else {
+			m.doneCost += EstimateCostUSD(m.model, m.liveUsage())
+		}
+		m.live = map[string]Usage{}
+		// Without a turn limit of ours the cap was the backend's own, a
+		// plain failed run
+		if ev.Subtype == "error_max_turns" && m.limits.MaxTurns > 0 {
+			m.err = &LimitError{Kind: LimitTurns, Limit: fmt.Sprint(m.limits.MaxTurns), Observed: fmt.Sprintf("%d turns", r.NumTurns)}
+			return m.err
+		}
+	}
+	m.err = m.check()
+	if m.err == nil {
+		return nil
+	}
+	return m.err
+}
+
+func (m *LimitMeter) liveUsage() Usage {
+	var u Usage
+	for _, v := range m.live {
+		u.Add(v)
+	}
+	return u
+}
+
+func (m *LimitMeter) totals() (Usage, float64) {
+	live := m.liveUsage()
+	u := m.done
+	u.Add(live)
+	return u, m.doneCost + EstimateCostUSD(m.model, live)
+}
+
+func (m *LimitMeter) check() *LimitError {
+	l := m.limits
+	if l.MaxTurns > 0 && m.turns > l.MaxTurns {
+		return &LimitError{Kind: LimitTurns, Limit: fmt.Sprint(l.MaxTurns), Observed: fmt.Sprintf("%d turns", m.turns)}
+	}
+	if l.MaxToolCalls > 0 && m.toolCalls > l.MaxToolCalls {
+		return &LimitError{Kind: LimitToolCalls, Limit: fmt.Sprint(l.MaxToolCalls), Observed: fmt.Sprintf("%d tool calls", m.toolCalls)}
+	}
+	u, cost := m.totals()
+	if tokens := u.InputTokens + u.CacheCreationInputTokens + u.OutputTokens; l.MaxTokens > 0 && tokens > l.MaxTokens {
+		return &LimitError{Kind: LimitTokens, Limit: fmt.Sprint(l.MaxTokens), Observed: fmt.Sprintf("%d tokens", tokens)}
+	}
+	if l.MaxCostUSD > 0 && cost > l.MaxCostUSD {
+		return &LimitError{Kind: LimitCost, Limit: fmt.Sprintf("$%.2f", l.MaxCostUSD), Observed: fmt.Sprintf("$%.4f", cost)}
+	}
+	return nil
+}
+
+// Settle closes out a run that ended without a result event (for example
+// because it was killed) and returns the usage and estimated cost seen
+// live, so it can still be accounted for. It returns zeros when the run
+// reported its own result.
+func (m *LimitMeter) Settle() (Usage, float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	live := m.liveUsage()
+	cost := EstimateCostUSD(m.model, live)
+	m.done.Add(live)
+	m.doneCost += cost
+	m.live = map[string]Usage{}
+	return live, cost
+}
+
+// Err returns the limit that stopped the run, if any.
+func (m *LimitMeter) Err() *LimitError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
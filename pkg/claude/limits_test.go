@@ -0,0 +1,85 @@
+package claude
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func observeAll(t *testing.T, m *LimitMeter, stream string) error {
+	t.Helper()
+	evs, err := ParseStream(strings.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range evs {
+		if err := m.Observe(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestLimitMeter_CountsTurnsOncePerMessage(t *testing.T) {
+	// The CLI emits one assistant event per content block of a message.
+	stream := `{"type":"assistant","message":{"id":"m1","model":"claude-sonnet-4-5","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":100,"output_tokens":10}}}
+{"type":"assistant","message":{"id":"m1","model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"t1","name":"Read","input":{}}],"usage":{"input_tokens":100,"output_tokens":10}}}
+{"type":"assistant","message":{"id":"m2","model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"t2","name":"Read","input":{}}],"usage":{"input_tokens":100,"output_tokens":10}}}
+`
+	if err := observeAll(t, NewLimitMeter(Limits{MaxTurns: 2, MaxToolCalls: 2, MaxTokens: 220}), stream); err != nil {
+		t.Fatalf("limits should not trip: %v", err)
+	}
+	err := observeAll(t, NewLimitMeter(Limits{MaxToolCalls: 1}), stream)
+	var le *LimitError
+	if !errors.As(err, &le) || le.Kind != LimitToolCalls || le.Status() != StatusBudgetExceeded {
+		t.Fatalf("expected max_tool_calls, got %v", err)
+	}
+	err = observeAll(t, NewLimitMeter(Limits{MaxTokens: 200}), stream)
+	if !errors.As(err, &le) || le.Kind != LimitTokens {
+		t.Fatalf("expected max_tokens, got %v", err)
+	}
+}
+
+func TestLimitMeter_CostSpansRuns(t *testing.T) {
+	m := NewLimitMeter(Limits{MaxCostUSD: 0.05})
+	run := `{"type":"assistant","message":{"id":"a","content":[{"type":"text","text":"x"}]}}
+{"type":"result","subtype":"success","total_cost_usd":0.03,"usage":{"input_tokens":1,"output_tokens":1}}
+`
+	if err := observeAll(t, m, run); err != nil {
+		t.Fatalf("first run within budget: %v", err)
+	}
+	err := observeAll(t, m, strings.ReplaceAll(run, `"id":"a"`, `"id":"b"`))
+	var le *LimitError
+	if !errors.As(err, &le) || le.Kind != LimitCost {
+		t.Fatalf("expected max_cost across runs, got %v", err)
+	}
+	if m.Err() != le {
+		t.Fatalf("Err should return the stored limit error")
+	}
+}
+
+func TestLimitMeter_SettleReturnsUnreportedUsage(t *testing.T) {
+	m := NewLimitMeter(Limits{})
+	_ = observeAll(t, m, `{"type":"assistant","message":{"id":"a","model":"claude-sonnet-4-5","content":[],"usage":{"input_tokens":1000000}}}
+`)
+	u, cost := m.Settle()
+	if u.InputTokens != 1000000 || cost != 3 {
+		t.Fatalf("unexpected settle: %+v %v", u, cost)
+	}
+	if _, cost := m.Settle(); cost != 0 {
+		t.Fatalf("second settle should be empty, got %v", cost)
+	}
+}
+
+func TestLimitMeter_MaxTurnsResultNeedsLimit(t *testing.T) {
+	stream := `{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":30}
+`
+	if err := observeAll(t, NewLimitMeter(Limits{}), stream); err != nil {
+		t.Fatalf("the backend's own turn cap is not a limit error: %v", err)
+	}
+	err := observeAll(t, NewLimitMeter(Limits{MaxTurns: 5}), stream)
+	var le *LimitError
+	if !errors.As(err, &le) || le.Kind != LimitTurns || le.Limit != "5" {
+		t.Fatalf("expected max_turns, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package claude
+
+import "strings"
+
+// Price is USD per million tokens.
+type Price struct {
+	Input      float64
+	Output     float64
+	CacheWrite float64
+	CacheRead  float64
+}
+
+// priceTable is matched in order by substring of the model name.
+var priceTable = []struct {
+	match string
+	price Price
+}{
+	{"opus-4-5", Price{Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.5}},
+	{"opus", Price{Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5}},
+	{"sonnet", Price{Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3}},
+	{"haiku-4-5", Price{Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.1}},
+	{"haiku", Price{Input: 0.8, Output: 4, CacheWrite: 1, CacheRead: 0.08}},
+}
+
+// PriceFor returns list pricing for model; ok is false for unknown models.
+func PriceFor(model string) (Price, bool) {
+	m := strings.ToLower(model)
+	for _, p := range priceTable {
+		if strings.Contains(m, p.match) {
+			return p.price, true
+		}
+	}
+	return Price{}, false
+}
+
+// EstimateCostUSD prices usage for model. Unknown models are priced as
+// Sonnet so budgets still apply.
+func EstimateCostUSD(model string, u Usage) float64 {
+	p, ok := PriceFor(model)
+	if !ok {
+		p, _ = PriceFor("sonnet")
+	}
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheCreationInputTokens)*p.CacheWrite +
+		float64(u.CacheReadInputTokens)*p.CacheRead) / 1e6
+}
+
+// Add accumulates o into u.
+func (u *Usage) Add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CacheCreationInputTokens += o.CacheCreationInputTokens
+	u.CacheReadInputTokens += o.CacheReadInputTokens
+}
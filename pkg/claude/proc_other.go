@@ -0,0 +1,9 @@
+//go:build !unix
+
+package claude
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,178 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Renderer displays stream events as they arrive. Lines that were not valid
+// JSON are passed as an Event with an empty Type and only Raw set.
+type Renderer interface {
+	Render(ev Event) error
+	// Close flushes any trailing output (open groups, summaries) and
+	// releases the underlying writer when the renderer owns it.
+	Close() error
+}
+
+// Built-in renderer format names accepted by NewRenderer and ParseRenderers.
+const (
+	FormatConcise  = "concise"
+	FormatPretty   = "pretty"
+	FormatRaw      = "raw"
+	FormatMarkdown = "markdown"
+	FormatGitHub   = "github"
+)
+
+// NewRenderer returns the built-in renderer for format writing to w.
+func NewRenderer(format string, w io.Writer) (Renderer, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case FormatConcise:
+		return NewConciseRenderer(w), nil
+	case FormatPretty, "json":
+		return NewPrettyRenderer(w, 400), nil
+	case FormatRaw:
+		return NewRawRenderer(w), nil
+	case FormatMarkdown, "md":
+		return NewMarkdownRenderer(w), nil
+	case FormatGitHub, "gha", "github-actions":
+		return NewGitHubActionsRenderer(w), nil
+	default:
+		return nil, fmt.Errorf("unknown stream format %q", format)
+	}
+}
+
+// ParseRenderers builds renderers from a comma-separated spec such as
+// "concise,markdown:/tmp/review.md". Entries without a path write to stdout;
+// when stdout is nil those entries are skipped so file outputs can be kept
+// while terminal output is off. Files are created and closed by the result.
+func ParseRenderers(spec string, stdout io.Writer) (Renderer, error) {
+	return ParseRenderersFor(spec, stdout, nil)
+}
+
+// ParseRenderersFor is ParseRenderers with every file path mapped through
+// path first, e.g. to give each task a file of its own. A nil path keeps
+// the paths as they are.
+func ParseRenderersFor(spec string, stdout io.Writer, path func(string) string) (Renderer, error) {
+	var rs []Renderer
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		format, file, hasPath := strings.Cut(entry, ":")
+		if !hasPath {
+			if stdout == nil {
+				continue
+			}
+			r, err := NewRenderer(format, stdout)
+			if err != nil {
+				closeAll(rs)
+				return nil, err
+			}
+			rs = append(rs, r)
+			continue
+		}
+		if path != nil {
+			file = path(file)
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			closeAll(rs)
+			return nil, err
+		}
+		r, err := NewRenderer(format, f)
+		if err != nil {
+			f.Close()
+			closeAll(rs)
+			return nil, err
+		}
+		rs = append(rs, &fileRenderer{Renderer: r, f: f})
+	}
+	return MultiRenderer(rs...), nil
+}
+
+func closeAll(rs []Renderer) {
+	for _, r := range rs {
+		_ = r.Close()
+	}
+}
+
+type fileRenderer struct {
+	Renderer
+	f *os.File
+}
+
+func (r *fileRenderer) Close() error {
+	return errors.Join(r.Renderer.Close(), r.f.Close())
+}
+
+type multiRenderer []Renderer
+
+// MultiRenderer fans every event out to all renderers. Errors from one
+// renderer do not stop the others.
+func MultiRenderer(rs ...Renderer) Renderer { return multiRenderer(rs) }
+
+func (m multiRenderer) Render(ev Event) error {
+	var errs []error
+	for _, r := range m {
+		errs = append(errs, r.Render(ev))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiRenderer) Close() error {
+	var errs []error
+	for _, r := range m {
+		errs = append(errs, r.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// RawRenderer writes every line exactly as received.
+type RawRenderer struct{ w io.Writer }
+
+func NewRawRenderer(w io.Writer) *RawRenderer { return &RawRenderer{w: w} }
+
+func (r *RawRenderer) Render(ev Event) error {
+	_, err := fmt.Fprintf(r.w, "%s\n", ev.Raw)
+	return err
+}
+
+func (r *RawRenderer) Close() error { return nil }
+
+// SummarizeToolInput returns the most telling input field of a tool call
+// (file_path, command, path or prompt), or "".
+func SummarizeToolInput(in map[string]any) string {
+	if in == nil {
+		return ""
+	}
+	// Common fields
+	if fp, ok := in["file_path"].(string); ok && fp != "" {
+		return fmt.Sprintf("file=%s", fp)
+	}
+	if cmd, ok := in["command"].(string); ok && cmd != "" {
+		return fmt.Sprintf("cmd=%s", truncateString(cmd, 120))
+	}
+	if p, ok := in["path"].(string); ok && p != "" {
+		return fmt.Sprintf("path=%s", p)
+	}
+	if prompt, ok := in["prompt"].(string); ok && prompt != "" {
+		return fmt.Sprintf("prompt=%s", truncateString(prompt, 120))
+	}
+	return ""
+}
+
+func truncateString(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	rs := []rune(s)
+	if len(rs) > max {
+		return string(rs[:max]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package claude
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ConciseRenderer prints a compact summary of stream-json events:
+// - assistant preambles (message text)
+// - tool_use: name and key input summary (file_path, command, subagent_type, etc.)
+// - tool_result: success/error with brief content
+//
+// Lines produced inside a subagent are indented and labelled with the
+// subagent chain, attributed through a CallTree.
+type ConciseRenderer struct {
+	w    io.Writer
+	tree *CallTree
+}
+
+func NewConciseRenderer(w io.Writer) *ConciseRenderer {
+	return &ConciseRenderer{w: w, tree: NewCallTree()}
+}
+
+func (r *ConciseRenderer) Render(ev Event) error {
+	if ev.Type == "" {
+		_, err := fmt.Fprintf(r.w, "%s\n", ev.Raw)
+		return err
+	}
+	r.tree.Observe(ev)
+	for _, part := range ev.Blocks() {
+		var err error
+		switch part.Type {
+		case BlockText:
+			if strings.TrimSpace(part.Text) != "" {
+				path := r.tree.Path(ev.ParentToolUseID)
+				indent, prefix := agentLabel(path, path)
+				_, err = fmt.Fprintf(r.w, "%s🤖 %sClaude: %q\n", indent, prefix, part.Text)
+			}
+		case BlockToolUse:
+			// A Task call is labelled with the subagent it starts
+			indent, prefix := agentLabel(r.tree.CallerPath(part.ID), r.tree.Path(part.ID))
+			if summary := SummarizeToolInput(part.Input); summary != "" {
+				_, err = fmt.Fprintf(r.w, "%s🔧 %stool_use: %s - %s\n", indent, prefix, part.Name, summary)
+			} else {
+				_, err = fmt.Fprintf(r.w, "%s🔧 %stool_use: %s\n", indent, prefix, part.Name)
+			}
+		case BlockToolResult:
+			if txt := part.Content.Text(); txt != "" {
+				emoji := "🟢"
+				if part.IsError {
+					emoji = "🔴"
+				}
+				indent, prefix := agentLabel(r.tree.CallerPath(part.ToolUseID), r.tree.Path(part.ToolUseID))
+				_, err = fmt.Fprintf(r.w, "%s%s %stool_result: %q\n", indent, emoji, prefix, txt)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// agentLabel indents by the depth of caller and labels a line with the
+// subagent chain it belongs to, e.g. "[reviewer > tests] ".
+func agentLabel(caller, path []string) (indent, prefix string) {
+	indent = strings.Repeat("  ", len(caller))
+	if len(path) > 0 {
+		prefix = "[" + strings.Join(path, " > ") + "] "
+	}
+	return indent, prefix
+}
+
+func (r *ConciseRenderer) Close() error { return nil }
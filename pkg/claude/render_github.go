@@ -0,0 +1,113 @@
+package claude
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GitHubActionsRenderer writes workflow-command output for GitHub Actions
+// logs: each tool result is a collapsible ::group::, failing tools raise a
+// ::warning:: and the final result becomes a ::notice:: (or ::error::).
+// Tool output is wrapped in ::stop-commands:: so it cannot issue workflow
+// commands of its own.
+type GitHubActionsRenderer struct {
+	w         io.Writer
+	toolNames map[string]string
+	// MaxResult caps the runes of each tool result that are written.
+	MaxResult int
+}
+
+func NewGitHubActionsRenderer(w io.Writer) *GitHubActionsRenderer {
+	return &GitHubActionsRenderer{w: w, toolNames: map[string]string{}, MaxResult: 4000}
+}
+
+func (r *GitHubActionsRenderer) Render(ev Event) error {
+	var b strings.Builder
+	switch {
+	case ev.Type == "":
+		r.writeQuoted(&b, string(ev.Raw))
+	case ev.Init != nil:
+		fmt.Fprintf(&b, "::group::Claude session %s\n", ghEscape(ev.SessionID))
+		fmt.Fprintf(&b, "model: %s\ncwd: %s\ntools: %s\n", ev.Init.Model, ev.Init.CWD, strings.Join(ev.Init.Tools, ", "))
+		b.WriteString("::endgroup::\n")
+	case ev.Result != nil:
+		res := ev.Result
+		msg := fmt.Sprintf("%d turns, $%.4f, %.1fs", res.NumTurns, res.TotalCostUSD, float64(res.DurationMS)/1000)
+		if res.IsError {
+			fmt.Fprintf(&b, "::error title=Claude run failed::%s\n", ghEscape(msg))
+		} else {
+			fmt.Fprintf(&b, "::notice title=Claude run::%s\n", ghEscape(msg))
+		}
+	default:
+		for _, part := range ev.Blocks() {
+			switch part.Type {
+			case BlockText:
+				if strings.TrimSpace(part.Text) != "" {
+					r.writeQuoted(&b, "🤖 "+part.Text)
+				}
+			case BlockToolUse:
+				r.toolNames[part.ID] = part.Name
+				line := "🔧 " + part.Name
+				if summary := SummarizeToolInput(part.Input); summary != "" {
+					line += " - " + summary
+				}
+				r.writeQuoted(&b, line)
+			case BlockToolResult:
+				name := r.toolNames[part.ToolUseID]
+				if name == "" {
+					name = "tool"
+				}
+				status := "🟢"
+				if part.IsError {
+					status = "🔴"
+				}
+				fmt.Fprintf(&b, "::group::%s %s result\n", status, ghEscape(name))
+				txt := part.Content.Text()
+				if r.MaxResult > 0 {
+					txt = truncateString(txt, r.MaxResult)
+				}
+				r.writeQuoted(&b, txt)
+				b.WriteString("::endgroup::\n")
+				if part.IsError {
+					first, _, _ := strings.Cut(strings.TrimSpace(part.Content.Text()), "\n")
+					fmt.Fprintf(&b, "::warning title=%s failed::%s\n", ghEscapeProperty(name), ghEscape(truncateString(first, 200)))
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *GitHubActionsRenderer) Close() error { return nil }
+
+// writeQuoted writes untrusted text with workflow commands disabled.
+func (r *GitHubActionsRenderer) writeQuoted(b *strings.Builder, s string) {
+	if !strings.Contains(s, "::") {
+		b.WriteString(strings.TrimRight(s, "\n") + "\n")
+		return
+	}
+	token := stopToken()
+	fmt.Fprintf(b, "::stop-commands::%s\n%s\n::%s::\n", token, strings.TrimRight(s, "\n"), token)
+}
+
+func stopToken() string {
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func ghEscape(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func ghEscapeProperty(s string) string {
+	s = ghEscape(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
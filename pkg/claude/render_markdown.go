@@ -0,0 +1,110 @@
+package claude
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MarkdownRenderer writes a readable Markdown log of a run, suitable for a
+// file artifact or a PR comment: assistant text as paragraphs, tool calls
+// as bold lines, tool results in collapsed <details> blocks and a closing
+// result section.
+type MarkdownRenderer struct {
+	w io.Writer
+	// MaxResult caps the runes of each tool result that are written.
+	MaxResult int
+}
+
+func NewMarkdownRenderer(w io.Writer) *MarkdownRenderer {
+	return &MarkdownRenderer{w: w, MaxResult: 2000}
+}
+
+func (r *MarkdownRenderer) Render(ev Event) error {
+	var b strings.Builder
+	switch {
+	case ev.Type == "":
+		// Non-JSON noise is left out of the Markdown log.
+		return nil
+	case ev.Init != nil:
+		fmt.Fprintf(&b, "## Claude session `%s`\n\n", ev.SessionID)
+		if ev.Init.Model != "" {
+			fmt.Fprintf(&b, "- Model: `%s`\n", ev.Init.Model)
+		}
+		if ev.Init.CWD != "" {
+			fmt.Fprintf(&b, "- Working directory: `%s`\n", ev.Init.CWD)
+		}
+		if len(ev.Init.Tools) > 0 {
+			fmt.Fprintf(&b, "- Tools: %s\n", strings.Join(ev.Init.Tools, ", "))
+		}
+		b.WriteString("\n")
+	case ev.Result != nil:
+		res := ev.Result
+		b.WriteString("---\n\n### Result\n\n")
+		if strings.TrimSpace(res.Result) != "" {
+			b.WriteString(strings.TrimSpace(res.Result) + "\n\n")
+		}
+		status := "success"
+		if res.IsError {
+			status = "error"
+		}
+		fmt.Fprintf(&b, "_%s · %d turns · $%.4f · %.1fs_\n", status, res.NumTurns, res.TotalCostUSD, float64(res.DurationMS)/1000)
+	default:
+		for _, part := range ev.Blocks() {
+			switch part.Type {
+			case BlockText:
+				if t := strings.TrimSpace(part.Text); t != "" {
+					b.WriteString(t + "\n\n")
+				}
+			case BlockToolUse:
+				fmt.Fprintf(&b, "**🔧 %s**", part.Name)
+				if summary := SummarizeToolInput(part.Input); summary != "" {
+					fmt.Fprintf(&b, " %s", codeSpan(summary))
+				}
+				b.WriteString("\n\n")
+			case BlockToolResult:
+				label := "🟢 result"
+				if part.IsError {
+					label = "🔴 error"
+				}
+				txt := part.Content.Text()
+				if r.MaxResult > 0 {
+					txt = truncateString(txt, r.MaxResult)
+				}
+				fence := codeFence(txt)
+				fmt.Fprintf(&b, "<details><summary>%s</summary>\n\n%s\n%s\n%s\n\n</details>\n\n", label, fence, txt, fence)
+			}
+		}
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *MarkdownRenderer) Close() error { return nil }
+
+// codeFence returns a backtick fence longer than any run inside s.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+func codeSpan(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,82 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// PrettyRenderer prints each event as indented JSON with long strings
+// truncated to MaxString runes.
+type PrettyRenderer struct {
+	w         io.Writer
+	MaxString int
+}
+
+func NewPrettyRenderer(w io.Writer, maxString int) *PrettyRenderer {
+	return &PrettyRenderer{w: w, MaxString: maxString}
+}
+
+func (r *PrettyRenderer) Render(ev Event) error {
+	var obj any
+	if err := json.Unmarshal(ev.Raw, &obj); err != nil {
+		// Not JSON – print raw
+		_, err := fmt.Fprintf(r.w, "%s\n", ev.Raw)
+		return err
+	}
+	if r.MaxString > 0 {
+		obj = truncateLongStrings(obj, r.MaxString)
+	}
+	_, err := fmt.Fprintf(r.w, "%s\n", mustPrettyJSON(obj))
+	return err
+}
+
+func (r *PrettyRenderer) Close() error { return nil }
+
+// truncateLongStrings walks an arbitrary JSON-like structure and truncates long string values.
+func truncateLongStrings(v any, max int) any {
+	switch t := v.(type) {
+	case string:
+		if utf8.RuneCountInString(t) > max {
+			// Ensure we do not cut in the middle of a rune
+			rs := []rune(t)
+			if len(rs) > max {
+				return string(rs[:max]) + "… (truncated)"
+			}
+		}
+		return t
+	case []any:
+		out := make([]any, len(t))
+		for i := range t {
+			out[i] = truncateLongStrings(t[i], max)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, val := range t {
+			out[k] = truncateLongStrings(val, max)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func mustPrettyJSON(v any) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err == nil {
+		return string(b)
+	}
+	// Fallback best-effort: try to indent raw bytes if already JSON
+	if bb, ok := v.([]byte); ok {
+		var buf bytes.Buffer
+		if json.Indent(&buf, bb, "", "  ") == nil {
+			return buf.String()
+		}
+		return string(bb)
+	}
+	// Last resort: string format
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,107 @@
+package claude
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const renderFixture = `{"type":"system","subtype":"init","session_id":"s1","model":"m","cwd":"/repo","tools":["Read"]}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Looking"},{"type":"tool_use","id":"t1","name":"Task","input":{"subagent_type":"reviewer","prompt":"check"}}]}}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"::set-output name=x::y","is_error":true}]}}
+{"type":"result","subtype":"success","num_turns":2,"total_cost_usd":0.5,"duration_ms":1500,"result":"All good"}
+`
+
+func renderAll(t *testing.T, r Renderer) {
+	t.Helper()
+	evs, err := ParseStream(strings.NewReader(renderFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range evs {
+		if err := r.Render(ev); err != nil {
+			t.Fatalf("render: %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestConciseRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	renderAll(t, NewConciseRenderer(&buf))
+	out := buf.String()
+	for _, want := range []string{`🤖 Claude: "Looking"`, "🔧 [reviewer] tool_use: Task - prompt=check", `🔴 [reviewer] tool_result: "::set-output name=x::y"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	renderAll(t, NewMarkdownRenderer(&buf))
+	out := buf.String()
+	for _, want := range []string{"## Claude session `s1`", "**🔧 Task** `prompt=check`", "<summary>🔴 error</summary>", "### Result\n\nAll good", "2 turns · $0.5000"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestGitHubActionsRenderer_QuotesToolOutput(t *testing.T) {
+	var buf bytes.Buffer
+	renderAll(t, NewGitHubActionsRenderer(&buf))
+	out := buf.String()
+	if !strings.Contains(out, "::group::🔴 Task result") || !strings.Contains(out, "::warning title=Task failed::") {
+		t.Fatalf("missing group/warning in:\n%s", out)
+	}
+	if !strings.Contains(out, "::stop-commands::") {
+		t.Fatalf("expected tool output containing :: to be wrapped in stop-commands:\n%s", out)
+	}
+	if !strings.Contains(out, "::notice title=Claude run::2 turns") {
+		t.Fatalf("missing result notice in:\n%s", out)
+	}
+}
+
+func TestParseRenderers_StdoutAndFile(t *testing.T) {
+	var stdout bytes.Buffer
+	mdPath := filepath.Join(t.TempDir(), "run.md")
+	r, err := ParseRenderers("raw, markdown:"+mdPath, &stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderAll(t, r)
+	if stdout.String() != renderFixture {
+		t.Fatalf("raw renderer should pass lines through unchanged:\n%s", stdout.String())
+	}
+	b, err := os.ReadFile(mdPath)
+	if err != nil || !strings.Contains(string(b), "### Result") {
+		t.Fatalf("markdown file not written: %v\n%s", err, b)
+	}
+
+	r, err = ParseRenderers("concise,markdown:"+mdPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := r.(multiRenderer); !ok || len(m) != 1 {
+		t.Fatalf("expected only the file renderer without stdout, got %#v", r)
+	}
+	_ = r.Close()
+
+	if _, err := ParseRenderers("bogus", &stdout); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+
+	r, err = ParseRenderersFor("markdown:"+mdPath, nil, func(p string) string { return p + ".task-1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+	if _, err := os.Stat(mdPath + ".task-1"); err != nil {
+		t.Fatalf("expected the mapped path to be written: %v", err)
+	}
+}
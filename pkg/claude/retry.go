@@ -0,0 +1,175 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Reasons a failed run is considered transient.
+const (
+	ReasonOverloaded  = "overloaded"
+	ReasonRateLimited = "rate_limited"
+	ReasonServerError = "server_error"
+	ReasonNetwork     = "network"
+)
+
+// ResultError is a run whose result event reports an error although the
+// process itself succeeded (the CLI exits 0 on some API errors).
+type ResultError struct {
+	Subtype string
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("claude result %s: %s", e.Subtype, lastLine(e.Message))
+}
+
+// Markers matched case-insensitively against the CLI's stderr and result
+// text. Permanent markers win: a bad key is not fixed by waiting.
+var (
+	permanentMarkers = []string{
+		"invalid api key", "invalid x-api-key", "authentication_error", "permission_error",
+		"credit balance is too low", "invalid_request_error", "please run /login",
+	}
+	transientMarkers = []struct{ marker, reason string }{
+		{"overloaded", ReasonOverloaded},
+		{"rate_limit", ReasonRateLimited},
+		{"rate limit", ReasonRateLimited},
+		{"too many requests", ReasonRateLimited},
+		{"api_error", ReasonServerError},
+		{"internal server error", ReasonServerError},
+		{"bad gateway", ReasonServerError},
+		{"service unavailable", ReasonServerError},
+		{"gateway timeout", ReasonServerError},
+		{"econnreset", ReasonNetwork},
+		{"econnrefused", ReasonNetwork},
+		{"etimedout", ReasonNetwork},
+		{"enotfound", ReasonNetwork},
+		{"eai_again", ReasonNetwork},
+		{"socket hang up", ReasonNetwork},
+		{"connection reset", ReasonNetwork},
+		{"connection error", ReasonNetwork},
+		{"network error", ReasonNetwork},
+		{"fetch failed", ReasonNetwork},
+	}
+	// The CLI reports API failures as "API Error: 529 {...}".
+	apiStatusPattern = regexp.MustCompile(`(?i)api error:?\s*(\d{3})\b`)
+)
+
+// Transient reports whether a failed run is worth retrying and why. err is
+// what the backend returned and result the run's result event (nil when
+// none arrived); a result with is_error counts as a failure on its own.
+// Cancellation, limits, a missing CLI and unknown sessions are never
+// transient.
+func Transient(err error, result *Event) (reason string, ok bool) {
+	var limit *LimitError
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)),
+		errors.As(err, &limit), errors.Is(err, ErrCLINotFound), IsSessionNotFound(err):
+		return "", false
+	}
+	if result != nil && result.Subtype == "error_max_turns" {
+		return "", false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if r := reasonForStatus(apiErr.StatusCode); r != "" {
+			return r, true
+		}
+		return reasonForText(apiErr.Type + " " + apiErr.Message)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return ReasonNetwork, true
+	}
+
+	var text []string
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		text = append(text, exitErr.Stderr)
+	}
+	var resErr *ResultError
+	if errors.As(err, &resErr) {
+		text = append(text, resErr.Message)
+	}
+	if result != nil && result.Result != nil && result.Result.IsError {
+		text = append(text, result.Result.Result)
+	}
+	if len(text) == 0 {
+		return "", false
+	}
+	return reasonForText(strings.Join(text, "\n"))
+}
+
+func reasonForText(s string) (string, bool) {
+	s = strings.ToLower(s)
+	for _, m := range permanentMarkers {
+		if strings.Contains(s, m) {
+			return "", false
+		}
+	}
+	if m := apiStatusPattern.FindStringSubmatch(s); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		if r := reasonForStatus(code); r != "" {
+			return r, true
+		}
+	}
+	for _, m := range transientMarkers {
+		if strings.Contains(s, m.marker) {
+			return m.reason, true
+		}
+	}
+	return "", false
+}
+
+func reasonForStatus(code int) string {
+	switch {
+	case code == 529:
+		return ReasonOverloaded
+	case code == 429:
+		return ReasonRateLimited
+	case code == 408:
+		return ReasonNetwork
+	case code >= 500 && code <= 599:
+		return ReasonServerError
+	}
+	return ""
+}
+
+// RetryPolicy bounds retries of transient failures. Delays grow
+// exponentially from BaseDelay up to MaxDelay, with jitter.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt; 0
+	// disables retrying.
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Backoff is the delay before retry n (1-based): a random duration between
+// half and all of BaseDelay*2^(n-1), capped at MaxDelay.
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	d := p.BaseDelay
+	if d <= 0 {
+		return 0
+	}
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
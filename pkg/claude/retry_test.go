@@ -0,0 +1,58 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTransient(t *testing.T) {
+	errResult := func(subtype, text string) *Event {
+		return &Event{Type: TypeResult, Subtype: subtype, Result: &Result{IsError: true, Result: text}}
+	}
+	cases := []struct {
+		name   string
+		err    error
+		result *Event
+		reason string
+	}{
+		{"cli overloaded", &ExitError{Err: errors.New("exit status 1"), Stderr: `API Error: 529 {"type":"overloaded_error"}`}, nil, ReasonOverloaded},
+		{"cli rate limited", &ExitError{Err: errors.New("exit status 1"), Stderr: "Rate limit reached"}, nil, ReasonRateLimited},
+		{"cli network", &ExitError{Err: errors.New("exit status 1"), Stderr: "Error: read ECONNRESET"}, nil, ReasonNetwork},
+		{"cli server error", &ExitError{Err: errors.New("exit status 1"), Stderr: "API Error: 500 Internal server error"}, nil, ReasonServerError},
+		{"error result", nil, errResult("success", "API Error: 529 Overloaded"), ReasonOverloaded},
+		{"api 429", &APIError{StatusCode: 429, Type: "rate_limit_error"}, nil, ReasonRateLimited},
+		{"api 503", fmt.Errorf("turn 2: %w", &APIError{StatusCode: 503}), nil, ReasonServerError},
+		{"invalid key", &ExitError{Err: errors.New("exit status 1"), Stderr: "Invalid API key · Please run /login"}, nil, ""},
+		{"api 401", &APIError{StatusCode: 401, Type: "authentication_error"}, nil, ""},
+		{"auth error with 5xx text", &ExitError{Stderr: "API Error: 401 authentication_error (retry after 500ms)"}, nil, ""},
+		{"plain failure", &ExitError{Err: errors.New("exit status 3"), Stderr: "boom"}, nil, ""},
+		{"max turns", nil, errResult("error_max_turns", "overloaded"), ""},
+		{"successful result", nil, &Event{Type: TypeResult, Result: &Result{Result: "The server was overloaded"}}, ""},
+		{"cancelled", fmt.Errorf("run: %w", context.Canceled), nil, ""},
+		{"limit", &LimitError{Kind: LimitTurns}, nil, ""},
+		{"cli missing", ErrCLINotFound, nil, ""},
+	}
+	for _, c := range cases {
+		reason, ok := Transient(c.err, c.result)
+		if reason != c.reason || ok != (c.reason != "") {
+			t.Errorf("%s: got (%q, %v), want %q", c.name, reason, ok, c.reason)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := p.Backoff(n); d < want/2 || d > want {
+				t.Fatalf("Backoff(%d) = %s, want within [%s, %s]", n, d, want/2, want)
+			}
+		}
+	}
+	if d := (RetryPolicy{}).Backoff(3); d != 0 {
+		t.Fatalf("zero policy should not wait, got %s", d)
+	}
+}
@@ -0,0 +1,37 @@
+package claude
+
+// Stats summarises a finished run: token usage, cost, turns and timing as
+// reported by the final `result` event.
+type Stats struct {
+	InputTokens         int64
+	OutputTokens        int64
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+	CostUSD             float64
+	NumTurns            int
+	DurationMS          int64
+	DurationAPIMS       int64
+	IsError             bool
+}
+
+// StatsFromResult extracts Stats from a result event. ok is false for any other event.
+func StatsFromResult(ev Event) (s Stats, ok bool) {
+	if ev.Type != TypeResult || ev.Result == nil {
+		return Stats{}, false
+	}
+	r := ev.Result
+	s = Stats{
+		CostUSD:       r.TotalCostUSD,
+		NumTurns:      r.NumTurns,
+		DurationMS:    r.DurationMS,
+		DurationAPIMS: r.DurationAPIMS,
+		IsError:       r.IsError,
+	}
+	if u := r.Usage; u != nil {
+		s.InputTokens = u.InputTokens
+		s.OutputTokens = u.OutputTokens
+		s.CacheCreationTokens = u.CacheCreationInputTokens
+		s.CacheReadTokens = u.CacheReadInputTokens
+	}
+	return s, true
+}
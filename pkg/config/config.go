@@ -20,6 +20,7 @@ type Config struct {
 	PromptFilenameRef          string
 	TaskMode                   string
 	TaskID                     string
+	ResumeSessionID            string
 	ToolWhitelistPath          string
 	ProcessedToolWhitelistPath string
 	ExternalMCPConfigPath      string
@@ -45,6 +46,7 @@ func LoadFromDir(baseDir string) (*Config, error) {
 	cfg.PromptFilenameRef = optionalFile(baseDir, "prompt_filename.txt")
 	cfg.TaskMode = readTrim(optionalFile(baseDir, "task_mode.txt"))
 	cfg.TaskID = readTrim(optionalFile(baseDir, "task_id.txt"))
+	cfg.ResumeSessionID = readTrim(optionalFile(baseDir, "resume_session_id.txt"))
 	cfg.ToolWhitelistPath = optionalFile(baseDir, "tool_whitelist.txt")
 	cfg.ProcessedToolWhitelistPath = optionalFile(baseDir, "processed_tool_whitelist.txt")
 	cfg.ExternalMCPConfigPath = optionalFile(baseDir, "external_mcp.txt")
@@ -0,0 +1,260 @@
+// Package fakeclaude is a stand-in for the `claude` CLI used by end-to-end
+// worker tests. It accepts the same flags as `claude --print`, replays a
+// scripted stream-json fixture, can perform tool side effects such as
+// writing files, and records every invocation it receives.
+//
+// Tests use it by calling RunIfRequested from TestMain and Setup from each
+// test; Setup puts a `claude` symlink to the test binary first on PATH.
+// cmd/fakeclaude wraps Main for use outside of `go test`.
+package fakeclaude
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Environment variables read by the fake.
+const (
+	// EnvScript points at a JSON Script, or a JSON array of Scripts where the
+	// n-th invocation uses the n-th entry (the last entry repeats).
+	EnvScript = "FAKECLAUDE_SCRIPT"
+	// EnvRecord is a JSONL file that receives one Invocation per run.
+	EnvRecord = "FAKECLAUDE_RECORD"
+	// EnvActive makes a test binary behave as the fake (see RunIfRequested).
+	EnvActive = "FAKECLAUDE_ACTIVE"
+)
+
+// Script describes what one fake run does.
+type Script struct {
+	Steps    []Step `json:"steps"`
+	ExitCode int    `json:"exitCode,omitempty"`
+}
+
+// Step is one action of a Script; exactly one field is expected to be set.
+type Step struct {
+	// Event is written to stdout as a single stream-json line.
+	Event json.RawMessage `json:"event,omitempty"`
+	// Line is written to stdout verbatim (useful for malformed output).
+	Line string `json:"line,omitempty"`
+	// Stderr is written to stderr followed by a newline.
+	Stderr string `json:"stderr,omitempty"`
+	// WriteFile simulates a Write tool call; Path is relative to the working directory.
+	WriteFile *FileWrite `json:"writeFile,omitempty"`
+	SleepMS   int        `json:"sleepMs,omitempty"`
+}
+
+type FileWrite struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Invocation is what the fake received.
+type Invocation struct {
+	Args            []string        `json:"args"`
+	Dir             string          `json:"dir"`
+	Print           bool            `json:"print"`
+	OutputFormat    string          `json:"outputFormat,omitempty"`
+	Verbose         bool            `json:"verbose,omitempty"`
+	PermissionMode  string          `json:"permissionMode,omitempty"`
+	AllowedTools    []string        `json:"allowedTools,omitempty"`
+	DisallowedTools []string        `json:"disallowedTools,omitempty"`
+	MCPConfig       []string        `json:"mcpConfig,omitempty"`
+	MCPConfigJSON   json.RawMessage `json:"mcpConfigJson,omitempty"`
+	Resume          string          `json:"resume,omitempty"`
+	Model           string          `json:"model,omitempty"`
+	MaxTurns        int             `json:"maxTurns,omitempty"`
+	Prompt          string          `json:"prompt,omitempty"`
+}
+
+// Parse interprets claude CLI arguments.
+func Parse(args []string) (Invocation, error) {
+	inv := Invocation{Args: append([]string(nil), args...)}
+	fs := pflag.NewFlagSet("claude", pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVarP(&inv.Print, "print", "p", false, "")
+	fs.StringVar(&inv.OutputFormat, "output-format", "text", "")
+	fs.BoolVar(&inv.Verbose, "verbose", false, "")
+	fs.StringVar(&inv.PermissionMode, "permission-mode", "", "")
+	allowed := fs.StringSlice("allowedTools", nil, "")
+	disallowed := fs.StringSlice("disallowedTools", nil, "")
+	fs.StringSliceVar(&inv.MCPConfig, "mcp-config", nil, "")
+	fs.StringVarP(&inv.Resume, "resume", "r", "", "")
+	fs.StringVar(&inv.Model, "model", "", "")
+	fs.IntVar(&inv.MaxTurns, "max-turns", 0, "")
+	fs.String("append-system-prompt", "", "")
+	fs.String("input-format", "text", "")
+	fs.StringSlice("add-dir", nil, "")
+	fs.Bool("dangerously-skip-permissions", false, "")
+	if err := fs.Parse(args); err != nil {
+		return inv, err
+	}
+	inv.AllowedTools = *allowed
+	inv.DisallowedTools = *disallowed
+	inv.Prompt = strings.Join(fs.Args(), " ")
+	inv.Dir, _ = os.Getwd()
+	if len(inv.MCPConfig) > 0 {
+		if b, err := os.ReadFile(inv.MCPConfig[0]); err == nil && json.Valid(b) {
+			inv.MCPConfigJSON = b
+		}
+	}
+	return inv, nil
+}
+
+// Main runs the fake with CLI arguments and returns the process exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	inv, err := Parse(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+	n, err := record(inv)
+	if err != nil {
+		fmt.Fprintf(stderr, "fakeclaude: record: %v\n", err)
+		return 1
+	}
+	if inv.Print && inv.OutputFormat == "stream-json" && !inv.Verbose {
+		fmt.Fprintln(stderr, "Error: When using --print, --output-format=stream-json requires --verbose")
+		return 1
+	}
+	if inv.Prompt == "" {
+		fmt.Fprintln(stderr, "Error: Input must be provided either through stdin or as a prompt argument when using --print")
+		return 1
+	}
+	script, err := loadScript(n)
+	if err != nil {
+		fmt.Fprintf(stderr, "fakeclaude: script: %v\n", err)
+		return 1
+	}
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	for _, st := range script.Steps {
+		switch {
+		case len(st.Event) > 0:
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, st.Event); err != nil {
+				fmt.Fprintf(stderr, "fakeclaude: bad event: %v\n", err)
+				return 1
+			}
+			out.Write(compact.Bytes())
+			out.WriteByte('\n')
+		case st.Line != "":
+			out.WriteString(st.Line + "\n")
+		case st.Stderr != "":
+			fmt.Fprintln(stderr, st.Stderr)
+		case st.WriteFile != nil:
+			p := st.WriteFile.Path
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(inv.Dir, p)
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err == nil {
+				_ = os.WriteFile(p, []byte(st.WriteFile.Content), 0o644)
+			}
+		case st.SleepMS > 0:
+			out.Flush()
+			time.Sleep(time.Duration(st.SleepMS) * time.Millisecond)
+		}
+		out.Flush()
+	}
+	return script.ExitCode
+}
+
+// record appends inv to the record file and returns the zero-based index of this invocation.
+func record(inv Invocation) (int, error) {
+	path := os.Getenv(EnvRecord)
+	if path == "" {
+		return 0, nil
+	}
+	prev, err := ReadInvocations(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return len(prev), err
+}
+
+func loadScript(n int) (Script, error) {
+	path := os.Getenv(EnvScript)
+	if path == "" {
+		return DefaultScript("fake-session"), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, err
+	}
+	var many []Script
+	if json.Unmarshal(b, &many) == nil {
+		if len(many) == 0 {
+			return Script{}, errors.New("empty script list")
+		}
+		if n >= len(many) {
+			n = len(many) - 1
+		}
+		return many[n], nil
+	}
+	var one Script
+	if err := json.Unmarshal(b, &one); err != nil {
+		return Script{}, err
+	}
+	return one, nil
+}
+
+// ReadInvocations returns the invocations recorded at path, oldest first.
+func ReadInvocations(path string) ([]Invocation, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []Invocation
+	for _, ln := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(ln)) == 0 {
+			continue
+		}
+		var inv Invocation
+		if err := json.Unmarshal(ln, &inv); err != nil {
+			return nil, err
+		}
+		out = append(out, inv)
+	}
+	return out, nil
+}
+
+// DefaultScript is a successful one-turn run with the given session ID.
+func DefaultScript(sessionID string) Script {
+	return Script{Steps: []Step{
+		{Event: Event(map[string]any{"type": "system", "subtype": "init", "session_id": sessionID, "model": "fake", "tools": []string{"Read"}})},
+		{Event: Event(map[string]any{"type": "assistant", "session_id": sessionID, "message": map[string]any{
+			"role": "assistant", "content": []any{map[string]any{"type": "text", "text": "ok"}},
+		}})},
+		{Event: Event(map[string]any{"type": "result", "subtype": "success", "session_id": sessionID, "is_error": false,
+			"num_turns": 1, "duration_ms": 10, "total_cost_usd": 0.01, "result": "ok",
+			"usage": map[string]any{"input_tokens": 10, "output_tokens": 5}})},
+	}}
+}
+
+// Event marshals v for use as Step.Event; it panics on values that cannot be encoded.
+func Event(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+package fakeclaude
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// RunIfRequested turns the current process into the fake when EnvActive is
+// set. Call it first thing in TestMain so Setup can re-exec the test binary
+// as `claude`.
+func RunIfRequested() {
+	if os.Getenv(EnvActive) != "1" {
+		return
+	}
+	os.Exit(Main(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Setup installs the fake as `claude` on PATH for the duration of t, using
+// the given scripts (one per invocation, the last repeating). It returns the
+// path of the invocation record file.
+func Setup(t testing.TB, scripts ...Script) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("fakeclaude: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(dir, "claude")); err != nil {
+		t.Fatalf("fakeclaude: %v", err)
+	}
+	if len(scripts) == 0 {
+		scripts = []Script{DefaultScript("fake-session")}
+	}
+	b, err := json.Marshal(scripts)
+	if err != nil {
+		t.Fatalf("fakeclaude: %v", err)
+	}
+	scriptPath := filepath.Join(dir, "script.json")
+	if err := os.WriteFile(scriptPath, b, 0o644); err != nil {
+		t.Fatalf("fakeclaude: %v", err)
+	}
+	recordPath := filepath.Join(dir, "invocations.jsonl")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv(EnvActive, "1")
+	t.Setenv(EnvScript, scriptPath)
+	t.Setenv(EnvRecord, recordPath)
+	return recordPath
+}
+
+// Invocations reads the record file returned by Setup.
+func Invocations(t testing.TB, recordPath string) []Invocation {
+	t.Helper()
+	invs, err := ReadInvocations(recordPath)
+	if err != nil {
+		t.Fatalf("fakeclaude: read invocations: %v", err)
+	}
+	return invs
+}
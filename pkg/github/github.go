@@ -1,6 +1,306 @@
+// Package github is a small client for the GitHub REST API calls the worker
+// makes after a run (comments, reviews, pull requests).
 package github
 
-// Placeholder for GitHub integration helpers.
-type Client struct{}
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
 
-func NewClient() *Client { return &Client{} }
+// Client calls the GitHub REST API with a token.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		BaseURL:    "https://api.github.com",
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// NewClientFromEnv uses GITHUB_TOKEN (or GH_TOKEN) and, for GitHub
+// Enterprise, GITHUB_API_URL.
+func NewClientFromEnv() *Client {
+	tok := os.Getenv("GITHUB_TOKEN")
+	if tok == "" {
+		tok = os.Getenv("GH_TOKEN")
+	}
+	c := NewClient(tok)
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		c.BaseURL = u
+	}
+	return c
+}
+
+// APIError is a non-2xx response.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github api: %d: %s", e.StatusCode, e.Message)
+}
+
+// Comment is an issue, PR or review comment.
+type Comment struct {
+	ID      int64  `json:"id"`
+	HTMLURL string `json:"html_url"`
+	Body    string `json:"body"`
+}
+
+// Review events accepted by CreateReview.
+const (
+	EventComment        = "COMMENT"
+	EventApprove        = "APPROVE"
+	EventRequestChanges = "REQUEST_CHANGES"
+)
+
+// ReviewComment is an inline comment of a review, anchored to a line of the
+// PR's diff (RIGHT is the new version of the file).
+type ReviewComment struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	StartLine int    `json:"start_line,omitempty"`
+	Side      string `json:"side,omitempty"`
+	Body      string `json:"body"`
+}
+
+// ReviewRequest is the body of a new PR review.
+type ReviewRequest struct {
+	Body     string          `json:"body"`
+	Event    string          `json:"event"`
+	CommitID string          `json:"commit_id,omitempty"`
+	Comments []ReviewComment `json:"comments,omitempty"`
+}
+
+// Review is a submitted PR review.
+type Review struct {
+	ID      int64  `json:"id"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+}
+
+// CreateIssueComment comments on an issue or PR. repo is owner/name.
+func (c *Client) CreateIssueComment(ctx context.Context, repo string, number int, body string) (*Comment, error) {
+	var out Comment
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number)
+	if err := c.do(ctx, http.MethodPost, path, map[string]string{"body": body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReplyToReviewComment answers in the thread of review comment commentID.
+func (c *Client) ReplyToReviewComment(ctx context.Context, repo string, number int, commentID int64, body string) (*Comment, error) {
+	var out Comment
+	path := fmt.Sprintf("/repos/%s/pulls/%d/comments/%d/replies", repo, number, commentID)
+	if err := c.do(ctx, http.MethodPost, path, map[string]string{"body": body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateReview submits a review on PR number.
+func (c *Client) CreateReview(ctx context.Context, repo string, number int, r ReviewRequest) (*Review, error) {
+	var out Review
+	path := fmt.Sprintf("/repos/%s/pulls/%d/reviews", repo, number)
+	if err := c.do(ctx, http.MethodPost, path, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Repository is the part of a repository the worker reads.
+type Repository struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// GetRepository fetches repo (owner/name).
+func (c *Client) GetRepository(ctx context.Context, repo string) (*Repository, error) {
+	var out Repository
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repo, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Branch is a branch of a repository.
+type Branch struct {
+	Name      string `json:"name"`
+	Protected bool   `json:"protected"`
+}
+
+// GetBranch fetches branch of repo; a missing branch is a 404 APIError.
+func (c *Client) GetBranch(ctx context.Context, repo, branch string) (*Branch, error) {
+	var out Branch
+	path := fmt.Sprintf("/repos/%s/branches/%s", repo, url.PathEscape(branch))
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PullRef is the head or base of a pull request.
+type PullRef struct {
+	Ref  string      `json:"ref"`
+	SHA  string      `json:"sha"`
+	Repo *Repository `json:"repo"`
+}
+
+// PullRequest is the part of a pull request the worker reads.
+type PullRequest struct {
+	Number  int     `json:"number"`
+	HTMLURL string  `json:"html_url"`
+	State   string  `json:"state"`
+	Title   string  `json:"title"`
+	Head    PullRef `json:"head"`
+	Base    PullRef `json:"base"`
+}
+
+// NewPullRequest is the body of a pull request to open. Head is a branch of
+// the same repo.
+type NewPullRequest struct {
+	Title string `json:"title"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	Body  string `json:"body,omitempty"`
+	Draft bool   `json:"draft,omitempty"`
+}
+
+// PullRequestUpdate changes the title or body of a pull request; empty
+// fields are left alone.
+type PullRequestUpdate struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// GetPullRequest fetches PR number.
+func (c *Client) GetPullRequest(ctx context.Context, repo string, number int) (*PullRequest, error) {
+	var out PullRequest
+	path := fmt.Sprintf("/repos/%s/pulls/%d", repo, number)
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PullRequestFiles lists the paths PR number changes, up to the 3000 the
+// API returns.
+func (c *Client) PullRequestFiles(ctx context.Context, repo string, number int) ([]string, error) {
+	var files []string
+	for page := 1; page <= 30; page++ {
+		var out []struct {
+			Filename string `json:"filename"`
+		}
+		path := fmt.Sprintf("/repos/%s/pulls/%d/files?per_page=100&page=%d", repo, number, page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+			return nil, err
+		}
+		for _, f := range out {
+			files = append(files, f.Filename)
+		}
+		if len(out) < 100 {
+			break
+		}
+	}
+	return files, nil
+}
+
+// OpenPullRequests lists the open PRs of repo whose head is branch of the
+// same repo.
+func (c *Client) OpenPullRequests(ctx context.Context, repo, branch string) ([]PullRequest, error) {
+	owner, _, _ := strings.Cut(repo, "/")
+	var out []PullRequest
+	path := fmt.Sprintf("/repos/%s/pulls?state=open&head=%s", repo, url.QueryEscape(owner+":"+branch))
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreatePullRequest opens a pull request.
+func (c *Client) CreatePullRequest(ctx context.Context, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var out PullRequest
+	if err := c.do(ctx, http.MethodPost, "/repos/"+repo+"/pulls", pr, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdatePullRequest edits PR number.
+func (c *Client) UpdatePullRequest(ctx context.Context, repo string, number int, u PullRequestUpdate) (*PullRequest, error) {
+	var out PullRequest
+	path := fmt.Sprintf("/repos/%s/pulls/%d", repo, number)
+	if err := c.do(ctx, http.MethodPatch, path, u, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	base := strings.TrimRight(c.BaseURL, "/")
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("accept", "application/vnd.github+json")
+	req.Header.Set("x-github-api-version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("content-type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	rb, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 != 2 {
+		apiErr := &APIError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(rb))}
+		var env struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(rb, &env) == nil && env.Message != "" {
+			apiErr.Message = env.Message
+		}
+		return apiErr
+	}
+	if out == nil || len(bytes.TrimSpace(rb)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rb, out)
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_CreateReview(t *testing.T) {
+	var got ReviewRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/org/app/pulls/7/reviews" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("authorization") != "Bearer tok" {
+			t.Errorf("missing token: %q", r.Header.Get("authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"id":5,"html_url":"https://github.com/org/app/pull/7#r5","state":"COMMENTED"}`))
+	}))
+	defer srv.Close()
+	c := NewClient("tok")
+	c.BaseURL = srv.URL
+
+	rv, err := c.CreateReview(context.Background(), "org/app", 7, ReviewRequest{Body: "looks good", Event: EventComment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv.ID != 5 || got.Body != "looks good" || got.Event != EventComment {
+		t.Fatalf("unexpected review %+v / request %+v", rv, got)
+	}
+}
+
+func TestClient_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"Validation Failed"}`))
+	}))
+	defer srv.Close()
+	c := NewClient("tok")
+	c.BaseURL = srv.URL
+
+	_, err := c.CreateIssueComment(context.Background(), "org/app", 7, "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 422 || apiErr.Message != "Validation Failed" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClient_OpenPullRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/app/pulls" || r.URL.Query().Get("head") != "org:claude/t-1" || r.URL.Query().Get("state") != "open" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`[{"number":4,"html_url":"https://github.com/org/app/pull/4","head":{"ref":"claude/t-1","repo":{"full_name":"org/app"}}}]`))
+	}))
+	defer srv.Close()
+	c := NewClient("tok")
+	c.BaseURL = srv.URL
+
+	prs, err := c.OpenPullRequests(context.Background(), "org/app", "claude/t-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prs) != 1 || prs[0].Number != 4 || prs[0].Head.Repo.FullName != "org/app" {
+		t.Fatalf("unexpected PRs: %+v", prs)
+	}
+}
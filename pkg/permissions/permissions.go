@@ -11,10 +11,14 @@ type Settings struct {
 
 // Generate writes a minimal .claude/settings.local.json-equivalent structure based on tool whitelist.
 func Generate(outputPath string, tools []string) error {
-	s := Settings{Tools: tools}
-	b, err := json.MarshalIndent(s, "", "  ")
+	b, err := Render(tools)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(outputPath, b, 0o644)
 }
+
+// Render returns what Generate writes for tools.
+func Render(tools []string) ([]byte, error) {
+	return json.MarshalIndent(Settings{Tools: tools}, "", "  ")
+}
@@ -0,0 +1,195 @@
+// Package prompt renders task prompts from Go text/templates. Templates see
+// the task's variables (Vars) and can include one another; a library of
+// built-in templates is embedded and can be overridden or extended from
+// directories of *.tmpl files.
+package prompt
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var builtin embed.FS
+
+// Ext is the extension of template files.
+const Ext = ".tmpl"
+
+// Vars are what a prompt template can use. Referring to anything else is an
+// error, so a typo fails the task instead of reaching Claude.
+type Vars struct {
+	TaskID string
+	// Mode is the task mode (review, fix, ask, resume or create).
+	Mode     string
+	Repo     string
+	PRNumber int
+	PRURL    string
+	// HeadRef and BaseRef are the PR's branches; HeadRef is the task's
+	// branch when there is no PR.
+	HeadRef string
+	BaseRef string
+	HeadSHA string
+	// ChangedFiles are the paths the PR changes.
+	ChangedFiles []string
+	// Prompt is the task's own prompt text, e.g. extra instructions.
+	Prompt string
+}
+
+// Library is a set of named templates: the built-ins, then the *.tmpl
+// files of each directory given to Load. A template is named by its path
+// relative to its directory without the extension, e.g. "review" or
+// "partials/pr-context".
+type Library struct {
+	t *template.Template
+}
+
+// Load parses the built-in templates and then dirs, in order; a later
+// template replaces an earlier one with the same name. Missing dirs are
+// skipped.
+func Load(dirs ...string) (*Library, error) {
+	l := &Library{t: newTemplate("")}
+	if err := l.parseFS(builtin, "templates"); err != nil {
+		return nil, fmt.Errorf("built-in templates: %w", err)
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+			continue
+		}
+		if err := l.parseFS(os.DirFS(dir), "."); err != nil {
+			return nil, fmt.Errorf("templates in %s: %w", dir, err)
+		}
+	}
+	return l, nil
+}
+
+func (l *Library) parseFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, Ext) {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		name := strings.TrimSuffix(rel, Ext)
+		if _, err := l.t.New(name).Parse(string(b)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Names lists the templates of the library.
+func (l *Library) Names() []string {
+	var names []string
+	for _, t := range l.t.Templates() {
+		if t.Name() != "" && t.Tree != nil {
+			names = append(names, t.Name())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Has reports whether the library has template name (with or without the
+// extension).
+func (l *Library) Has(name string) bool {
+	t := l.t.Lookup(strings.TrimSuffix(name, Ext))
+	return t != nil && t.Tree != nil
+}
+
+// Render executes library template name (with or without the extension).
+func (l *Library) Render(name string, v Vars) (string, error) {
+	name = strings.TrimSuffix(name, Ext)
+	if !l.Has(name) {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+	t, err := l.t.Clone()
+	if err != nil {
+		return "", err
+	}
+	return execute(t, name, v)
+}
+
+// RenderText parses src as a template that can include the library's
+// templates and executes it.
+func (l *Library) RenderText(src string, v Vars) (string, error) {
+	t, err := l.t.Clone()
+	if err != nil {
+		return "", err
+	}
+	if _, err := t.New("prompt").Parse(src); err != nil {
+		return "", err
+	}
+	return execute(t, "prompt", v)
+}
+
+// blankLines are runs of blank lines, left behind by empty partials.
+var blankLines = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+\n`)
+
+// execute runs name of t, a clone of the library so that include sees the
+// templates of the set it runs in. Runs of blank lines are collapsed to one.
+func execute(t *template.Template, name string, v Vars) (string, error) {
+	t.Funcs(template.FuncMap{"include": includeFunc(t)})
+	var b strings.Builder
+	if err := t.ExecuteTemplate(&b, name, v); err != nil {
+		return "", err
+	}
+	out := strings.TrimSpace(blankLines.ReplaceAllString(b.String(), "\n\n"))
+	if out == "" {
+		return "", errors.New("prompt template rendered an empty prompt")
+	}
+	return out + "\n", nil
+}
+
+func newTemplate(name string) *template.Template {
+	return template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"include": includeFunc(nil),
+		"indent":  indent,
+		"join":    func(sep string, v []string) string { return strings.Join(v, sep) },
+		"trim":    strings.TrimSpace,
+	})
+}
+
+// includeFunc returns the include function of set t: like the template
+// action, but its output is a string that can be piped, e.g. to indent.
+func includeFunc(t *template.Template) func(string, any) (string, error) {
+	return func(name string, data any) (string, error) {
+		if t == nil {
+			return "", errors.New("include outside of a library")
+		}
+		var b strings.Builder
+		if err := t.ExecuteTemplate(&b, name, data); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+}
+
+// indent prefixes every non-empty line of s with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IsTemplateName reports whether a prompt file name refers to a template.
+func IsTemplateName(name string) bool {
+	return strings.HasSuffix(strings.TrimSpace(name), Ext)
+}
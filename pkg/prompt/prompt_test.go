@@ -0,0 +1,97 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var vars = Vars{
+	TaskID:       "pr-7",
+	Mode:         "review",
+	Repo:         "org/app",
+	PRNumber:     7,
+	PRURL:        "https://github.com/org/app/pull/7",
+	HeadRef:      "feature",
+	BaseRef:      "main",
+	ChangedFiles: []string{"a.go", "b.go"},
+	Prompt:       "Focus on error handling.",
+}
+
+func TestLibrary_BuiltinReview(t *testing.T) {
+	l, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(l.Names(), "review") || !slices.Contains(l.Names(), "partials/pr-context") {
+		t.Fatalf("missing built-ins: %v", l.Names())
+	}
+	out, err := l.Render("review.tmpl", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Pull request: #7 (https://github.com/org/app/pull/7)", "Branch: feature into main", "- b.go", "gh pr diff 7", "Focus on error handling."} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestLibrary_OverridesAndIncludes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "partials"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"partials/pr-context.tmpl": "PR {{.Repo}}#{{.PRNumber}}",
+		"team.tmpl":                "Team rules for {{.Mode}}:\n{{include \"partials/pr-context\" . | indent 2}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err := Load(dir, filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := l.Render("team", vars); err != nil || out != "Team rules for review:\n  PR org/app#7\n" {
+		t.Fatalf("unexpected render %q: %v", out, err)
+	}
+	// The built-in review uses the overridden partial
+	if out, err := l.Render("review", vars); err != nil || !strings.Contains(out, "PR org/app#7") {
+		t.Fatalf("override not used: %q %v", out, err)
+	}
+	out, err := l.RenderText(`{{template "team" .}} / {{join ", " .ChangedFiles}}`, vars)
+	if err != nil || out != "Team rules for review:\n  PR org/app#7 / a.go, b.go\n" {
+		t.Fatalf("unexpected text render %q: %v", out, err)
+	}
+}
+
+func TestLibrary_Errors(t *testing.T) {
+	l, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.RenderText("Review {{.Repository}}", vars); err == nil || !strings.Contains(err.Error(), "Repository") {
+		t.Fatalf("expected an unknown variable to fail, got %v", err)
+	}
+	if _, err := l.RenderText(`{{template "nope" .}}`, vars); err == nil {
+		t.Fatal("expected an unknown include to fail")
+	}
+	if _, err := l.Render("nope", vars); err == nil {
+		t.Fatal("expected an unknown template to fail")
+	}
+	if _, err := l.RenderText("{{if .Prompt}}{{end}}", Vars{}); err == nil {
+		t.Fatal("expected an empty prompt to fail")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.tmpl"), []byte("{{.Repo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Fatal("expected a broken template to fail loading")
+	}
+}
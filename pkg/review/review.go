@@ -0,0 +1,192 @@
+// Package review defines the structured review document the worker asks
+// Claude to produce, and parses it out of free-form model output.
+package review
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Verdict string
+
+const (
+	VerdictApprove        Verdict = "approve"
+	VerdictComment        Verdict = "comment"
+	VerdictRequestChanges Verdict = "request_changes"
+)
+
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityHigh     Severity = "high"
+	SeverityMedium   Severity = "medium"
+	SeverityLow      Severity = "low"
+	SeverityInfo     Severity = "info"
+)
+
+// Categories are the finding categories Claude is asked to use. Anything
+// else is normalised to "other" rather than rejected.
+var Categories = []string{"correctness", "security", "performance", "tests", "maintainability", "style", "docs", "other"}
+
+// Finding is one issue tied to a file and line range.
+type Finding struct {
+	File         string   `json:"file"`
+	StartLine    int      `json:"startLine,omitempty"`
+	EndLine      int      `json:"endLine,omitempty"`
+	Severity     Severity `json:"severity"`
+	Category     string   `json:"category"`
+	Title        string   `json:"title"`
+	Body         string   `json:"body,omitempty"`
+	SuggestedFix string   `json:"suggestedFix,omitempty"`
+}
+
+// Review is the structured result of a PR review.
+type Review struct {
+	Summary  string    `json:"summary"`
+	Verdict  Verdict   `json:"verdict"`
+	Findings []Finding `json:"findings"`
+}
+
+// Instructions is appended to the prompt to request a Review document.
+const Instructions = `
+
+When you have finished reviewing, end your final message with the review as a single JSON document in a ` + "```json" + ` fenced block, exactly matching this schema:
+
+{
+  "summary": "2-5 sentence overall assessment",
+  "verdict": "approve" | "comment" | "request_changes",
+  "findings": [
+    {
+      "file": "path/relative/to/repo.go",
+      "startLine": 10,
+      "endLine": 12,
+      "severity": "critical" | "high" | "medium" | "low" | "info",
+      "category": "correctness" | "security" | "performance" | "tests" | "maintainability" | "style" | "docs" | "other",
+      "title": "one-line description",
+      "body": "explanation of the problem",
+      "suggestedFix": "concrete change, code if useful (optional)"
+    }
+  ]
+}
+
+Use an empty findings array when there is nothing to report. Line numbers refer to the new version of the file.`
+
+// RepairPrompt asks Claude to resend its review after Parse failed with err.
+func RepairPrompt(err error) string {
+	return fmt.Sprintf("Your previous reply did not contain a valid review document: %v\n\n"+
+		"Reply with only the corrected review JSON in a ```json fenced block, using the schema you were given. Do not repeat any other text.", err)
+}
+
+var fenceRE = regexp.MustCompile("(?s)```(?:json)?[ \t]*\n(.*?)\n?```")
+
+// Parse extracts and validates a Review from model output. The last fenced
+// JSON block wins; otherwise the outermost {...} span is tried.
+func Parse(text string) (*Review, error) {
+	var candidates []string
+	matches := fenceRE.FindAllStringSubmatch(text, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		candidates = append(candidates, matches[i][1])
+	}
+	if start, end := strings.Index(text, "{"), strings.LastIndex(text, "}"); start >= 0 && end > start {
+		candidates = append(candidates, text[start:end+1])
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no JSON object found in output")
+	}
+	var firstErr error
+	for _, c := range candidates {
+		var r Review
+		err := json.Unmarshal([]byte(strings.TrimSpace(c)), &r)
+		if err == nil {
+			err = r.Validate()
+		}
+		if err == nil {
+			return &r, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// Validate checks required fields and enumerations, normalising case and
+// unknown categories in place.
+func (r *Review) Validate() error {
+	var errs []error
+	if strings.TrimSpace(r.Summary) == "" {
+		errs = append(errs, errors.New("summary is required"))
+	}
+	r.Verdict = Verdict(strings.ToLower(strings.TrimSpace(string(r.Verdict))))
+	switch r.Verdict {
+	case VerdictApprove, VerdictComment, VerdictRequestChanges:
+	default:
+		errs = append(errs, fmt.Errorf("verdict %q must be approve, comment or request_changes", r.Verdict))
+	}
+	if r.Findings == nil {
+		r.Findings = []Finding{}
+	}
+	for i := range r.Findings {
+		f := &r.Findings[i]
+		f.Severity = Severity(strings.ToLower(strings.TrimSpace(string(f.Severity))))
+		switch f.Severity {
+		case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo:
+		default:
+			errs = append(errs, fmt.Errorf("findings[%d].severity %q is not one of critical, high, medium, low, info", i, f.Severity))
+		}
+		f.Category = strings.ToLower(strings.TrimSpace(f.Category))
+		if !knownCategory(f.Category) {
+			f.Category = "other"
+		}
+		if strings.TrimSpace(f.File) == "" {
+			errs = append(errs, fmt.Errorf("findings[%d].file is required", i))
+		}
+		if strings.TrimSpace(f.Title) == "" {
+			errs = append(errs, fmt.Errorf("findings[%d].title is required", i))
+		}
+		if f.StartLine < 0 || (f.EndLine != 0 && f.EndLine < f.StartLine) {
+			errs = append(errs, fmt.Errorf("findings[%d] has an invalid line range %d-%d", i, f.StartLine, f.EndLine))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Markdown renders the review as a GitHub comment body.
+func (r *Review) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Verdict:** %s\n\n%s\n", strings.ReplaceAll(string(r.Verdict), "_", " "), strings.TrimSpace(r.Summary))
+	if len(r.Findings) == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\n**Findings (%d)**\n", len(r.Findings))
+	for _, f := range r.Findings {
+		loc := f.File
+		switch {
+		case f.StartLine > 0 && f.EndLine > f.StartLine:
+			loc = fmt.Sprintf("%s:%d-%d", f.File, f.StartLine, f.EndLine)
+		case f.StartLine > 0:
+			loc = fmt.Sprintf("%s:%d", f.File, f.StartLine)
+		}
+		fmt.Fprintf(&b, "\n- **%s** `%s` (%s): %s\n", f.Severity, loc, f.Category, f.Title)
+		if body := strings.TrimSpace(f.Body); body != "" {
+			fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(body, "\n", "\n  "))
+		}
+		if fix := strings.TrimSpace(f.SuggestedFix); fix != "" {
+			fmt.Fprintf(&b, "  Suggested fix: %s\n", strings.ReplaceAll(fix, "\n", "\n  "))
+		}
+	}
+	return b.String()
+}
+
+func knownCategory(c string) bool {
+	for _, k := range Categories {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
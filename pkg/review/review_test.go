@@ -0,0 +1,68 @@
+package review
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse_FencedBlockAfterProse(t *testing.T) {
+	out := "I looked at the diff.\n\n```json\n" + `{
+  "summary": "Mostly fine.",
+  "verdict": "Request_Changes",
+  "findings": [
+    {"file": "a.go", "startLine": 3, "endLine": 4, "severity": "HIGH", "category": "bugs", "title": "nil deref", "suggestedFix": "check err"}
+  ]
+}` + "\n```\nThanks!"
+	r, err := Parse(out)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if r.Verdict != VerdictRequestChanges || len(r.Findings) != 1 {
+		t.Fatalf("unexpected review: %+v", r)
+	}
+	f := r.Findings[0]
+	if f.Severity != SeverityHigh || f.Category != "other" || f.StartLine != 3 || f.EndLine != 4 || f.SuggestedFix != "check err" {
+		t.Fatalf("unexpected finding: %+v", f)
+	}
+}
+
+func TestParse_BareObjectAndEmptyFindings(t *testing.T) {
+	r, err := Parse(`{"summary":"LGTM","verdict":"approve"}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if r.Findings == nil || len(r.Findings) != 0 {
+		t.Fatalf("expected empty findings slice, got %#v", r.Findings)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	if _, err := Parse("no json here"); err == nil {
+		t.Fatalf("expected error without JSON")
+	}
+	_, err := Parse(`{"summary":"x","verdict":"maybe","findings":[{"file":"","severity":"urgent","title":"t","startLine":5,"endLine":2}]}`)
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, want := range []string{"verdict", "severity", "file is required", "line range"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %q", err, want)
+		}
+	}
+	if !strings.Contains(RepairPrompt(err), "verdict") {
+		t.Fatalf("repair prompt should include the validation error")
+	}
+}
+
+func TestReview_Markdown(t *testing.T) {
+	r := Review{Summary: "Mostly fine.", Verdict: VerdictRequestChanges, Findings: []Finding{
+		{File: "a.go", StartLine: 3, EndLine: 5, Severity: SeverityHigh, Category: "correctness", Title: "nil deref", Body: "x may be nil"},
+		{File: "b.go", Severity: SeverityLow, Category: "style", Title: "naming"},
+	}}
+	want := "**Verdict:** request changes\n\nMostly fine.\n\n**Findings (2)**\n\n" +
+		"- **high** `a.go:3-5` (correctness): nil deref\n  x may be nil\n\n" +
+		"- **low** `b.go` (style): naming\n"
+	if got := r.Markdown(); got != want {
+		t.Fatalf("unexpected markdown:\n%s", got)
+	}
+}
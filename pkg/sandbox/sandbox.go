@@ -1,6 +1,7 @@
 package sandbox
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,59 +12,60 @@ import (
 )
 
 // Runner provides thin wrappers over Crafting CLI commands (cs exec/scp/sandbox).
-// All operations are non-interactive and suitable for automation.
+// All operations are non-interactive and suitable for automation, and stop
+// (including retries) when their context is cancelled.
 type Runner struct{ workspace string }
 
 func NewRunner(workspace string) *Runner { return &Runner{workspace: workspace} }
 
 // CreateSandbox creates a new sandbox using the provided template and optional pool.
 // envVars map will be translated to `-D '<workspace>/env[KEY]=VALUE'` entries.
-func (r *Runner) CreateSandbox(sandboxName, template, pool string, envVars map[string]string) error {
+func (r *Runner) CreateSandbox(ctx context.Context, sandboxName, template, pool string, envVars map[string]string) error {
 	if sandboxName == "" || template == "" {
 		return fmt.Errorf("sandbox name and template are required")
 	}
 
 	args := r.buildCreateArgs(sandboxName, template, pool, envVars)
 	run := func() error {
-		cmd := exec.Command("cs", args...)
+		cmd := exec.CommandContext(ctx, "cs", args...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		return cmd.Run()
 	}
-	return runWithRetries(run, 5, 2*time.Second)
+	return runWithRetries(ctx, run, 5, 2*time.Second)
 }
 
 // Exec runs a command inside the sandbox as user 1000 within the configured workspace.
-func (r *Runner) Exec(sandboxName string, command string) error {
+func (r *Runner) Exec(ctx context.Context, sandboxName string, command string) error {
 	if sandboxName == "" || strings.TrimSpace(command) == "" {
 		return fmt.Errorf("sandbox and command are required")
 	}
 	args := []string{"exec", "-t", "-u", "1000", "-W", sandboxName + "/" + r.workspace, "--", "bash", "-lc", command}
 	run := func() error {
-		cmd := exec.Command("cs", args...)
+		cmd := exec.CommandContext(ctx, "cs", args...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		return cmd.Run()
 	}
-	return runWithRetries(run, 5, 2*time.Second)
+	return runWithRetries(ctx, run, 5, 2*time.Second)
 }
 
 // Mkdir ensures a directory exists inside the sandbox.
-func (r *Runner) Mkdir(sandboxName string, remoteDir string) error {
+func (r *Runner) Mkdir(ctx context.Context, sandboxName string, remoteDir string) error {
 	if sandboxName == "" || remoteDir == "" {
 		return fmt.Errorf("sandbox and remoteDir are required")
 	}
-	return r.Exec(sandboxName, fmt.Sprintf("mkdir -p %s", shellQuote(remoteDir)))
+	return r.Exec(ctx, sandboxName, fmt.Sprintf("mkdir -p %s", shellQuote(remoteDir)))
 }
 
 // TransferContent writes content to a temporary file and copies it to the sandbox path using cs scp.
-func (r *Runner) TransferContent(sandboxName, targetPath, content string) error {
+func (r *Runner) TransferContent(ctx context.Context, sandboxName, targetPath, content string) error {
 	if sandboxName == "" || targetPath == "" {
 		return fmt.Errorf("sandbox and targetPath are required")
 	}
 	// Ensure remote directory exists first
 	remoteDir := filepath.Dir(targetPath)
-	if err := r.Mkdir(sandboxName, remoteDir); err != nil {
+	if err := r.Mkdir(ctx, sandboxName, remoteDir); err != nil {
 		return err
 	}
 
@@ -76,12 +78,12 @@ func (r *Runner) TransferContent(sandboxName, targetPath, content string) error
 
 	args := []string{"scp", tmpFile, fmt.Sprintf("%s/%s:%s", sandboxName, r.workspace, targetPath)}
 	run := func() error {
-		cmd := exec.Command("cs", args...)
+		cmd := exec.CommandContext(ctx, "cs", args...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		return cmd.Run()
 	}
-	return runWithRetries(run, 5, 2*time.Second)
+	return runWithRetries(ctx, run, 5, 2*time.Second)
 }
 
 func shellQuote(s string) string {
@@ -126,7 +128,7 @@ func (r *Runner) buildCreateArgs(sandboxName, template, pool string, envVars map
 	return args
 }
 
-func runWithRetries(fn func() error, attempts int, baseDelay time.Duration) error {
+func runWithRetries(ctx context.Context, fn func() error, attempts int, baseDelay time.Duration) error {
 	if attempts < 1 {
 		attempts = 1
 	}
@@ -136,12 +138,19 @@ func runWithRetries(fn func() error, attempts int, baseDelay time.Duration) erro
 		if err == nil {
 			return nil
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if i < attempts-1 {
 			d := baseDelay * time.Duration(1<<i)
 			if d > 10*time.Second {
 				d = 10 * time.Second
 			}
-			time.Sleep(d)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+			}
 		}
 	}
 	return err
@@ -4,21 +4,66 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Task statuses set by the worker. Runs stopped by a limit use
+// claude.StatusTimedOut or claude.StatusBudgetExceeded.
+const (
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+	// StatusInterrupted marks a task whose worker was stopped by a signal.
+	StatusInterrupted = "interrupted"
+)
+
 type Task struct {
-	ID        string         `json:"id"`
-	Status    string         `json:"status"`
-	SessionID string         `json:"sessionId,omitempty"`
-	CreatedAt time.Time      `json:"createdAt"`
-	UpdatedAt time.Time      `json:"updatedAt"`
-	Data      map[string]any `json:"data,omitempty"`
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	SessionID string    `json:"sessionId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Usage     *Usage    `json:"usage,omitempty"`
+	// Error and ExitCode describe a failed task; Status holds the failure kind.
+	Error    string         `json:"error,omitempty"`
+	ExitCode int            `json:"exitCode,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+// DataString returns Data[key] when it is a string, otherwise "".
+func (t Task) DataString(key string) string {
+	s, _ := t.Data[key].(string)
+	return s
+}
+
+// DataInt returns Data[key] as an integer. Numbers read back from
+// state.json are float64; numeric strings are accepted too.
+func (t Task) DataInt(key string) int64 {
+	switch v := t.Data[key].(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	case string:
+		n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n
+	}
+	return 0
 }
 
 type State struct {
-	Current *Task  `json:"current,omitempty"`
+	Current *Task `json:"current,omitempty"`
+	// Running holds the tasks started with StartTask; several run at once
+	// when the worker runs tasks in parallel.
+	Running []Task `json:"running,omitempty"`
 	Queue   []Task `json:"queue,omitempty"`
 	History []Task `json:"history,omitempty"`
 }
@@ -54,6 +99,11 @@ func Load(path string) (*Manager, error) {
 	return m, nil
 }
 
+// Path is the file the state is saved to.
+func (m *Manager) Path() string { return m.path }
+
+// Save writes the state to a temp file and renames it into place, so a
+// reader or a crash never sees a partial state.json.
 func (m *Manager) Save() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -61,14 +111,23 @@ func (m *Manager) Save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(m.path, b, 0o644)
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
 }
 
 func (m *Manager) GetState() State {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	// Return a shallow copy
+	// Return a shallow copy; Running is copied as tasks are updated in place
 	s := m.state
+	s.Running = slices.Clone(s.Running)
 	return s
 }
 
@@ -94,36 +153,252 @@ func (m *Manager) StartNext() *Task {
 	}
 	next := m.state.Queue[0]
 	m.state.Queue = m.state.Queue[1:]
-	next.Status = "in_progress"
+	next.Status = StatusInProgress
 	next.UpdatedAt = time.Now().UTC()
 	m.state.Current = &next
 	return m.state.Current
 }
 
+// StartTask moves the next task to Running and returns a copy of it: the
+// current task left by a single-task run first, then the first queued task
+// whose ID is not already in flight, so follow-ups of a task never overtake
+// it. It returns false when nothing can start.
+func (m *Manager) StartTask() (Task, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next Task
+	switch {
+	case m.state.Current != nil:
+		next = *m.state.Current
+		m.state.Current = nil
+	default:
+		i := 0
+		for ; i < len(m.state.Queue); i++ {
+			if t, _ := m.inFlight(m.state.Queue[i].ID); t == nil {
+				break
+			}
+		}
+		if i == len(m.state.Queue) {
+			return Task{}, false
+		}
+		next = m.state.Queue[i]
+		m.state.Queue = append(m.state.Queue[:i:i], m.state.Queue[i+1:]...)
+	}
+	next.Status = StatusInProgress
+	next.UpdatedAt = time.Now().UTC()
+	m.state.Running = append(m.state.Running, next)
+	return next, true
+}
+
+// RequeueRunning puts tasks left in Running by a worker that stopped
+// without finishing them back at the front of the queue, and returns how
+// many there were.
+func (m *Manager) RequeueRunning() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.state.Running)
+	if n == 0 {
+		return 0
+	}
+	m.state.Queue = append(m.state.Running, m.state.Queue...)
+	m.state.Running = nil
+	return n
+}
+
+// inFlight finds task id among the current and running tasks; the index is
+// -1 for the current task. Callers hold m.mu.
+func (m *Manager) inFlight(id string) (*Task, int) {
+	if m.state.Current != nil && m.state.Current.ID == id {
+		return m.state.Current, -1
+	}
+	for i := range m.state.Running {
+		if m.state.Running[i].ID == id {
+			return &m.state.Running[i], i
+		}
+	}
+	return nil, 0
+}
+
+// Task returns a copy of in-flight task id (current or running).
+func (m *Manager) Task(id string) (Task, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, _ := m.inFlight(id); t != nil {
+		return *t, true
+	}
+	return Task{}, false
+}
+
+// LastFinished returns the latest history entry of task id.
+func (m *Manager) LastFinished(id string) (Task, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.state.History) - 1; i >= 0; i-- {
+		if m.state.History[i].ID == id {
+			return m.state.History[i], true
+		}
+	}
+	return Task{}, false
+}
+
 func (m *Manager) CompleteCurrent(finalStatus string) *Task {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.state.Current == nil {
 		return nil
 	}
-	cur := m.state.Current
+	return m.complete(m.state.Current.ID, finalStatus)
+}
+
+// CompleteTask moves in-flight task id to the history with finalStatus
+// (default done).
+func (m *Manager) CompleteTask(id, finalStatus string) *Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.complete(id, finalStatus)
+}
+
+func (m *Manager) complete(id, finalStatus string) *Task {
+	cur, i := m.inFlight(id)
+	if cur == nil {
+		return nil
+	}
 	if finalStatus == "" {
-		finalStatus = "done"
+		finalStatus = StatusDone
 	}
 	cur.Status = finalStatus
 	cur.UpdatedAt = time.Now().UTC()
 	m.state.History = append(m.state.History, *cur)
-	m.state.Current = nil
+	if i < 0 {
+		m.state.Current = nil
+	} else {
+		m.state.Running = append(m.state.Running[:i:i], m.state.Running[i+1:]...)
+	}
 	return &m.state.History[len(m.state.History)-1]
 }
 
+// FailCurrent completes the current task with a failure status, recording
+// the error message and the exit code of the failed process (0 if none).
+func (m *Manager) FailCurrent(status string, err error, exitCode int) *Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.Current == nil {
+		return nil
+	}
+	return m.fail(m.state.Current.ID, status, err, exitCode)
+}
+
+// FailTask is FailCurrent for in-flight task id.
+func (m *Manager) FailTask(id, status string, err error, exitCode int) *Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fail(id, status, err, exitCode)
+}
+
+func (m *Manager) fail(id, status string, err error, exitCode int) *Task {
+	if cur, _ := m.inFlight(id); cur != nil {
+		if err != nil {
+			cur.Error = err.Error()
+		}
+		cur.ExitCode = exitCode
+	}
+	return m.complete(id, status)
+}
+
 func (m *Manager) LinkSessionToCurrent(sessionID string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.state.Current == nil {
 		return false
 	}
-	m.state.Current.SessionID = sessionID
-	m.state.Current.UpdatedAt = time.Now().UTC()
+	return m.linkSession(m.state.Current.ID, sessionID)
+}
+
+// LinkSession records the Claude session of in-flight task id.
+func (m *Manager) LinkSession(id, sessionID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.linkSession(id, sessionID)
+}
+
+func (m *Manager) linkSession(id, sessionID string) bool {
+	cur, _ := m.inFlight(id)
+	if cur == nil {
+		return false
+	}
+	cur.SessionID = sessionID
+	cur.UpdatedAt = time.Now().UTC()
+	return true
+}
+
+// SetCurrentData stores key=value in the current task's Data map.
+func (m *Manager) SetCurrentData(key string, value any) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.Current == nil {
+		return false
+	}
+	setData(m.state.Current, key, value)
+	return true
+}
+
+// SetTaskData stores key=value in the Data of task id: the in-flight task
+// or else its latest history entry (e.g. hook results recorded after a task
+// completed).
+func (m *Manager) SetTaskData(id, key string, value any) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, _ := m.inFlight(id)
+	if t == nil {
+		for i := len(m.state.History) - 1; i >= 0; i-- {
+			if m.state.History[i].ID == id {
+				t = &m.state.History[i]
+				break
+			}
+		}
+	}
+	if t == nil {
+		return false
+	}
+	setData(t, key, value)
+	return true
+}
+
+func setData(t *Task, key string, value any) {
+	if t.Data == nil {
+		t.Data = map[string]any{}
+	}
+	t.Data[key] = value
+	t.UpdatedAt = time.Now().UTC()
+}
+
+// AddCurrentUsage adds token/cost accounting to the current task. A task can
+// span several Claude runs (fallbacks, repairs), so usage accumulates.
+func (m *Manager) AddCurrentUsage(u Usage) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.Current == nil {
+		return false
+	}
+	return m.addUsage(m.state.Current.ID, u)
+}
+
+// AddUsage is AddCurrentUsage for in-flight task id.
+func (m *Manager) AddUsage(id string, u Usage) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addUsage(id, u)
+}
+
+func (m *Manager) addUsage(id string, u Usage) bool {
+	cur, _ := m.inFlight(id)
+	if cur == nil {
+		return false
+	}
+	if cur.Usage == nil {
+		cur.Usage = &Usage{}
+	}
+	cur.Usage.Add(u)
+	cur.UpdatedAt = time.Now().UTC()
 	return true
 }
@@ -32,3 +32,99 @@ func TestLoadSaveAndQueue(t *testing.T) {
 		t.Fatalf("save final: %v", err)
 	}
 }
+
+func TestCompleteCurrent_KeepsData(t *testing.T) {
+	m := NewManager(t.TempDir() + "/state.json")
+	m.Enqueue(Task{ID: "a"})
+	m.StartNext()
+	if !m.SetCurrentData("transcript", "/tmp/a.jsonl") {
+		t.Fatal("no current task")
+	}
+	done := m.CompleteCurrent(StatusDone)
+	if done == nil || done.Data["transcript"] != "/tmp/a.jsonl" {
+		t.Fatalf("complete unexpected: %+v", done)
+	}
+}
+
+func TestTaskDataInt(t *testing.T) {
+	path := t.TempDir() + "/state.json"
+	m := NewManager(path)
+	m.Enqueue(Task{ID: "a", Data: map[string]any{"prNumber": 42, "commentId": "1001", "bad": "x"}})
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := loaded.GetState().Queue[0]
+	if task.DataInt("prNumber") != 42 || task.DataInt("commentId") != 1001 || task.DataInt("bad") != 0 || task.DataInt("missing") != 0 {
+		t.Fatalf("unexpected ints from %+v", task.Data)
+	}
+}
+
+func TestSetTaskData(t *testing.T) {
+	m := NewManager(t.TempDir() + "/state.json")
+	for _, id := range []string{"a", "a", "b"} {
+		m.Enqueue(Task{ID: id})
+		m.StartNext()
+		m.CompleteCurrent(StatusDone)
+	}
+	if !m.SetTaskData("a", "hooks", 1) || m.SetTaskData("missing", "hooks", 1) {
+		t.Fatal("unexpected SetTaskData result")
+	}
+	h := m.GetState().History
+	if h[0].Data["hooks"] != nil || h[1].Data["hooks"] != 1 {
+		t.Fatalf("expected only the latest a to be updated: %+v", h)
+	}
+}
+
+func TestStartTask_RunsSeveralAtOnce(t *testing.T) {
+	m := NewManager(t.TempDir() + "/state.json")
+	for _, id := range []string{"a", "a", "b"} {
+		m.Enqueue(Task{ID: id})
+	}
+	first, ok1 := m.StartTask()
+	// The second "a" must wait for the first one to finish
+	second, ok2 := m.StartTask()
+	if !ok1 || !ok2 || first.ID != "a" || second.ID != "b" || second.Status != StatusInProgress {
+		t.Fatalf("unexpected starts: %+v %+v", first, second)
+	}
+	if _, ok := m.StartTask(); ok {
+		t.Fatal("expected the queued follow-up of a to wait")
+	}
+	m.LinkSession("b", "sess-b")
+	m.AddUsage("b", Usage{CostUSD: 1})
+	m.SetTaskData("b", "k", "v")
+	if done := m.CompleteTask("b", ""); done == nil || done.SessionID != "sess-b" || done.Usage.CostUSD != 1 || done.Data["k"] != "v" {
+		t.Fatalf("unexpected completed task: %+v", done)
+	}
+	if failed := m.FailTask("a", "claude_failed", os.ErrClosed, 13); failed == nil || failed.ExitCode != 13 || failed.Error == "" {
+		t.Fatalf("unexpected failed task: %+v", failed)
+	}
+	if st := m.GetState(); len(st.Running) != 0 || len(st.History) != 2 || len(st.Queue) != 1 {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+	if next, ok := m.StartTask(); !ok || next.ID != "a" {
+		t.Fatalf("expected the follow-up to start once a finished: %+v", next)
+	}
+	if n := m.RequeueRunning(); n != 1 || len(m.GetState().Queue) != 1 || len(m.GetState().Running) != 0 {
+		t.Fatalf("expected the running task to be requeued, got %d: %+v", n, m.GetState())
+	}
+}
+
+func TestSave_RenamesIntoPlace(t *testing.T) {
+	path := t.TempDir() + "/state.json"
+	m := NewManager(path)
+	m.Enqueue(Task{ID: "a"})
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+	got, err := Load(path)
+	if err != nil || len(got.GetState().Queue) != 1 {
+		t.Fatalf("unexpected reload: %v %+v", err, got)
+	}
+}
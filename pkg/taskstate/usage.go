@@ -0,0 +1,102 @@
+package taskstate
+
+import (
+	"sort"
+	"time"
+)
+
+// Usage is the token and cost accounting for a single task run.
+type Usage struct {
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens,omitempty"`
+	CacheReadTokens     int64   `json:"cacheReadTokens,omitempty"`
+	CostUSD             float64 `json:"costUsd"`
+	NumTurns            int     `json:"numTurns"`
+	DurationMS          int64   `json:"durationMs"`
+	DurationAPIMS       int64   `json:"durationApiMs,omitempty"`
+}
+
+// Add accumulates o into u.
+func (u *Usage) Add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CacheCreationTokens += o.CacheCreationTokens
+	u.CacheReadTokens += o.CacheReadTokens
+	u.CostUSD += o.CostUSD
+	u.NumTurns += o.NumTurns
+	u.DurationMS += o.DurationMS
+	u.DurationAPIMS += o.DurationAPIMS
+}
+
+// UsageTotals aggregates Usage over a group of tasks.
+type UsageTotals struct {
+	Key                 string  `json:"key"`
+	Tasks               int     `json:"tasks"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CostUSD             float64 `json:"costUsd"`
+	NumTurns            int     `json:"numTurns"`
+	DurationMS          int64   `json:"durationMs"`
+}
+
+func (t *UsageTotals) add(u Usage) {
+	t.Tasks++
+	t.InputTokens += u.InputTokens
+	t.OutputTokens += u.OutputTokens
+	t.CacheCreationTokens += u.CacheCreationTokens
+	t.CacheReadTokens += u.CacheReadTokens
+	t.CostUSD += u.CostUSD
+	t.NumTurns += u.NumTurns
+	t.DurationMS += u.DurationMS
+}
+
+// UsageByRepo totals history usage by Data["repo"], most expensive first.
+// Tasks without a repo are grouped under "(unknown)".
+func (s State) UsageByRepo() []UsageTotals {
+	return s.usageBy(func(t Task) string {
+		if r := t.DataString("repo"); r != "" {
+			return r
+		}
+		return "(unknown)"
+	}, func(a, b UsageTotals) bool { return a.CostUSD > b.CostUSD })
+}
+
+// UsageByDay totals history usage by UTC completion date (YYYY-MM-DD), oldest first.
+func (s State) UsageByDay() []UsageTotals {
+	return s.usageBy(func(t Task) string {
+		return t.UpdatedAt.UTC().Format(time.DateOnly)
+	}, func(a, b UsageTotals) bool { return a.Key < b.Key })
+}
+
+func (s State) usageBy(key func(Task) string, less func(a, b UsageTotals) bool) []UsageTotals {
+	groups := map[string]*UsageTotals{}
+	for _, t := range s.History {
+		if t.Usage == nil {
+			continue
+		}
+		k := key(t)
+		g, ok := groups[k]
+		if !ok {
+			g = &UsageTotals{Key: k}
+			groups[k] = g
+		}
+		g.add(*t.Usage)
+	}
+	out := make([]UsageTotals, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if less(out[i], out[j]) {
+			return true
+		}
+		if less(out[j], out[i]) {
+			return false
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
@@ -0,0 +1,26 @@
+package taskstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsageTotals(t *testing.T) {
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	st := State{History: []Task{
+		{ID: "a", UpdatedAt: day1, Data: map[string]any{"repo": "org/cheap"}, Usage: &Usage{InputTokens: 10, CostUSD: 0.1, NumTurns: 1}},
+		{ID: "b", UpdatedAt: day1, Data: map[string]any{"repo": "org/pricey"}, Usage: &Usage{InputTokens: 100, CostUSD: 1.0, NumTurns: 5}},
+		{ID: "c", UpdatedAt: day2, Data: map[string]any{"repo": "org/pricey"}, Usage: &Usage{InputTokens: 50, CostUSD: 0.5, NumTurns: 2}},
+		{ID: "d", UpdatedAt: day2},
+	}}
+
+	byRepo := st.UsageByRepo()
+	if len(byRepo) != 2 || byRepo[0].Key != "org/pricey" || byRepo[0].Tasks != 2 || byRepo[0].InputTokens != 150 || byRepo[0].CostUSD != 1.5 {
+		t.Fatalf("unexpected per-repo totals: %+v", byRepo)
+	}
+	byDay := st.UsageByDay()
+	if len(byDay) != 2 || byDay[0].Key != "2025-03-01" || byDay[0].Tasks != 2 || byDay[1].NumTurns != 2 {
+		t.Fatalf("unexpected per-day totals: %+v", byDay)
+	}
+}
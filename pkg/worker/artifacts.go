@@ -0,0 +1,301 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/your-org/claude-dev-setup/pkg/review"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// Task.Data keys of the artifact bundle.
+const (
+	DataArtifacts        = "artifacts"
+	DataArtifactsTarball = "artifactsTarball"
+)
+
+// ArtifactDir returns ARTIFACT_DIR or <cmdDir>/artifacts.
+func ArtifactDir(cmdDir string) string {
+	if d := strings.TrimSpace(os.Getenv("ARTIFACT_DIR")); d != "" {
+		return d
+	}
+	return filepath.Join(cmdDir, "artifacts")
+}
+
+// artifactTools is tools.json of a bundle.
+type artifactTools struct {
+	Mode            string   `json:"mode,omitempty"`
+	PermissionMode  string   `json:"permissionMode,omitempty"`
+	AllowedTools    []string `json:"allowedTools,omitempty"`
+	DisallowedTools []string `json:"disallowedTools,omitempty"`
+}
+
+// artifactTiming is timing.json of a bundle.
+type artifactTiming struct {
+	Status     string           `json:"status"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	DurationMS int64            `json:"durationMs"`
+	Usage      *taskstate.Usage `json:"usage,omitempty"`
+	Attempts   any              `json:"attempts,omitempty"`
+}
+
+// collectArtifacts writes the bundle of finished task id and records its
+// path on the task. Failures are only logged: a task never fails over its
+// artifacts.
+func collectArtifacts(cmdDir string, mgr *taskstate.Manager, spec TaskSpec, opts StreamOptions) {
+	task, ok := mgr.LastFinished(spec.TaskID)
+	if !ok {
+		return
+	}
+	dir, tarball, err := writeArtifacts(ArtifactDir(cmdDir), task, spec, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] artifacts of task %s: %v\n", task.ID, err)
+	}
+	if dir == "" {
+		return
+	}
+	mgr.SetTaskData(task.ID, DataArtifacts, dir)
+	if tarball != "" {
+		mgr.SetTaskData(task.ID, DataArtifactsTarball, tarball)
+	}
+	if err := mgr.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] artifacts: save state: %v\n", err)
+	}
+}
+
+// writeArtifacts writes <base>/<task-id>/ with what the task ran with and
+// produced: the final prompt, tools and settings, the MCP config with
+// secrets redacted, the transcript and tool log, the diff of the checkout
+// against the commit it started from, the result and review, and timing.
+// With ARTIFACT_TARBALL=true it also writes <base>/<task-id>.tar.gz. A
+// later task with the same ID replaces the bundle. Missing pieces are
+// skipped; the errors of the others are joined.
+func writeArtifacts(base string, task taskstate.Task, spec TaskSpec, opts StreamOptions) (dir, tarball string, err error) {
+	dir = filepath.Join(base, safeFileComponent(task.ID))
+	if err := os.RemoveAll(dir); err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	var errs []error
+	write := func(name string, b []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o644); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	writeJSON := func(name string, v any) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		write(name, append(b, '\n'))
+	}
+	copyFile := func(name, src string) {
+		if src == "" {
+			return
+		}
+		b, err := os.ReadFile(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		write(name, b)
+	}
+
+	prompt := spec.Prompt
+	if opts.Prompt != "" {
+		prompt = finalPrompt(opts)
+	}
+	write("prompt.txt", []byte(prompt))
+	writeJSON("tools.json", artifactTools{
+		Mode:            task.DataString(DataMode),
+		PermissionMode:  opts.PermissionMode,
+		AllowedTools:    spec.AllowedTools,
+		DisallowedTools: spec.DisallowedTools,
+	})
+	// Both may carry env values and tokens
+	copyRedacted := func(name, src string) {
+		b, err := os.ReadFile(src)
+		if err != nil {
+			return
+		}
+		if red, err := RedactMCPConfig(b); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		} else {
+			write(name, red)
+		}
+	}
+	if spec.RepoDir != "" {
+		copyRedacted("settings.local.json", filepath.Join(spec.RepoDir, ".claude", "settings.local.json"))
+	}
+	home := opts.HomeDir
+	if home == "" {
+		home = os.Getenv("HOME")
+	}
+	if home != "" {
+		copyRedacted("mcp.json", filepath.Join(home, ".mcp.json"))
+	}
+	copyFile("transcript.jsonl", task.DataString("transcript"))
+	copyFile("tool-calls.jsonl", task.DataString("toolCalls"))
+	if spec.RepoDir != "" {
+		diff, err := workspaceDiff(spec.RepoDir, task.DataString(DataHeadSHA))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("diff: %w", err))
+		} else if diff != "" {
+			write("diff.patch", []byte(diff))
+		}
+	}
+	if res := task.DataString("result"); res != "" {
+		write("result.txt", []byte(res))
+	}
+	if rv, ok := task.Data["review"]; ok {
+		writeJSON("review.json", rv)
+	}
+	writeJSON("timing.json", artifactTiming{
+		Status:     task.Status,
+		CreatedAt:  task.CreatedAt,
+		FinishedAt: task.UpdatedAt,
+		DurationMS: task.UpdatedAt.Sub(task.CreatedAt).Milliseconds(),
+		Usage:      task.Usage,
+		Attempts:   task.Data["attempts"],
+	})
+	writeJSON("task.json", task)
+
+	if os.Getenv("ARTIFACT_TARBALL") == "true" {
+		tarball = dir + ".tar.gz"
+		if err := writeTarball(tarball, dir); err != nil {
+			errs = append(errs, fmt.Errorf("tarball: %w", err))
+			tarball = ""
+		}
+	}
+	return dir, tarball, errors.Join(errs...)
+}
+
+// finalPrompt is the prompt RunClaudeStream sends for opts.
+func finalPrompt(opts StreamOptions) string {
+	if opts.StructuredReview {
+		return opts.Prompt + review.Instructions
+	}
+	return opts.Prompt
+}
+
+// workspaceDiff is the binary diff of repoDir against base (default HEAD),
+// so committed fixes show up too, followed by untracked files. It returns ""
+// when repoDir is not a git checkout.
+func workspaceDiff(repoDir, base string) (string, error) {
+	ctx := context.Background()
+	if _, err := outputInDir(ctx, repoDir, "git", "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return "", nil
+	}
+	if base == "" {
+		base = "HEAD"
+	}
+	diff, err := outputInDir(ctx, repoDir, "git", "diff", "--binary", base, "--", ".", worktreeExclude)
+	if err != nil {
+		return "", err
+	}
+	untracked, err := outputInDir(ctx, repoDir, "git", "ls-files", "--others", "--exclude-standard", "-z", "--", ".", worktreeExclude)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(diff)
+	for _, f := range strings.Split(strings.TrimRight(untracked, "\x00"), "\x00") {
+		if f == "" {
+			continue
+		}
+		// --no-index exits 1 when the files differ, which they always do
+		cmd := exec.CommandContext(ctx, "git", "diff", "--binary", "--no-index", "--", os.DevNull, f)
+		cmd.Dir = repoDir
+		out, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return "", fmt.Errorf("diff %s: %w", f, err)
+		}
+		b.Write(out)
+	}
+	return b.String(), nil
+}
+
+// writeTarball packs dir into a gzipped tarball at path, under the
+// directory's base name.
+func writeTarball(path, dir string) (err error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	root := filepath.Base(dir)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(root, rel))
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func TestRedactMCPConfig(t *testing.T) {
+	in := `{"mcpServers":{"github":{"command":"npx","args":["server","--token","ghp_abcdef123","--task","task-42","--key=sk-ant-abc"],
+		"env":{"GITHUB_TOKEN":"ghp_secret","REF":"${GITHUB_TOKEN}"}},
+		"remote":{"url":"https://mcp.example.com","headers":{"Authorization":"Bearer x"},"apiKey":"k1"}}}`
+	out, err := RedactMCPConfig([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	for _, secret := range []string{"ghp_abcdef123", "ghp_secret", "Bearer x", `"k1"`, "sk-ant-abc"} {
+		if strings.Contains(s, secret) {
+			t.Fatalf("secret %q not redacted:\n%s", secret, s)
+		}
+	}
+	for _, kept := range []string{`"npx"`, "https://mcp.example.com", "${GITHUB_TOKEN}", `"--token"`, `"task-42"`} {
+		if !strings.Contains(s, kept) {
+			t.Fatalf("expected %s to be kept:\n%s", kept, s)
+		}
+	}
+}
+
+func TestRunner_WritesArtifactBundle(t *testing.T) {
+	_, remote := gitRepo(t)
+	edit := fakeclaude.DefaultScript("sess-art")
+	edit.Steps = append([]fakeclaude.Step{
+		{WriteFile: &fakeclaude.FileWrite{Path: "a.txt", Content: "changed\n"}},
+		{WriteFile: &fakeclaude.FileWrite{Path: "new.txt", Content: "new\n"}},
+	}, edit.Steps...)
+	fakeclaude.Setup(t, edit)
+	t.Setenv("ARTIFACT_TARBALL", "true")
+
+	r := NewRunner()
+	r.Worktrees = NewWorktrees(t.TempDir())
+	r.Worktrees.CloneURL = func(string) string { return remote }
+	// drainTasks sets HOME; the MCP config is written through Prepare
+	r.Prepare = func(_ context.Context, spec TaskSpec) error {
+		return os.WriteFile(filepath.Join(os.Getenv("HOME"), ".mcp.json"), []byte(`{"mcpServers":{"x":{"env":{"TOKEN":"hunter2"}}}}`), 0o644)
+	}
+	h := drainTasks(t, r, "", TaskFile{ID: "art-1", Prompt: "edit things", Repo: "org/app", Branch: "main"})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+	dir := h[0].DataString(DataArtifacts)
+	if dir == "" || h[0].DataString(DataArtifactsTarball) != dir+".tar.gz" {
+		t.Fatalf("artifact paths not recorded: %+v", h[0].Data)
+	}
+	read := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("bundle is missing %s: %v", name, err)
+		}
+		return string(b)
+	}
+	if read("prompt.txt") != "edit things" {
+		t.Fatal("unexpected prompt.txt")
+	}
+	if diff := read("diff.patch"); !strings.Contains(diff, "+changed") || !strings.Contains(diff, "new.txt") {
+		t.Fatalf("diff misses workspace changes:\n%s", diff)
+	}
+	if mcp := read("mcp.json"); strings.Contains(mcp, "hunter2") {
+		t.Fatalf("mcp.json not redacted: %s", mcp)
+	}
+	var timing artifactTiming
+	if err := json.Unmarshal([]byte(read("timing.json")), &timing); err != nil || timing.Status != taskstate.StatusDone || timing.Usage == nil {
+		t.Fatalf("unexpected timing.json: %+v %v", timing, err)
+	}
+	for _, name := range []string{"tools.json", "transcript.jsonl", "result.txt", "task.json"} {
+		read(name)
+	}
+
+	f, err := os.Open(dir + ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	names := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names[hdr.Name] = true
+	}
+	if !names["art-1/diff.patch"] || !names["art-1/prompt.txt"] {
+		t.Fatalf("unexpected tarball entries: %v", names)
+	}
+}
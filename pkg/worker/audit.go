@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// recordToolAudit writes every tool call of the task to
+// <transcripts>/<taskID>-tools.jsonl, stores the summary in
+// Data["toolAudit"] and the log path in Data["toolCalls"], and reports
+// blocked tools so TOOL_WHITELIST_JSON can be tuned.
+func recordToolAudit(homeDir string, state *taskstate.Manager, id string, audit *claude.ToolAudit) {
+	calls := audit.Calls()
+	if len(calls) == 0 {
+		return
+	}
+	report := audit.Report()
+	state.SetTaskData(id, "toolAudit", report)
+
+	taskID := id
+	if taskID == "" {
+		taskID = "task"
+	}
+	dir := TranscriptDir(homeDir)
+	if err := os.MkdirAll(dir, 0o755); err == nil {
+		path := filepath.Join(dir, safeFileComponent(taskID)+"-tools.jsonl")
+		var b strings.Builder
+		for _, c := range calls {
+			line, _ := json.Marshal(c)
+			b.Write(line)
+			b.WriteByte('\n')
+		}
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARNING] tool log write failed: %v\n", err)
+		} else {
+			state.SetTaskData(id, "toolCalls", path)
+		}
+	}
+
+	fmt.Printf("[INFO] Tool calls: %d (%d errors)\n", report.TotalCalls, report.Errors)
+	if len(report.BlockedTools) == 0 {
+		return
+	}
+	blocked := make([]string, 0, len(report.BlockedTools))
+	for name, n := range report.BlockedTools {
+		blocked = append(blocked, fmt.Sprintf("%s x%d", name, n))
+	}
+	sort.Strings(blocked)
+	fmt.Fprintf(os.Stderr, "[WARNING] Tool calls blocked by permissions: %s\n", strings.Join(blocked, ", "))
+	for _, cmd := range report.BlockedCommands {
+		fmt.Fprintf(os.Stderr, "[WARNING]   blocked Bash: %s\n", truncateForLog(cmd, 200))
+	}
+	if s, err := json.Marshal(report.SuggestedAllow); err == nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] Consider adding to TOOL_WHITELIST_JSON: %s\n", s)
+	}
+}
+
+// recordSubagents stores the subagents (Task calls) of the task in
+// Data["subagents"] with their duration, tool calls and estimated cost.
+func recordSubagents(state *taskstate.Manager, id string, tree *claude.CallTree) {
+	agents := tree.Agents()
+	if len(agents) == 0 {
+		return
+	}
+	state.SetTaskData(id, "subagents", agents)
+	fmt.Printf("[INFO] Subagents: %d\n", len(agents))
+	for _, a := range agents {
+		status := "ok"
+		switch {
+		case !a.Completed:
+			status = "unfinished"
+		case a.IsError:
+			status = "error"
+		}
+		fmt.Printf("[INFO]   %s%s: %s, %.1fs, %d tool calls, ~$%.4f\n",
+			strings.Repeat("  ", len(a.Path)-1), strings.Join(a.Path, " > "), status,
+			float64(a.DurationMS)/1000, a.ToolCalls, a.CostUSD)
+	}
+}
+
+func truncateForLog(s string, max int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "…"
+}
@@ -1,270 +1,532 @@
 package worker
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
 
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+	"github.com/your-org/claude-dev-setup/pkg/review"
 	"github.com/your-org/claude-dev-setup/pkg/taskstate"
 )
 
-// lastConciseSubagent tracks the most recent subagent name seen in a tool_use
-// event so that the subsequent tool_result can be annotated consistently.
-var lastConciseSubagent string
+// StreamOptions configures one `claude` run.
+type StreamOptions struct {
+	HomeDir string
+	RepoDir string
+	Prompt  string
+	Debug   bool
+	// TaskID is the in-flight task the run records to; empty means the
+	// current task.
+	TaskID string
+	// SessionPath is where the session ID is written once it is known
+	// (default <HomeDir>/session.json).
+	SessionPath string
+	// PermissionMode should typically be "default" (not bypass). When
+	// AllowedTools is non-empty it is passed via --allowedTools;
+	// DisallowedTools is also honored.
+	AllowedTools    []string
+	DisallowedTools []string
+	PermissionMode  string
+	// ResumeSessionID continues an earlier conversation via --resume. When
+	// the session no longer exists the run falls back to a fresh session.
+	ResumeSessionID string
+	// Backend runs Claude; nil means the claude CLI.
+	Backend claude.Backend
+	// StructuredReview asks Claude for a review.Review JSON document,
+	// re-prompting up to ReviewRepairAttempts times when it is malformed.
+	StructuredReview     bool
+	ReviewRepairAttempts int
+	// Limits stop the task when it runs too long or spends too much; the
+	// task then ends as timed_out or budget_exceeded.
+	Limits claude.Limits
+	// Retry retries transient failures (overloaded, rate limited, server
+	// and network errors); the zero value does not retry.
+	Retry claude.RetryPolicy
+	// Finish, when set, runs after a successful run and before the task
+	// completes (posting the review, pushing fixes, ...).
+	Finish func(ctx context.Context, res RunResult) error
+}
 
-// RunClaudeStream executes `claude` with stream-json in the provided repoDir,
-// writes session.json when sessionId appears, and updates task state.
-//
-// permissionMode should typically be "default" (not bypass). When allowedTools is non-empty,
-// it will be passed via --allowedTools. disallowedTools is also honored.
-func RunClaudeStream(homeDir, repoDir, prompt string, state *taskstate.Manager, debug bool, allowedTools []string, disallowedTools []string, permissionMode string) error {
-	if prompt == "" {
-		return errors.New("missing prompt")
-	}
-	if repoDir == "" {
-		return errors.New("missing repoDir")
-	}
-	if st, err := os.Stat(repoDir); err != nil || !st.IsDir() {
-		return fmt.Errorf("repoDir not found or not a directory: %s", repoDir)
-	}
-	// Build command. Use central MCP config if present.
-	mcpCfg := filepath.Join(homeDir, ".mcp.json")
-	// Use --print for non-interactive mode; stream-json requires --verbose per CLI docs
-	args := []string{"--print", "--output-format", "stream-json", "--verbose"}
-	if permissionMode == "" {
-		permissionMode = "default"
-	}
-	args = append(args, "--permission-mode", permissionMode)
-	if len(allowedTools) > 0 {
-		args = append(args, "--allowedTools", strings.Join(allowedTools, ","))
-	}
-	if len(disallowedTools) > 0 {
-		args = append(args, "--disallowedTools", strings.Join(disallowedTools, ","))
-	}
-	// Provide prompt via -p to ensure non-interactive input is accepted even for multi-line prompts
-	args = append(args, "-p", prompt)
-	if st, err := os.Stat(mcpCfg); err == nil && !st.IsDir() {
-		args = append([]string{"--mcp-config", mcpCfg}, args...)
+// RunResult is what a successful run hands to StreamOptions.Finish.
+type RunResult struct {
+	SessionID string
+	// Result is the final text of the last run.
+	Result string
+	// Review is the parsed structured review, nil unless StructuredReview
+	// was requested and Claude produced a valid one.
+	Review *review.Review
+}
+
+// taskRun is shared by every Claude run of one task (initial run, resume
+// fallback, review repairs): they share one deadline, audit, budget and
+// subagent call tree.
+type taskRun struct {
+	ctx   context.Context
+	audit *claude.ToolAudit
+	meter *claude.LimitMeter
+	tree  *claude.CallTree
+	// renderer is shared by every run of the task, so a retry or repair
+	// adds to its file outputs instead of replacing them.
+	renderer claude.Renderer
+}
+
+// runOutcome is what a single Claude run reports back.
+type runOutcome struct {
+	SessionID string
+	// Result is the final text of the run (the result event's "result").
+	Result string
+	// Final is the result event, nil when the run ended without one.
+	Final *claude.Event
+}
+
+// attempt is one Claude run of a task, recorded in Data["attempts"].
+type attempt struct {
+	Attempt    int       `json:"attempt"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMS int64     `json:"durationMs"`
+	SessionID  string    `json:"sessionId,omitempty"`
+	// Resumed is set when a retry continued the previous attempt's session.
+	Resumed bool   `json:"resumed,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Reason is set for transient failures (see claude.Transient).
+	Reason    string `json:"reason,omitempty"`
+	RetryInMS int64  `json:"retryInMs,omitempty"`
+}
+
+// RunClaudeStream executes `claude` with stream-json in opts.RepoDir,
+// writes the session file when sessionId appears, and updates the state of
+// task opts.TaskID.
+// Cancelling ctx kills the run and marks the task interrupted. A failed
+// task records its failure kind as status; the returned error is a
+// *TaskError.
+func RunClaudeStream(ctx context.Context, opts StreamOptions, state *taskstate.Manager) error {
+	if opts.TaskID == "" {
+		if cur := state.GetState().Current; cur != nil {
+			opts.TaskID = cur.ID
+		}
 	}
-	cmd := exec.Command("claude", args...)
-	cmd.Dir = repoDir
-	if debug {
-		// Print the repository directory where Claude will be executed
-		fmt.Printf("[INFO] Running Claude in repo directory: %s\n", repoDir)
+	if opts.Prompt == "" {
+		return failTask(state, opts.TaskID, errors.New("missing prompt"))
 	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
+	if opts.RepoDir == "" {
+		return failTask(state, opts.TaskID, errors.New("missing repoDir"))
 	}
-	cmd.Stderr = os.Stderr
-	if err := cmd.Start(); err != nil {
-		return err
+	if st, err := os.Stat(opts.RepoDir); err != nil || !st.IsDir() {
+		return failTask(state, opts.TaskID, fmt.Errorf("repoDir not found or not a directory: %s", opts.RepoDir))
 	}
 
-	scanner := bufio.NewScanner(stdout)
-	var sessionId string
-	streamFormat := strings.ToLower(strings.TrimSpace(os.Getenv("CSCC_STREAM_FORMAT")))
-	if streamFormat == "" && debug {
-		streamFormat = "concise"
-	}
-	for scanner.Scan() {
-		line := scanner.Text()
-		var obj any
-		if err := json.Unmarshal([]byte(line), &obj); err == nil {
-			// Extract session id from system events
-			if m, ok := obj.(map[string]any); ok {
-				if typ, ok := m["type"].(string); ok && typ == "system" {
-					if sid, ok := m["session_id"].(string); ok && sid != "" {
-						sessionId = sid
-					}
-				}
-			}
-			if debug {
-				if streamFormat == "concise" {
-					printConciseEvent(obj)
-				} else {
-					// Truncate long strings and pretty print
-					trimmed := truncateLongStrings(obj, 400)
-					pretty := mustPrettyJSON(trimmed)
-					fmt.Printf("%s\n", pretty)
-				}
-			}
-		} else {
-			// Not JSON – print raw when in debug
-			if debug {
-				fmt.Printf("%s\n", line)
-			}
-		}
+	if opts.StructuredReview {
+		opts.Prompt += review.Instructions
 	}
-	if sessionId != "" {
-		// Persist session.json
-		sessPath := filepath.Join(homeDir, "session.json")
-		_ = os.WriteFile(sessPath, []byte("{\n  \"sessionId\": \""+sessionId+"\"\n}"), 0o644)
-		// Link session to current only if one is not already set
-		stNow := state.GetState()
-		alreadySet := stNow.Current != nil && stNow.Current.SessionID != ""
-		if !alreadySet {
-			state.LinkSessionToCurrent(sessionId)
-		}
+
+	parent := ctx
+	if opts.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Limits.Timeout)
+		defer cancel()
+	}
+	run := &taskRun{ctx: ctx, audit: claude.NewToolAudit(), meter: claude.NewLimitMeter(opts.Limits), tree: claude.NewCallTree(),
+		renderer: streamRenderer(opts.Debug, opts.TaskID)}
+	defer run.renderer.Close()
+	started := time.Now()
+	out, runErr := runWithRetries(run, opts, state)
+	var rv *review.Review
+	if runErr == nil && opts.StructuredReview {
+		rv, out = collectReview(run, opts, state, out)
 	}
+	if out.Result != "" {
+		state.SetTaskData(opts.TaskID, "result", out.Result)
+	}
+	recordToolAudit(opts.HomeDir, state, opts.TaskID, run.audit)
+	recordSubagents(state, opts.TaskID, run.tree)
 
-	// Mark current complete
-	state.CompleteCurrent("done")
-	if err := state.Save(); err != nil {
-		return err
+	limitErr := run.meter.Err()
+	if limitErr == nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		limitErr = &claude.LimitError{Kind: claude.LimitTimeout, Limit: opts.Limits.Timeout.String(), Observed: time.Since(started).Round(time.Second).String()}
+	}
+	if limitErr != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] %v\n", limitErr)
+		state.SetTaskData(opts.TaskID, "limit", limitErr)
+		runErr = limitErr
+	} else if err := parent.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "[WARNING] Claude run interrupted")
+		runErr = fmt.Errorf("claude run interrupted: %w", err)
+	}
+	if runErr == nil && opts.Finish != nil {
+		runErr = opts.Finish(parent, RunResult{SessionID: out.SessionID, Result: out.Result, Review: rv})
 	}
+	if runErr != nil {
+		return failTask(state, opts.TaskID, runErr)
+	}
+	state.CompleteTask(opts.TaskID, taskstate.StatusDone)
+	return state.Save()
+}
 
-	if err := scanner.Err(); err != nil {
-		return err
+// failTask completes in-flight task id with err's failure kind, saves state
+// and returns err as a *TaskError.
+func failTask(state *taskstate.Manager, id string, err error) error {
+	taskErr := ClassifyError(err)
+	state.FailTask(id, string(taskErr.Kind), taskErr.Err, taskErr.ExitCode)
+	if saveErr := state.Save(); saveErr != nil {
+		return errors.Join(taskErr, fmt.Errorf("save state: %w", saveErr))
 	}
-	return cmd.Wait()
+	return taskErr
 }
 
-// printConciseEvent prints a compact summary of stream-json events:
-// - assistant preambles (message text)
-// - tool_use: name and key input summary (file_path, command, subagent_type, etc.)
-// - tool_result: success/error with brief content
-func printConciseEvent(v any) {
-	m, ok := v.(map[string]any)
-	if !ok {
-		return
-	}
-	// Messages carry most interesting events
-	msg, ok := m["message"].(map[string]any)
-	if !ok {
-		return
-	}
-	content, ok := msg["content"].([]any)
-	if !ok {
-		return
-	}
-	for _, it := range content {
-		part, ok := it.(map[string]any)
-		if !ok {
-			continue
+// runWithRetries runs Claude, falling back to a fresh session when the one
+// to resume is gone, and retries transient failures with backoff. A retry
+// resumes the failed attempt's session when it has one so the work done so
+// far is kept. Every attempt is recorded in Data["attempts"].
+func runWithRetries(run *taskRun, opts StreamOptions, state *taskstate.Manager) (runOutcome, error) {
+	var attempts []attempt
+	cur := opts
+	for n := 1; ; n++ {
+		started := time.Now()
+		out, err := runClaudeOnce(run, cur, state)
+		if err != nil && cur.ResumeSessionID != "" && claude.IsSessionNotFound(err) {
+			fmt.Fprintf(os.Stderr, "[WARNING] session %s is no longer available; starting a fresh session\n", cur.ResumeSessionID)
+			state.SetTaskData(opts.TaskID, "resumeFallback", true)
+			cur = opts
+			cur.ResumeSessionID = ""
+			out, err = runClaudeOnce(run, cur, state)
+		} else if n == 1 && opts.ResumeSessionID != "" {
+			// Only the task's own resume counts; retries and review repairs
+			// resume the task's session
+			state.SetTaskData(opts.TaskID, "resumedFrom", opts.ResumeSessionID)
 		}
-		typ, _ := part["type"].(string)
-		switch typ {
-		case "text":
-			if t, _ := part["text"].(string); strings.TrimSpace(t) != "" {
-				fmt.Printf("🤖 Claude: %q\n", t)
-			}
-		case "tool_use":
-			name, _ := part["name"].(string)
-			input, _ := part["input"].(map[string]any)
-			// Detect subagent context
-			prefix := ""
-			if sa, ok := input["subagent_type"].(string); ok && strings.TrimSpace(sa) != "" {
-				lastConciseSubagent = sa
-				prefix = "[" + sa + "] "
-			} else {
-				lastConciseSubagent = ""
-			}
-			summary := summarizeToolInput(input)
-			if summary != "" {
-				fmt.Printf("🔧 %stool_use: %s - %s\n", prefix, name, summary)
-			} else {
-				fmt.Printf("🔧 %stool_use: %s\n", prefix, name)
-			}
-		case "tool_result":
-			isErr, _ := part["is_error"].(bool)
-			// Try common result shapes
-			if txt, _ := part["content"].(string); txt != "" {
-				emoji := "🟢"
-				if isErr {
-					emoji = "🔴"
-				}
-				prefix := ""
-				if lastConciseSubagent != "" {
-					prefix = "[" + lastConciseSubagent + "] "
-					lastConciseSubagent = ""
-				}
-				fmt.Printf("%s %stool_result: %q\n", emoji, prefix, txt)
+		reason, transient := claude.Transient(err, out.Final)
+		if stats, ok := resultStats(out.Final); err == nil && ok && stats.IsError {
+			// The run exited cleanly but its result reports an error: an API
+			// error the CLI exits 0 on, or the backend's own turn cap
+			err = &claude.ResultError{Subtype: out.Final.Subtype, Message: out.Final.Result.Result}
+		}
+
+		a := attempt{
+			Attempt:    n,
+			StartedAt:  started.UTC(),
+			DurationMS: time.Since(started).Milliseconds(),
+			SessionID:  out.SessionID,
+			Resumed:    n > 1 && cur.ResumeSessionID != "",
+		}
+		retry := err != nil && transient && n <= opts.Retry.MaxRetries && run.meter.Err() == nil && run.ctx.Err() == nil
+		var delay time.Duration
+		if err != nil {
+			a.Error, a.Reason = err.Error(), reason
+		}
+		if retry {
+			delay = opts.Retry.Backoff(n)
+			a.RetryInMS = delay.Milliseconds()
+		}
+		attempts = append(attempts, a)
+		state.SetTaskData(opts.TaskID, "attempts", attempts)
+		if !retry {
+			return out, err
+		}
+
+		fmt.Fprintf(os.Stderr, "[WARNING] Claude failed with a transient error (%s); retrying in %s (%d/%d)\n",
+			reason, delay.Round(time.Millisecond), n, opts.Retry.MaxRetries)
+		select {
+		case <-run.ctx.Done():
+			return out, err
+		case <-time.After(delay):
+		}
+		cur = opts
+		if out.SessionID != "" {
+			cur.ResumeSessionID = out.SessionID
+			cur.Prompt = retryPrompt
+			if opts.StructuredReview {
+				cur.Prompt += review.Instructions
 			}
 		}
 	}
 }
 
-func summarizeToolInput(in map[string]any) string {
-	if in == nil {
-		return ""
+// retryPrompt continues a session whose previous run failed transiently.
+const retryPrompt = "Your previous turn was cut off by a temporary API error. Continue the task from where you left off."
+
+// runClaudeOnce runs a single Claude session through the selected backend and
+// records its stream (transcript, session, usage) on the current task
+// without completing it.
+func runClaudeOnce(run *taskRun, opts StreamOptions, state *taskstate.Manager) (runOutcome, error) {
+	backend := opts.Backend
+	if backend == nil {
+		backend = claude.NewCLIBackend()
+	}
+	req := claudeRequest(opts)
+	if opts.Debug {
+		// Print the repository directory where Claude will be executed
+		fmt.Printf("[INFO] Running Claude (%s backend) in repo directory: %s\n", backend.Name(), opts.RepoDir)
+	}
+
+	var sessionId, resultText string
+	var final *claude.Event
+	transcript := NewTranscriptWriter(TranscriptDir(opts.HomeDir), opts.TaskID)
+	runErr := backend.Run(run.ctx, req, func(ev claude.Event) error {
+		// Extract session id from system events
+		if ev.Type == claude.TypeSystem && ev.SessionID != "" {
+			sessionId = ev.SessionID
+		}
+		run.audit.Observe(ev)
+		run.tree.Observe(ev)
+		limitErr := run.meter.Observe(ev)
+		if stats, ok := claude.StatsFromResult(ev); ok {
+			resultText = ev.Result.Result
+			final = &ev
+			state.AddUsage(opts.TaskID, usageFromStats(stats))
+			fmt.Printf("[INFO] Claude run: %d turns, %d input / %d output tokens (cache %d read, %d write), $%.4f, %.1fs\n",
+				stats.NumTurns, stats.InputTokens, stats.OutputTokens, stats.CacheReadTokens, stats.CacheCreationTokens,
+				stats.CostUSD, float64(stats.DurationMS)/1000)
+		}
+		if err := transcript.Write(sessionId, ev.Raw); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARNING] transcript write failed: %v\n", err)
+		}
+		if err := run.renderer.Render(ev); err != nil && opts.Debug {
+			fmt.Fprintf(os.Stderr, "[WARNING] render failed: %v\n", err)
+		}
+		// A non-nil error stops the backend and kills the process.
+		return limitErr
+	})
+	// Account for what a killed run consumed before its result event.
+	if u, cost := run.meter.Settle(); cost > 0 {
+		state.AddUsage(opts.TaskID, taskstate.Usage{
+			InputTokens:         u.InputTokens,
+			OutputTokens:        u.OutputTokens,
+			CacheCreationTokens: u.CacheCreationInputTokens,
+			CacheReadTokens:     u.CacheReadInputTokens,
+			CostUSD:             cost,
+		})
 	}
-	// Common fields
-	if fp, ok := in["file_path"].(string); ok && fp != "" {
-		return fmt.Sprintf("file=%s", fp)
+	if p, err := transcript.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] transcript close failed: %v\n", err)
+	} else if p != "" {
+		state.SetTaskData(opts.TaskID, "transcript", p)
+	}
+	if sessionId != "" {
+		// Persist the session file
+		sessPath := opts.SessionPath
+		if sessPath == "" {
+			sessPath = filepath.Join(opts.HomeDir, "session.json")
+		}
+		_ = os.WriteFile(sessPath, []byte("{\n  \"sessionId\": \""+sessionId+"\"\n}"), 0o644)
+		// Link session to the task only if one is not already set; a resumed
+		// run always records the session it continued in.
+		cur, _ := state.Task(opts.TaskID)
+		if cur.SessionID == "" || opts.ResumeSessionID != "" {
+			state.LinkSession(opts.TaskID, sessionId)
+		}
 	}
-	if cmd, ok := in["command"].(string); ok && cmd != "" {
-		return fmt.Sprintf("cmd=%s", truncateString(cmd, 120))
+	return runOutcome{SessionID: sessionId, Result: resultText, Final: final}, runErr
+}
+
+// collectReview parses the structured review from a finished run and stores
+// it as Data["review"]. Malformed output gets up to ReviewRepairAttempts
+// follow-up turns in the same session; if it still fails the parse error is
+// kept in Data["reviewError"] and the review is nil. It also returns the
+// outcome of the last run.
+func collectReview(run *taskRun, opts StreamOptions, state *taskstate.Manager, out runOutcome) (*review.Review, runOutcome) {
+	attempts := opts.ReviewRepairAttempts
+	if attempts <= 0 {
+		attempts = 2
 	}
-	if p, ok := in["path"].(string); ok && p != "" {
-		return fmt.Sprintf("path=%s", p)
+	rv, err := review.Parse(out.Result)
+	for i := 0; err != nil && i < attempts && out.SessionID != ""; i++ {
+		fmt.Fprintf(os.Stderr, "[WARNING] review output invalid (%v); asking Claude to repair it (%d/%d)\n", err, i+1, attempts)
+		repair := opts
+		repair.Prompt = review.RepairPrompt(err)
+		repair.ResumeSessionID = out.SessionID
+		next, runErr := runClaudeOnce(run, repair, state)
+		if runErr != nil {
+			err = fmt.Errorf("repair run: %w", runErr)
+			break
+		}
+		out = next
+		rv, err = review.Parse(out.Result)
 	}
-	if prompt, ok := in["prompt"].(string); ok && prompt != "" {
-		return fmt.Sprintf("prompt=%s", truncateString(prompt, 120))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] no valid structured review: %v\n", err)
+		state.SetTaskData(opts.TaskID, "reviewError", err.Error())
+		return nil, out
 	}
-	return ""
+	state.SetTaskData(opts.TaskID, "review", rv)
+	fmt.Printf("[INFO] Review: %s with %d finding(s)\n", rv.Verdict, len(rv.Findings))
+	return rv, out
 }
 
-func truncateString(s string, max int) string {
-	if utf8.RuneCountInString(s) <= max {
-		return s
+// resultStats are the stats of final, false when the run ended without a
+// result event.
+func resultStats(final *claude.Event) (claude.Stats, bool) {
+	if final == nil {
+		return claude.Stats{}, false
 	}
-	rs := []rune(s)
-	if len(rs) > max {
-		return string(rs[:max]) + "…"
+	return claude.StatsFromResult(*final)
+}
+
+// claudeRequest is the request a run with opts sends to the backend.
+func claudeRequest(opts StreamOptions) claude.Request {
+	req := claude.Request{
+		Prompt:          opts.Prompt,
+		Dir:             opts.RepoDir,
+		AllowedTools:    opts.AllowedTools,
+		DisallowedTools: opts.DisallowedTools,
+		PermissionMode:  opts.PermissionMode,
+		ResumeSessionID: opts.ResumeSessionID,
+		MaxTurns:        opts.Limits.MaxTurns,
+	}
+	// Use central MCP config if present.
+	mcpCfg := filepath.Join(opts.HomeDir, ".mcp.json")
+	if st, err := os.Stat(mcpCfg); err == nil && !st.IsDir() {
+		req.MCPConfigPath = mcpCfg
 	}
-	return s
+	return req
 }
 
-// truncateLongStrings walks an arbitrary JSON-like structure and truncates long string values.
-func truncateLongStrings(v any, max int) any {
-	switch t := v.(type) {
-	case string:
-		if utf8.RuneCountInString(t) > max {
-			// Ensure we do not cut in the middle of a rune
-			rs := []rune(t)
-			if len(rs) > max {
-				return string(rs[:max]) + "… (truncated)"
-			}
+// BackendFromEnv selects the Claude backend from CLAUDE_BACKEND: "cli"
+// (default) runs the claude binary, "api" calls the Messages API directly
+// using ANTHROPIC_API_KEY, ANTHROPIC_BASE_URL and CLAUDE_MODEL.
+func BackendFromEnv() (claude.Backend, error) {
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("CLAUDE_BACKEND"))); name {
+	case "", "cli":
+		return claude.NewCLIBackend(), nil
+	case "api":
+		key := os.Getenv("ANTHROPIC_API_KEY")
+		if key == "" {
+			return nil, errors.New("CLAUDE_BACKEND=api requires ANTHROPIC_API_KEY")
 		}
-		return t
-	case []any:
-		out := make([]any, len(t))
-		for i := range t {
-			out[i] = truncateLongStrings(t[i], max)
+		b := claude.NewAPIBackend(key)
+		if u := os.Getenv("ANTHROPIC_BASE_URL"); u != "" {
+			b.BaseURL = u
 		}
-		return out
-	case map[string]any:
-		out := make(map[string]any, len(t))
-		for k, val := range t {
-			out[k] = truncateLongStrings(val, max)
+		if m := os.Getenv("CLAUDE_MODEL"); m != "" {
+			b.Model = m
 		}
-		return out
+		return b, nil
 	default:
-		return v
+		return nil, fmt.Errorf("unknown CLAUDE_BACKEND %q", name)
 	}
 }
 
-func mustPrettyJSON(v any) string {
-	b, err := json.MarshalIndent(v, "", "  ")
-	if err == nil {
-		return string(b)
-	}
-	// Fallback best-effort: try to indent raw bytes if already JSON
-	if bb, ok := v.([]byte); ok {
-		var buf bytes.Buffer
-		if json.Indent(&buf, bb, "", "  ") == nil {
-			return buf.String()
+// LimitsFromEnv reads execution limits: CLAUDE_TIMEOUT (a duration such as
+// "30m", or seconds), CLAUDE_MAX_TURNS, CLAUDE_MAX_TOOL_CALLS,
+// CLAUDE_MAX_TOKENS and CLAUDE_MAX_COST_USD. Unset means unlimited.
+func LimitsFromEnv() (claude.Limits, error) {
+	var l claude.Limits
+	if v := strings.TrimSpace(os.Getenv("CLAUDE_TIMEOUT")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			secs, serr := strconv.Atoi(v)
+			if serr != nil {
+				return l, fmt.Errorf("CLAUDE_TIMEOUT: %w", err)
+			}
+			d = time.Duration(secs) * time.Second
+		}
+		l.Timeout = d
+	}
+	ints := []struct {
+		env string
+		dst *int
+	}{{"CLAUDE_MAX_TURNS", &l.MaxTurns}, {"CLAUDE_MAX_TOOL_CALLS", &l.MaxToolCalls}}
+	for _, e := range ints {
+		if v := strings.TrimSpace(os.Getenv(e.env)); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return l, fmt.Errorf("%s: invalid value %q", e.env, v)
+			}
+			*e.dst = n
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("CLAUDE_MAX_TOKENS")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("CLAUDE_MAX_TOKENS: invalid value %q", v)
 		}
-		return string(bb)
+		l.MaxTokens = n
+	}
+	if v := strings.TrimSpace(os.Getenv("CLAUDE_MAX_COST_USD")); v != "" {
+		f, err := strconv.ParseFloat(strings.TrimPrefix(v, "$"), 64)
+		if err != nil || f < 0 {
+			return l, fmt.Errorf("CLAUDE_MAX_COST_USD: invalid value %q", v)
+		}
+		l.MaxCostUSD = f
+	}
+	return l, nil
+}
+
+// RetryPolicyFromEnv reads how transient failures are retried:
+// CLAUDE_RETRIES (default 2, 0 disables), CLAUDE_RETRY_DELAY (first delay,
+// default 10s) and CLAUDE_RETRY_MAX_DELAY (default 2m).
+func RetryPolicyFromEnv() (claude.RetryPolicy, error) {
+	p := claude.RetryPolicy{MaxRetries: 2, BaseDelay: 10 * time.Second, MaxDelay: 2 * time.Minute}
+	if v := strings.TrimSpace(os.Getenv("CLAUDE_RETRIES")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("CLAUDE_RETRIES: invalid value %q", v)
+		}
+		p.MaxRetries = n
+	}
+	durations := []struct {
+		env string
+		dst *time.Duration
+	}{{"CLAUDE_RETRY_DELAY", &p.BaseDelay}, {"CLAUDE_RETRY_MAX_DELAY", &p.MaxDelay}}
+	for _, e := range durations {
+		if v := strings.TrimSpace(os.Getenv(e.env)); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return p, fmt.Errorf("%s: invalid value %q", e.env, v)
+			}
+			*e.dst = d
+		}
+	}
+	return p, nil
+}
+
+func usageFromStats(s claude.Stats) taskstate.Usage {
+	return taskstate.Usage{
+		InputTokens:         s.InputTokens,
+		OutputTokens:        s.OutputTokens,
+		CacheCreationTokens: s.CacheCreationTokens,
+		CacheReadTokens:     s.CacheReadTokens,
+		CostUSD:             s.CostUSD,
+		NumTurns:            s.NumTurns,
+		DurationMS:          s.DurationMS,
+		DurationAPIMS:       s.DurationAPIMS,
+	}
+}
+
+// streamRenderer builds the renderers selected by CSCC_STREAM_FORMAT, a
+// comma-separated list such as "concise,markdown:/tmp/run.md". Terminal
+// output is only produced in debug mode (defaulting to concise); outputs with
+// a file path are always written, to a file per task (taskOutputPath).
+func streamRenderer(debug bool, taskID string) claude.Renderer {
+	spec := strings.TrimSpace(os.Getenv("CSCC_STREAM_FORMAT"))
+	if spec == "" && debug {
+		spec = claude.FormatConcise
+	}
+	var stdout io.Writer
+	if debug {
+		stdout = os.Stdout
+	}
+	r, err := claude.ParseRenderersFor(spec, stdout, func(p string) string { return taskOutputPath(p, taskID) })
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] CSCC_STREAM_FORMAT: %v\n", err)
+		return claude.MultiRenderer()
+	}
+	return r
+}
+
+// taskOutputPath puts taskID in front of the extension of path, so that
+// tasks running at once do not share an output file: /tmp/run.md becomes
+// /tmp/run-<task>.md.
+func taskOutputPath(path, taskID string) string {
+	if taskID == "" {
+		return path
 	}
-	// Last resort: string format
-	return fmt.Sprintf("%v", v)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + safeFileComponent(taskID) + ext
 }
@@ -0,0 +1,510 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// newStreamEnv prepares a home dir, repo dir and a state with one in-progress task.
+func newStreamEnv(t *testing.T) (homeDir, repoDir string, mgr *taskstate.Manager) {
+	t.Helper()
+	tmp := t.TempDir()
+	homeDir = filepath.Join(tmp, "home")
+	repoDir = filepath.Join(tmp, "repo")
+	for _, d := range []string{homeDir, repoDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	mgr = taskstate.NewManager(filepath.Join(tmp, "state.json"))
+	mgr.Enqueue(taskstate.Task{ID: "t1"})
+	mgr.StartNext()
+	return homeDir, repoDir, mgr
+}
+
+func TestRunClaudeStream_LinksSessionAndRecordsRun(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-abc"))
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	if err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review this", AllowedTools: []string{"Read", "Grep"}, DisallowedTools: []string{"Task"}}, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	hist := mgr.GetState().History
+	if len(hist) != 1 || hist[0].SessionID != "sess-abc" {
+		t.Fatalf("session not linked: %+v", hist)
+	}
+	if hist[0].Usage == nil || hist[0].Usage.InputTokens != 10 || hist[0].Usage.CostUSD != 0.01 {
+		t.Fatalf("usage not recorded: %+v", hist[0].Usage)
+	}
+	if p := hist[0].DataString("transcript"); !strings.HasSuffix(p, "t1-sess-abc.jsonl") {
+		t.Fatalf("unexpected transcript path %q", p)
+	}
+	b, err := os.ReadFile(filepath.Join(homeDir, "session.json"))
+	if err != nil || !strings.Contains(string(b), "sess-abc") {
+		t.Fatalf("session.json not written: %v %s", err, b)
+	}
+
+	invs := fakeclaude.Invocations(t, rec)
+	if len(invs) != 1 {
+		t.Fatalf("expected one invocation, got %d", len(invs))
+	}
+	inv := invs[0]
+	if inv.Prompt != "review this" || inv.PermissionMode != "default" || inv.OutputFormat != "stream-json" {
+		t.Fatalf("unexpected invocation: %+v", inv)
+	}
+	if strings.Join(inv.AllowedTools, ",") != "Read,Grep" || strings.Join(inv.DisallowedTools, ",") != "Task" {
+		t.Fatalf("unexpected tool flags: allowed=%v disallowed=%v", inv.AllowedTools, inv.DisallowedTools)
+	}
+	if len(inv.MCPConfig) != 0 {
+		t.Fatalf("expected no --mcp-config without ~/.mcp.json, got %v", inv.MCPConfig)
+	}
+}
+
+func TestRunClaudeStream_PassesMCPConfig(t *testing.T) {
+	rec := fakeclaude.Setup(t)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+	cmdDir := t.TempDir()
+	mcp := `{"mcpServers":{"github":{"command":"gh-mcp"}}}`
+	if err := os.WriteFile(filepath.Join(cmdDir, "external_mcp.txt"), []byte(mcp), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCentralMCPConfig(cmdDir, homeDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "x", PermissionMode: "acceptEdits"}, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	inv := fakeclaude.Invocations(t, rec)[0]
+	if len(inv.MCPConfig) != 1 || inv.MCPConfig[0] != filepath.Join(homeDir, ".mcp.json") {
+		t.Fatalf("unexpected --mcp-config: %v", inv.MCPConfig)
+	}
+	var got map[string]map[string]any
+	if err := json.Unmarshal(inv.MCPConfigJSON, &got); err != nil || got["mcpServers"]["github"] == nil {
+		t.Fatalf("mcp config content not passed through: %v %s", err, inv.MCPConfigJSON)
+	}
+	if inv.PermissionMode != "acceptEdits" || len(inv.AllowedTools) != 0 {
+		t.Fatalf("unexpected invocation: %+v", inv)
+	}
+}
+
+func TestRunClaudeStream_NonZeroExit(t *testing.T) {
+	fakeclaude.Setup(t, fakeclaude.Script{
+		Steps:    []fakeclaude.Step{{Line: "not json"}, {Stderr: "API Error: boom"}},
+		ExitCode: 3,
+	})
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "x"}, mgr)
+	var te *TaskError
+	if !errors.As(err, &te) || te.Kind != FailureClaude || te.ExitCode != 3 {
+		t.Fatalf("expected claude_failed with exit code 3, got %v", err)
+	}
+	h := mgr.GetState().History[0]
+	if h.Status != string(FailureClaude) || h.ExitCode != 3 || !strings.Contains(h.Error, "API Error: boom") {
+		t.Fatalf("failure not recorded on task: %+v", h)
+	}
+	if ExitCode(err) != 13 {
+		t.Fatalf("unexpected process exit code %d", ExitCode(err))
+	}
+}
+
+func TestRunClaudeStream_ErrorResultWithCleanExit(t *testing.T) {
+	errResult := func(subtype, text string) fakeclaude.Script {
+		s := fakeclaude.DefaultScript("sess-e")
+		s.Steps[len(s.Steps)-1] = fakeclaude.Step{Event: fakeclaude.Event(map[string]any{
+			"type": "result", "subtype": subtype, "is_error": true, "session_id": "sess-e", "num_turns": 1, "result": text,
+		})}
+		return s
+	}
+	for _, script := range []fakeclaude.Script{
+		errResult("success", "Invalid API key · Please run /login"),
+		errResult("error_max_turns", ""),
+	} {
+		rec := fakeclaude.Setup(t, script)
+		homeDir, repoDir, mgr := newStreamEnv(t)
+		err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "x", Retry: claude.RetryPolicy{MaxRetries: 2}}, mgr)
+		var te *TaskError
+		if !errors.As(err, &te) || te.Kind != FailureClaude {
+			t.Fatalf("expected claude_failed, got %v", err)
+		}
+		if h := mgr.GetState().History[0]; h.Status != string(FailureClaude) {
+			t.Fatalf("an error result must not end the task done: %+v", h)
+		}
+		if n := len(fakeclaude.Invocations(t, rec)); n != 1 {
+			t.Fatalf("a permanent error should not be retried, got %d runs", n)
+		}
+	}
+}
+
+func TestRunClaudeStream_ClaudeNotFound(t *testing.T) {
+	homeDir, repoDir, mgr := newStreamEnv(t)
+	backend := &claude.CLIBackend{Path: filepath.Join(t.TempDir(), "no-such-claude")}
+
+	err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "x", Backend: backend}, mgr)
+	if ExitCode(err) != 12 {
+		t.Fatalf("expected claude_not_found exit code 12, got %d (%v)", ExitCode(err), err)
+	}
+	if h := mgr.GetState().History[0]; h.Status != string(FailureClaudeNotFound) || h.Error == "" {
+		t.Fatalf("failure not recorded on task: %+v", h)
+	}
+}
+
+func TestRunClaudeStream_WritesFilesInRepo(t *testing.T) {
+	script := fakeclaude.DefaultScript("s")
+	script.Steps = append([]fakeclaude.Step{{WriteFile: &fakeclaude.FileWrite{Path: "out/notes.md", Content: "hi"}}}, script.Steps...)
+	rec := fakeclaude.Setup(t, script)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	if err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "x"}, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(repoDir, "out", "notes.md")); err != nil || string(b) != "hi" {
+		t.Fatalf("side effect not applied in repo dir: %v %q", err, b)
+	}
+	if dir := fakeclaude.Invocations(t, rec)[0].Dir; dir != repoDir {
+		t.Fatalf("claude ran in %q, want %q", dir, repoDir)
+	}
+}
+
+func TestRunClaudeStream_ResumesSession(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-new"))
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	opts := StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "please re-check", ResumeSessionID: "sess-old"}
+	if err := RunClaudeStream(context.Background(), opts, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	invs := fakeclaude.Invocations(t, rec)
+	if len(invs) != 1 || invs[0].Resume != "sess-old" || invs[0].Prompt != "please re-check" {
+		t.Fatalf("unexpected invocations: %+v", invs)
+	}
+	h := mgr.GetState().History[0]
+	if h.SessionID != "sess-new" || h.DataString("resumedFrom") != "sess-old" {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+}
+
+func TestRunClaudeStream_ResumeFallsBackToFreshSession(t *testing.T) {
+	rec := fakeclaude.Setup(t,
+		fakeclaude.Script{Steps: []fakeclaude.Step{{Stderr: "No conversation found with session ID: sess-gone"}}, ExitCode: 1},
+		fakeclaude.DefaultScript("sess-fresh"),
+	)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	opts := StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "follow up", ResumeSessionID: "sess-gone"}
+	if err := RunClaudeStream(context.Background(), opts, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	invs := fakeclaude.Invocations(t, rec)
+	if len(invs) != 2 || invs[0].Resume != "sess-gone" || invs[1].Resume != "" {
+		t.Fatalf("expected a resume attempt then a fresh run, got %+v", invs)
+	}
+	h := mgr.GetState().History[0]
+	if h.SessionID != "sess-fresh" || h.Data["resumeFallback"] != true {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+}
+
+// resultScript is a one-turn run whose result event carries text.
+func resultScript(sessionID, text string) fakeclaude.Script {
+	s := fakeclaude.DefaultScript(sessionID)
+	s.Steps[len(s.Steps)-1] = fakeclaude.Step{Event: fakeclaude.Event(map[string]any{
+		"type": "result", "subtype": "success", "session_id": sessionID, "num_turns": 1, "total_cost_usd": 0.01,
+		"result": text, "usage": map[string]any{"input_tokens": 10, "output_tokens": 5},
+	})}
+	return s
+}
+
+func TestRunClaudeStream_StructuredReviewWithRepair(t *testing.T) {
+	rec := fakeclaude.Setup(t,
+		resultScript("sess-r", "Looks good to me!"),
+		resultScript("sess-r", "```json\n{\"summary\":\"Fine\",\"verdict\":\"approve\",\"findings\":[]}\n```"),
+	)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+	t.Setenv("CSCC_STREAM_FORMAT", "raw:"+filepath.Join(homeDir, "run.jsonl"))
+
+	opts := StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", StructuredReview: true}
+	if err := RunClaudeStream(context.Background(), opts, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	invs := fakeclaude.Invocations(t, rec)
+	if len(invs) != 2 {
+		t.Fatalf("expected initial run plus one repair, got %d", len(invs))
+	}
+	if !strings.Contains(invs[0].Prompt, `"verdict"`) {
+		t.Fatalf("prompt should carry the review schema: %q", invs[0].Prompt)
+	}
+	if invs[1].Resume != "sess-r" || !strings.Contains(invs[1].Prompt, "did not contain a valid review") {
+		t.Fatalf("unexpected repair invocation: %+v", invs[1])
+	}
+	h := mgr.GetState().History[0]
+	if _, ok := h.Data["review"]; !ok {
+		t.Fatalf("expected review on task: %+v", h.Data)
+	}
+	if _, ok := h.Data["resumedFrom"]; ok {
+		t.Fatalf("a repair resumes the task's own session, not an earlier one: %+v", h.Data)
+	}
+	if h.Usage == nil || h.Usage.NumTurns != 2 {
+		t.Fatalf("expected usage accumulated over both runs: %+v", h.Usage)
+	} // The repair adds to the task's stream file rather than replacing it
+	b, err := os.ReadFile(filepath.Join(homeDir, "run-t1.jsonl"))
+	if err != nil || strings.Count(string(b), `"type":"result"`) != 2 {
+		t.Fatalf("expected both runs in the task's stream file: %v\n%s", err, b)
+	}
+}
+
+func TestRunClaudeStream_RecordsToolAudit(t *testing.T) {
+	ev := fakeclaude.Event
+	fakeclaude.Setup(t, fakeclaude.Script{Steps: []fakeclaude.Step{
+		{Event: ev(map[string]any{"type": "system", "subtype": "init", "session_id": "sess-t"})},
+		{Event: ev(map[string]any{"type": "assistant", "session_id": "sess-t", "message": map[string]any{"role": "assistant", "content": []any{
+			map[string]any{"type": "tool_use", "id": "tu1", "name": "Bash", "input": map[string]any{"command": "gh pr view 7 --json files"}},
+		}}})},
+		{Event: ev(map[string]any{"type": "user", "session_id": "sess-t", "message": map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "tool_result", "tool_use_id": "tu1", "is_error": true, "content": "Claude requested permissions to use Bash, but you haven't granted it yet."},
+		}}})},
+		{Event: ev(map[string]any{"type": "result", "subtype": "success", "session_id": "sess-t", "num_turns": 2, "total_cost_usd": 0.02})},
+	}})
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	if err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review"}, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	h := mgr.GetState().History[0]
+	b, _ := json.Marshal(h.Data["toolAudit"])
+	var report claude.AuditReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.BlockedTools["Bash"] != 1 || strings.Join(report.SuggestedAllow, ",") != "Bash(gh pr view:*)" {
+		t.Fatalf("unexpected audit: %+v", report)
+	}
+	log, err := os.ReadFile(h.DataString("toolCalls"))
+	if err != nil || !strings.Contains(string(log), `"denied":true`) {
+		t.Fatalf("tool log not written: %v %s", err, log)
+	}
+}
+
+func TestRunClaudeStream_TimeoutKillsRun(t *testing.T) {
+	s := fakeclaude.DefaultScript("sess-slow")
+	s.Steps = append([]fakeclaude.Step{s.Steps[0], {SleepMS: 30000}}, s.Steps[1:]...)
+	fakeclaude.Setup(t, s)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	start := time.Now()
+	err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", Limits: claude.Limits{Timeout: 300 * time.Millisecond}}, mgr)
+	var le *claude.LimitError
+	if !errors.As(err, &le) || le.Kind != claude.LimitTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("run was not killed promptly: %s", elapsed)
+	}
+	h := mgr.GetState().History[0]
+	if h.Status != claude.StatusTimedOut || h.SessionID != "sess-slow" {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+}
+
+func TestRunClaudeStream_ToolCallBudget(t *testing.T) {
+	ev := fakeclaude.Event
+	var steps []fakeclaude.Step
+	steps = append(steps, fakeclaude.Step{Event: ev(map[string]any{"type": "system", "subtype": "init", "session_id": "sess-b"})})
+	for i := 0; i < 5; i++ {
+		steps = append(steps, fakeclaude.Step{Event: ev(map[string]any{"type": "assistant", "session_id": "sess-b", "message": map[string]any{
+			"id": fmt.Sprintf("m%d", i), "role": "assistant", "model": "claude-sonnet-4-5",
+			"content": []any{map[string]any{"type": "tool_use", "id": fmt.Sprintf("tu%d", i), "name": "Read", "input": map[string]any{"file_path": "a.go"}}},
+			"usage":   map[string]any{"input_tokens": 1000, "output_tokens": 100},
+		}})})
+	}
+	steps = append(steps, fakeclaude.Step{Event: ev(map[string]any{"type": "result", "subtype": "success", "session_id": "sess-b", "total_cost_usd": 1.0})})
+	rec := fakeclaude.Setup(t, fakeclaude.Script{Steps: steps})
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", Limits: claude.Limits{MaxToolCalls: 2, MaxTurns: 10}}, mgr)
+	var le *claude.LimitError
+	if !errors.As(err, &le) || le.Kind != claude.LimitToolCalls {
+		t.Fatalf("expected tool call limit, got %v", err)
+	}
+	h := mgr.GetState().History[0]
+	if h.Status != claude.StatusBudgetExceeded || h.Data["limit"] == nil {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+	// Three messages were seen before the kill; their usage is still accounted.
+	if h.Usage == nil || h.Usage.InputTokens != 3000 || h.Usage.CostUSD == 0 {
+		t.Fatalf("expected live usage recorded: %+v", h.Usage)
+	}
+	if invs := fakeclaude.Invocations(t, rec); invs[0].MaxTurns != 10 {
+		t.Fatalf("expected --max-turns 10, got %d", invs[0].MaxTurns)
+	}
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	t.Setenv("CLAUDE_TIMEOUT", "90")
+	t.Setenv("CLAUDE_MAX_TURNS", "40")
+	t.Setenv("CLAUDE_MAX_COST_USD", "$2.50")
+	l, err := LimitsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Timeout != 90*time.Second || l.MaxTurns != 40 || l.MaxCostUSD != 2.5 || l.MaxToolCalls != 0 {
+		t.Fatalf("unexpected limits: %+v", l)
+	}
+	t.Setenv("CLAUDE_MAX_TOKENS", "lots")
+	if _, err := LimitsFromEnv(); err == nil {
+		t.Fatal("expected error for invalid CLAUDE_MAX_TOKENS")
+	}
+}
+
+func TestRunClaudeStream_RecordsSubagents(t *testing.T) {
+	ev := fakeclaude.Event
+	fakeclaude.Setup(t, fakeclaude.Script{Steps: []fakeclaude.Step{
+		{Event: ev(map[string]any{"type": "system", "subtype": "init", "session_id": "sess-sa", "model": "claude-sonnet-4-5"})},
+		{Event: ev(map[string]any{"type": "assistant", "session_id": "sess-sa", "message": map[string]any{"id": "m1", "role": "assistant", "content": []any{
+			map[string]any{"type": "tool_use", "id": "task1", "name": "Task", "input": map[string]any{"subagent_type": "reviewer", "prompt": "check"}},
+		}}})},
+		{Event: ev(map[string]any{"type": "assistant", "session_id": "sess-sa", "parent_tool_use_id": "task1", "message": map[string]any{"id": "m2", "role": "assistant", "content": []any{
+			map[string]any{"type": "tool_use", "id": "r1", "name": "Read", "input": map[string]any{"file_path": "a.go"}},
+		}}})},
+		{Event: ev(map[string]any{"type": "user", "session_id": "sess-sa", "message": map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "tool_result", "tool_use_id": "task1", "content": "done"},
+		}}})},
+		{Event: ev(map[string]any{"type": "result", "subtype": "success", "session_id": "sess-sa", "num_turns": 2, "total_cost_usd": 0.02})},
+	}})
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	if err := RunClaudeStream(context.Background(), StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review"}, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	b, _ := json.Marshal(mgr.GetState().History[0].Data["subagents"])
+	var agents []claude.AgentRun
+	if err := json.Unmarshal(b, &agents); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Subagent != "reviewer" || !agents[0].Completed || agents[0].ToolCalls != 1 {
+		t.Fatalf("unexpected subagents: %s", b)
+	}
+}
+
+func TestRunClaudeStream_CancelMarksInterrupted(t *testing.T) {
+	s := fakeclaude.DefaultScript("sess-int")
+	s.Steps = append([]fakeclaude.Step{s.Steps[0], {SleepMS: 30000}}, s.Steps[1:]...)
+	fakeclaude.Setup(t, s)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+	start := time.Now()
+	err := RunClaudeStream(ctx, StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", Limits: claude.Limits{Timeout: time.Hour}}, mgr)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("run was not killed promptly: %s", elapsed)
+	}
+	// State must be flushed to disk with the task marked interrupted.
+	saved, err := taskstate.Load(mgr.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := saved.GetState()
+	if st.Current != nil || len(st.History) != 1 || st.History[0].Status != taskstate.StatusInterrupted {
+		t.Fatalf("unexpected saved state: %+v", st)
+	}
+}
+
+func TestRunClaudeStream_RetriesTransientFailureInSameSession(t *testing.T) {
+	overloaded := fakeclaude.Script{Steps: []fakeclaude.Step{
+		{Event: fakeclaude.Event(map[string]any{"type": "system", "subtype": "init", "session_id": "sess-1"})},
+		{Stderr: `API Error: 529 {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+	}, ExitCode: 1}
+	rec := fakeclaude.Setup(t, overloaded, fakeclaude.DefaultScript("sess-1"))
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	opts := StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", Retry: claude.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}}
+	if err := RunClaudeStream(context.Background(), opts, mgr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	invs := fakeclaude.Invocations(t, rec)
+	if len(invs) != 2 || invs[1].Resume != "sess-1" || invs[1].Prompt != retryPrompt {
+		t.Fatalf("expected a retry resuming sess-1, got %+v", invs)
+	}
+	h := mgr.GetState().History[0]
+	attempts, _ := h.Data["attempts"].([]attempt)
+	if h.Status != taskstate.StatusDone || len(attempts) != 2 {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+	if a := attempts[0]; a.Reason != claude.ReasonOverloaded || a.Error == "" || a.SessionID != "sess-1" {
+		t.Fatalf("unexpected first attempt: %+v", a)
+	}
+	if a := attempts[1]; !a.Resumed || a.Error != "" {
+		t.Fatalf("unexpected second attempt: %+v", a)
+	}
+}
+
+func TestRunClaudeStream_RetriesErrorResult(t *testing.T) {
+	rateLimited := resultScript("sess-1", "API Error: 429 rate_limit_error")
+	rateLimited.Steps[len(rateLimited.Steps)-1] = fakeclaude.Step{Event: fakeclaude.Event(map[string]any{
+		"type": "result", "subtype": "success", "is_error": true, "session_id": "sess-1", "result": "API Error: 429 rate_limit_error",
+	})}
+	rec := fakeclaude.Setup(t, rateLimited, rateLimited)
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	opts := StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", Retry: claude.RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}}
+	err := RunClaudeStream(context.Background(), opts, mgr)
+	var te *TaskError
+	if !errors.As(err, &te) || te.Kind != FailureClaude {
+		t.Fatalf("expected claude_failed after retries, got %v", err)
+	}
+	if invs := fakeclaude.Invocations(t, rec); len(invs) != 2 {
+		t.Fatalf("expected one retry, got %d runs", len(invs))
+	}
+	if attempts, _ := mgr.GetState().History[0].Data["attempts"].([]attempt); len(attempts) != 2 || attempts[1].Reason != claude.ReasonRateLimited {
+		t.Fatalf("unexpected attempts: %+v", attempts)
+	}
+}
+
+func TestRunClaudeStream_DoesNotRetryPermanentFailure(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.Script{Steps: []fakeclaude.Step{{Stderr: "Invalid API key · Please run /login"}}, ExitCode: 1})
+	homeDir, repoDir, mgr := newStreamEnv(t)
+
+	opts := StreamOptions{HomeDir: homeDir, RepoDir: repoDir, Prompt: "review", Retry: claude.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}}
+	if err := RunClaudeStream(context.Background(), opts, mgr); err == nil {
+		t.Fatal("expected failure")
+	}
+	if invs := fakeclaude.Invocations(t, rec); len(invs) != 1 {
+		t.Fatalf("permanent failure was retried: %d runs", len(invs))
+	}
+}
+
+func TestRetryPolicyFromEnv(t *testing.T) {
+	t.Setenv("CLAUDE_RETRIES", "")
+	t.Setenv("CLAUDE_RETRY_DELAY", "")
+	t.Setenv("CLAUDE_RETRY_MAX_DELAY", "")
+	if p, err := RetryPolicyFromEnv(); err != nil || p.MaxRetries != 2 || p.BaseDelay != 10*time.Second {
+		t.Fatalf("unexpected default policy %+v (%v)", p, err)
+	}
+	t.Setenv("CLAUDE_RETRIES", "0")
+	t.Setenv("CLAUDE_RETRY_DELAY", "1s")
+	if p, err := RetryPolicyFromEnv(); err != nil || p.MaxRetries != 0 || p.BaseDelay != time.Second {
+		t.Fatalf("unexpected policy %+v (%v)", p, err)
+	}
+	t.Setenv("CLAUDE_RETRIES", "-1")
+	if _, err := RetryPolicyFromEnv(); err == nil {
+		t.Fatal("expected negative CLAUDE_RETRIES to be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// FailureKind classifies why a task failed. It is stored as the task status.
+type FailureKind string
+
+const (
+	FailureClone          FailureKind = "clone_failed"
+	FailureAuth           FailureKind = "auth_failed"
+	FailureClaudeNotFound FailureKind = "claude_not_found"
+	// FailureClaude is a claude run that exited non-zero or errored.
+	FailureClaude         FailureKind = "claude_failed"
+	FailureTimeout        FailureKind = claude.StatusTimedOut
+	FailureBudgetExceeded FailureKind = claude.StatusBudgetExceeded
+	// FailurePublish is a run whose result could not be posted or pushed.
+	FailurePublish     FailureKind = "publish_failed"
+	FailureInterrupted FailureKind = taskstate.StatusInterrupted
+	// FailureOther is anything unclassified (bad config, missing repo dir, ...).
+	FailureOther FailureKind = "failed"
+)
+
+// Process exit codes of `worker run` for each failure kind, so the host can
+// tell them apart. 23 is kept for failures outside a task (config, state).
+var exitCodes = map[FailureKind]int{
+	FailureClone:          10,
+	FailureAuth:           11,
+	FailureClaudeNotFound: 12,
+	FailureClaude:         13,
+	FailureTimeout:        14,
+	FailureBudgetExceeded: 15,
+	FailurePublish:        16,
+	FailureOther:          23,
+	FailureInterrupted:    130,
+}
+
+// TaskError is a classified task failure. ExitCode is claude's own exit
+// code when it exited non-zero, otherwise 0. Hooks such as Runner.Prepare
+// and StreamOptions.Finish fail the task by returning an error; returning a
+// *TaskError sets its kind, anything else is classified by ClassifyError.
+type TaskError struct {
+	Kind     FailureKind
+	ExitCode int
+	Err      error
+}
+
+func (e *TaskError) Error() string { return string(e.Kind) + ": " + e.Err.Error() }
+
+func (e *TaskError) Unwrap() error { return e.Err }
+
+// ClassifyError turns err into a *TaskError. Errors that are already
+// classified are returned as is; nil stays nil.
+func ClassifyError(err error) *TaskError {
+	if err == nil {
+		return nil
+	}
+	var te *TaskError
+	if errors.As(err, &te) {
+		return te
+	}
+	te = &TaskError{Kind: FailureOther, Err: err}
+	var limit *claude.LimitError
+	var exitErr *claude.ExitError
+	switch {
+	case errors.Is(err, context.Canceled):
+		te.Kind = FailureInterrupted
+	case errors.As(err, &limit):
+		te.Kind = FailureKind(limit.Status())
+	case errors.Is(err, context.DeadlineExceeded):
+		te.Kind = FailureTimeout
+	case errors.Is(err, claude.ErrCLINotFound):
+		te.Kind = FailureClaudeNotFound
+	case errors.As(err, &exitErr):
+		te.Kind = FailureClaude
+		te.ExitCode = exitErr.ExitCode()
+	default:
+		var apiErr *claude.APIError
+		var resErr *claude.ResultError
+		if errors.As(err, &apiErr) || errors.As(err, &resErr) {
+			te.Kind = FailureClaude
+		}
+	}
+	return te
+}
+
+// ExitCode maps a worker error to the process exit code of `worker run`:
+// 0 for nil, the code of its failure kind otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCodes[ClassifyError(err).Kind]
+}
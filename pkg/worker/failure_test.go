@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want FailureKind
+		code int
+	}{
+		{fmt.Errorf("claude run interrupted: %w", context.Canceled), FailureInterrupted, 130},
+		{&claude.LimitError{Kind: claude.LimitTimeout}, FailureTimeout, 14},
+		{&claude.LimitError{Kind: claude.LimitCost}, FailureBudgetExceeded, 15},
+		{fmt.Errorf("%w: exec: not found", claude.ErrCLINotFound), FailureClaudeNotFound, 12},
+		{&claude.APIError{StatusCode: 500}, FailureClaude, 13},
+		{errors.New("repoDir not found"), FailureOther, 23},
+	}
+	for _, c := range cases {
+		if got := ClassifyError(c.err); got.Kind != c.want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", c.err, got.Kind, c.want)
+		}
+		if got := ExitCode(c.err); got != c.code {
+			t.Errorf("ExitCode(%v) = %d, want %d", c.err, got, c.code)
+		}
+	}
+	if ClassifyError(nil) != nil || ExitCode(nil) != 0 {
+		t.Fatal("nil error should not be classified")
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	if !isAuthFailure("gh repo clone: exit status 1: To get started with GitHub CLI, please run: gh auth login") {
+		t.Fatal("expected gh login prompt to be an auth failure")
+	}
+	if isAuthFailure("git checkout: exit status 1: error: pathspec 'nope' did not match") {
+		t.Fatal("unknown branch is not an auth failure")
+	}
+}
@@ -0,0 +1,326 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/your-org/claude-dev-setup/pkg/github"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// Task.Data keys set by fix mode.
+const (
+	DataCommit    = "commit"
+	DataPushedTo  = "pushedTo"
+	DataNoChanges = "noChanges"
+	DataPRURL     = "prUrl"
+	// DataPRAction is "opened", "updated" or "pushed" (an existing PR got
+	// the new commit).
+	DataPRAction = "prAction"
+)
+
+// fixBranchPrefix names the branches fix mode creates when a task has no
+// PR branch.
+const fixBranchPrefix = "claude/"
+
+const defaultFixMessage = "Apply fixes from Claude ({{.TaskID}})"
+
+// FixConfig is how fix mode commits and where it may push.
+type FixConfig struct {
+	// Author is "Name <email>"; empty keeps git's configured identity, which
+	// fix mode then requires.
+	Author string
+	// Message renders the commit message from a FixCommit.
+	Message *template.Template
+	// Protected are branch globs (path.Match) fix mode never pushes to, on
+	// top of branches GitHub reports as protected and the default branch.
+	Protected []string
+}
+
+// FixCommit is what the commit message template sees.
+type FixCommit struct {
+	TaskID   string
+	Repo     string
+	Branch   string
+	PRNumber int
+	Prompt   string
+	// Summary is the first line of Claude's final message.
+	Summary string
+	// Files are the changed paths.
+	Files []string
+}
+
+// FixConfigFromEnv reads FIX_AUTHOR ("Name <email>"), FIX_COMMIT_MESSAGE (a
+// text/template over FixCommit; the first line is the PR title) and
+// FIX_PROTECTED_BRANCHES (comma-separated globs, default "main,master").
+func FixConfigFromEnv() (FixConfig, error) {
+	cfg := FixConfig{Author: strings.TrimSpace(os.Getenv("FIX_AUTHOR"))}
+	if cfg.Author != "" {
+		if _, err := mail.ParseAddress(cfg.Author); err != nil {
+			return cfg, fmt.Errorf("FIX_AUTHOR: want \"Name <email>\": %w", err)
+		}
+	}
+	msg := os.Getenv("FIX_COMMIT_MESSAGE")
+	if strings.TrimSpace(msg) == "" {
+		msg = defaultFixMessage
+	}
+	t, err := template.New("commit").Option("missingkey=error").Parse(msg)
+	if err != nil {
+		return cfg, fmt.Errorf("FIX_COMMIT_MESSAGE: %w", err)
+	}
+	cfg.Message = t
+	protected := "main,master"
+	if v, ok := os.LookupEnv("FIX_PROTECTED_BRANCHES"); ok {
+		protected = v
+	}
+	for _, g := range strings.Split(protected, ",") {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		if _, err := path.Match(g, ""); err != nil {
+			return cfg, fmt.Errorf("FIX_PROTECTED_BRANCHES: %q: %w", g, err)
+		}
+		cfg.Protected = append(cfg.Protected, g)
+	}
+	return cfg, nil
+}
+
+func (c FixConfig) protected(branch string) bool {
+	for _, g := range c.Protected {
+		if ok, _ := path.Match(g, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fixTarget is where fix mode pushes and the PR that shows it.
+type fixTarget struct {
+	Branch string
+	// PR is the PR the branch belongs to, when known before pushing.
+	PR *github.PullRequest
+	// Own is a claude/ branch, which fix mode may overwrite.
+	Own bool
+}
+
+// pushFixes commits whatever Claude changed in the checkout and pushes it to
+// the PR branch, or to claude/<task-id> when the task has none. With a repo,
+// it then opens a PR for the branch or updates the one it already has. A
+// run without changes is recorded as Data["noChanges"] and pushes nothing.
+func (r *Runner) pushFixes(ctx context.Context, spec TaskSpec, mgr *taskstate.Manager, res RunResult) error {
+	cfg, err := FixConfigFromEnv()
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: err}
+	}
+	dir := spec.RepoDir
+	status, err := outputInDir(ctx, dir, "git", "status", "--porcelain", "--", ".", worktreeExclude)
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: err}
+	}
+	if strings.TrimSpace(status) == "" {
+		fmt.Println("[INFO] Claude made no changes; nothing to push")
+		mgr.SetTaskData(spec.TaskID, DataNoChanges, true)
+		return nil
+	}
+	target, err := r.fixTarget(ctx, spec, cfg)
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: err}
+	}
+
+	if err := runInDir(ctx, dir, "git", "add", "-A", "--", ".", worktreeExclude); err != nil {
+		return &TaskError{Kind: FailurePublish, Err: err}
+	}
+	files, err := outputInDir(ctx, dir, "git", "diff", "--cached", "--name-only")
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: err}
+	}
+	var b strings.Builder
+	err = cfg.Message.Execute(&b, FixCommit{
+		TaskID:   spec.TaskID,
+		Repo:     spec.Repo,
+		Branch:   target.Branch,
+		PRNumber: spec.PRNumber,
+		Prompt:   spec.Prompt,
+		Summary:  firstLine(res.Result),
+		Files:    strings.Fields(files),
+	})
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: fmt.Errorf("FIX_COMMIT_MESSAGE: %w", err)}
+	}
+	msg := strings.TrimSpace(b.String())
+	if msg == "" {
+		return &TaskError{Kind: FailurePublish, Err: errors.New("FIX_COMMIT_MESSAGE rendered an empty message")}
+	}
+	identity, err := commitIdentity(ctx, dir, cfg.Author)
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: err}
+	}
+	commit := append(identity, "commit", "-q", "-m", msg)
+	if cfg.Author != "" {
+		commit = append(commit, "--author", cfg.Author)
+	}
+	refspec := "HEAD:refs/heads/" + target.Branch
+	if target.Own {
+		// A rerun of the task replaces its branch
+		refspec = "+" + refspec
+	}
+	for _, args := range [][]string{commit, {"push", "origin", refspec}} {
+		if err := runInDir(ctx, dir, "git", args...); err != nil {
+			return &TaskError{Kind: FailurePublish, Err: err}
+		}
+	}
+	sha, _ := outputInDir(ctx, dir, "git", "rev-parse", "HEAD")
+	mgr.SetTaskData(spec.TaskID, DataCommit, strings.TrimSpace(sha))
+	mgr.SetTaskData(spec.TaskID, DataPushedTo, target.Branch)
+	fmt.Printf("[INFO] Pushed fixes to %s\n", target.Branch)
+	if spec.Repo == "" {
+		return nil
+	}
+	return r.publishFixPR(ctx, spec, mgr, target, msg, res)
+}
+
+// fixTarget picks the branch to push to: the task's branch, the head of its
+// PR, or claude/<task-id>. Protected branches are refused, as are PRs from
+// forks, which the worker cannot push to.
+func (r *Runner) fixTarget(ctx context.Context, spec TaskSpec, cfg FixConfig) (fixTarget, error) {
+	t := fixTarget{Branch: spec.Branch}
+	if spec.Repo != "" && spec.PRNumber > 0 {
+		pr, err := r.github().GetPullRequest(ctx, spec.Repo, spec.PRNumber)
+		if err != nil {
+			return t, fmt.Errorf("get PR #%d: %w", spec.PRNumber, err)
+		}
+		if pr.Head.Repo == nil || !strings.EqualFold(pr.Head.Repo.FullName, spec.Repo) {
+			return t, fmt.Errorf("PR #%d comes from a fork; cannot push to it", spec.PRNumber)
+		}
+		if t.Branch == "" {
+			t.Branch = pr.Head.Ref
+		}
+		if t.Branch == pr.Head.Ref {
+			t.PR = pr
+		}
+	}
+	if t.Branch == "" {
+		t.Branch = fixBranchPrefix + safeFileComponent(spec.TaskID)
+		t.Own = true
+	}
+	if cfg.protected(t.Branch) {
+		return t, fmt.Errorf("refusing to push to protected branch %s", t.Branch)
+	}
+	if spec.Repo == "" {
+		return t, nil
+	}
+	gh := r.github()
+	repo, err := gh.GetRepository(ctx, spec.Repo)
+	if err != nil {
+		return t, fmt.Errorf("get repo %s: %w", spec.Repo, err)
+	}
+	if t.Branch == repo.DefaultBranch {
+		return t, fmt.Errorf("refusing to push to default branch %s", t.Branch)
+	}
+	br, err := gh.GetBranch(ctx, spec.Repo, t.Branch)
+	var apiErr *github.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		// A new branch
+	case err != nil:
+		return t, fmt.Errorf("get branch %s: %w", t.Branch, err)
+	case br.Protected:
+		return t, fmt.Errorf("refusing to push to protected branch %s", t.Branch)
+	}
+	return t, nil
+}
+
+// publishFixPR records the PR the push went to, opening one against the
+// default branch when the branch has none. The PR of a claude/ branch gets
+// the new title and description; PRs opened by people are left as they are.
+func (r *Runner) publishFixPR(ctx context.Context, spec TaskSpec, mgr *taskstate.Manager, t fixTarget, msg string, res RunResult) error {
+	gh := r.github()
+	action := "pushed"
+	pr := t.PR
+	if pr == nil {
+		prs, err := gh.OpenPullRequests(ctx, spec.Repo, t.Branch)
+		if err != nil {
+			return &TaskError{Kind: FailurePublish, Err: fmt.Errorf("list PRs: %w", err)}
+		}
+		if len(prs) > 0 {
+			pr = &prs[0]
+		}
+	}
+	title, _, _ := strings.Cut(msg, "\n")
+	body := fixPRBody(spec, res)
+	switch {
+	case pr == nil:
+		repo, err := gh.GetRepository(ctx, spec.Repo)
+		if err == nil {
+			pr, err = gh.CreatePullRequest(ctx, spec.Repo, github.NewPullRequest{Title: title, Head: t.Branch, Base: repo.DefaultBranch, Body: body})
+		}
+		if err != nil {
+			return &TaskError{Kind: FailurePublish, Err: fmt.Errorf("open PR: %w", err)}
+		}
+		action = "opened"
+	case t.Own:
+		updated, err := gh.UpdatePullRequest(ctx, spec.Repo, pr.Number, github.PullRequestUpdate{Title: title, Body: body})
+		if err != nil {
+			return &TaskError{Kind: FailurePublish, Err: fmt.Errorf("update PR #%d: %w", pr.Number, err)}
+		}
+		pr = updated
+		action = "updated"
+	}
+	mgr.SetTaskData(spec.TaskID, DataPRURL, pr.HTMLURL)
+	mgr.SetTaskData(spec.TaskID, DataPRAction, action)
+	fmt.Printf("[INFO] PR %s#%d %s\n", spec.Repo, pr.Number, action)
+	return nil
+}
+
+func fixPRBody(spec TaskSpec, res RunResult) string {
+	body := strings.TrimSpace(res.Result)
+	if body != "" {
+		body += "\n\n"
+	}
+	return body + "---\nCommitted by the worker for task `" + spec.TaskID + "`."
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+// commitIdentity supplies a committer when the sandbox has no git identity:
+// author, which fix mode then requires.
+func commitIdentity(ctx context.Context, dir, author string) ([]string, error) {
+	if hasGitIdentity(ctx, dir) {
+		return nil, nil
+	}
+	a, err := mail.ParseAddress(author)
+	if err != nil {
+		return nil, errNoFixAuthor
+	}
+	return []string{"-c", "user.name=" + a.Name, "-c", "user.email=" + a.Address}, nil
+}
+
+var errNoFixAuthor = errors.New("fix mode needs FIX_AUTHOR or a git user.email to commit as")
+
+// hasGitIdentity reports whether git in dir, or in the global and system
+// config when dir is "", knows who commits.
+func hasGitIdentity(ctx context.Context, dir string) bool {
+	if os.Getenv("GIT_COMMITTER_EMAIL") != "" {
+		return true
+	}
+	scopes := [][]string{{"config", "user.email"}}
+	if dir == "" {
+		scopes = [][]string{{"config", "--global", "user.email"}, {"config", "--system", "user.email"}}
+	}
+	for _, args := range scopes {
+		if email, _ := outputInDir(ctx, dir, "git", args...); strings.TrimSpace(email) != "" {
+			return true
+		}
+	}
+	return false
+}
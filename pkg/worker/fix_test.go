@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/github"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// fakeRepoAPI answers "METHOD /path" with a canned response and records
+// every request; unknown routes are 404s.
+type fakeRepoAPI struct {
+	mu       sync.Mutex
+	routes   map[string]string
+	requests []string
+	bodies   map[string]map[string]any
+}
+
+func newFakeRepoAPI(t *testing.T, routes map[string]string) (*fakeRepoAPI, *github.Client) {
+	f := &fakeRepoAPI{routes: routes, bodies: map[string]map[string]any{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.requests = append(f.requests, key)
+		f.bodies[key] = body
+		res, ok := f.routes[key]
+		f.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		w.Write([]byte(res))
+	}))
+	t.Cleanup(srv.Close)
+	c := github.NewClient("tok")
+	c.BaseURL = srv.URL
+	return f, c
+}
+
+const fakeRepoJSON = `{"full_name":"org/app","default_branch":"main"}`
+
+func TestRunner_FixModeOpensThenUpdatesPR(t *testing.T) {
+	_, remote := gitRepo(t)
+	edit := func(sess, content string) fakeclaude.Script {
+		s := resultScript(sess, "Fixed the greeting\n\nDetails follow.")
+		s.Steps = append([]fakeclaude.Step{{WriteFile: &fakeclaude.FileWrite{Path: "a.txt", Content: content}}}, s.Steps...)
+		return s
+	}
+	fakeclaude.Setup(t, edit("sess-1", "one\n"), edit("sess-2", "two\n"))
+	t.Setenv("FIX_AUTHOR", "Fix Bot <fix@example.com>")
+	t.Setenv("FIX_COMMIT_MESSAGE", "fix: {{.Summary}}\n\nTask {{.TaskID}} changed {{len .Files}} file(s).")
+
+	api, client := newFakeRepoAPI(t, map[string]string{
+		"GET /repos/org/app":        fakeRepoJSON,
+		"GET /repos/org/app/pulls":  `[]`,
+		"POST /repos/org/app/pulls": `{"number":12,"html_url":"https://github.com/org/app/pull/12"}`,
+	})
+	r := NewRunner()
+	r.GitHub = client
+	r.Worktrees = NewWorktrees(t.TempDir())
+	r.Worktrees.CloneURL = func(string) string { return remote }
+	h := drainTasks(t, r, "", TaskFile{ID: "fix-pr", Prompt: "fix it", Mode: "fix", Repo: "org/app"})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone || h[0].DataString(DataPushedTo) != "claude/fix-pr" ||
+		h[0].DataString(DataPRAction) != "opened" || h[0].DataString(DataPRURL) != "https://github.com/org/app/pull/12" {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+	pr := api.bodies["POST /repos/org/app/pulls"]
+	if pr["head"] != "claude/fix-pr" || pr["base"] != "main" || pr["title"] != "fix: Fixed the greeting" ||
+		!strings.Contains(pr["body"].(string), "Details follow.") {
+		t.Fatalf("unexpected PR request: %v", pr)
+	}
+	if got := gitOutput(t, remote, "log", "-1", "--format=%an <%ae>%n%B", "claude/fix-pr"); !strings.HasPrefix(got, "Fix Bot <fix@example.com>\nfix: Fixed the greeting\n\nTask fix-pr changed 1 file(s).") {
+		t.Fatalf("unexpected commit: %s", got)
+	}
+
+	// A rerun replaces the branch and updates the PR it already has
+	api.mu.Lock()
+	api.routes["GET /repos/org/app/pulls"] = `[{"number":12,"html_url":"https://github.com/org/app/pull/12","head":{"ref":"claude/fix-pr"}}]`
+	api.routes["PATCH /repos/org/app/pulls/12"] = `{"number":12,"html_url":"https://github.com/org/app/pull/12"}`
+	api.mu.Unlock()
+	h = drainTasks(t, r, "", TaskFile{ID: "fix-pr", Prompt: "fix it again", Mode: "fix", Repo: "org/app"})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone || h[0].DataString(DataPRAction) != "updated" {
+		t.Fatalf("unexpected rerun: %+v", h)
+	}
+	if got := gitOutput(t, remote, "show", "claude/fix-pr:a.txt"); got != "two" {
+		t.Fatalf("branch not replaced: %q", got)
+	}
+	if parent, base := gitOutput(t, remote, "rev-parse", "claude/fix-pr^"), gitOutput(t, remote, "rev-parse", "main"); parent != base {
+		t.Fatalf("fix commit should sit on main, got parent %s", parent)
+	}
+}
+
+func TestRunner_FixModeRefusesProtectedBranches(t *testing.T) {
+	clone, _ := gitRepo(t)
+	edit := fakeclaude.DefaultScript("sess-p")
+	edit.Steps = append([]fakeclaude.Step{{WriteFile: &fakeclaude.FileWrite{Path: "a.txt", Content: "x\n"}}}, edit.Steps...)
+	rec := fakeclaude.Setup(t, edit)
+	t.Setenv("FIX_PROTECTED_BRANCHES", "main,release/*")
+	api, client := newFakeRepoAPI(t, map[string]string{
+		"GET /repos/org/app":               fakeRepoJSON,
+		"GET /repos/org/app/branches/prod": `{"name":"prod","protected":true}`,
+	})
+	r := NewRunner()
+	r.GitHub = client
+
+	h := drainTasks(t, r, clone,
+		TaskFile{ID: "rel", Prompt: "x", Mode: "fix", Repo: "org/app", Branch: "release/1.2"},
+		TaskFile{ID: "prod", Prompt: "x", Mode: "fix", Repo: "org/app", Branch: "prod"},
+	)
+	if len(h) != 2 || h[0].Status != string(FailureOther) || !strings.Contains(h[0].Error, "protected branch release/1.2") {
+		t.Fatalf("expected the configured branch to be refused before running: %+v", h)
+	}
+	if h[1].Status != string(FailurePublish) || !strings.Contains(h[1].Error, "protected branch prod") {
+		t.Fatalf("expected the branch GitHub protects to be refused: %+v", h[1])
+	}
+	if n := len(fakeclaude.Invocations(t, rec)); n != 1 {
+		t.Fatalf("expected only the second task to run Claude, got %d runs", n)
+	}
+	for _, req := range api.requests {
+		if strings.HasPrefix(req, "POST") {
+			t.Fatalf("nothing should be published: %v", api.requests)
+		}
+	}
+	if _, err := FixConfigFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FIX_AUTHOR", "not an address")
+	if _, err := FixConfigFromEnv(); err == nil {
+		t.Fatal("expected an invalid FIX_AUTHOR to be rejected")
+	}
+}
+
+func TestModeFix_NeedsCommitIdentity(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_COMMITTER_EMAIL", "")
+	t.Setenv("FIX_AUTHOR", "")
+	spec := TaskSpec{TaskID: "f", RepoDir: t.TempDir() + "/missing"}
+	if err := ModeFix.checkSpec(spec); err == nil || !strings.Contains(err.Error(), "FIX_AUTHOR") {
+		t.Fatalf("expected fix mode without an identity to be refused, got %v", err)
+	}
+	t.Setenv("FIX_AUTHOR", "Fix Bot <fix@example.com>")
+	if err := ModeFix.checkSpec(spec); err != nil {
+		t.Fatal(err)
+	}
+}
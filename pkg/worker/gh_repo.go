@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,15 +11,15 @@ import (
 
 // EnsureGitHubAuth attempts a minimal auth check. If GITHUB_TOKEN is set, gh can use it via env.
 // We do not print the token; only the presence is logged by the caller.
-func EnsureGitHubAuth() error {
+func EnsureGitHubAuth(ctx context.Context) error {
 	// Always prefer non-interactive behavior
 	_ = os.Setenv("GIT_TERMINAL_PROMPT", "0")
 
 	token := os.Getenv("GITHUB_TOKEN")
 
 	// If not authenticated, attempt non-interactive login using GITHUB_TOKEN
-	if err := exec.Command("gh", "auth", "status").Run(); err != nil && token != "" {
-		login := exec.Command("gh", "auth", "login", "--with-token")
+	if err := exec.CommandContext(ctx, "gh", "auth", "status").Run(); err != nil && token != "" {
+		login := exec.CommandContext(ctx, "gh", "auth", "login", "--with-token")
 		login.Stdin = strings.NewReader(token + "\n")
 		login.Env = append(os.Environ(), "GH_TOKEN="+token, "GIT_TERMINAL_PROMPT=0")
 		_ = login.Run()
@@ -27,27 +28,46 @@ func EnsureGitHubAuth() error {
 	// When a token is present, force git to use gh's credential helper over workspace defaults.
 	// This avoids falling back to wsenv when we do have a token.
 	if token != "" {
-		_ = exec.Command("git", "config", "--global", "--unset-all", "credential.https://github.com.helper").Run()
-		_ = exec.Command("gh", "auth", "setup-git").Run()
+		_ = exec.CommandContext(ctx, "git", "config", "--global", "--unset-all", "credential.https://github.com.helper").Run()
+		_ = exec.CommandContext(ctx, "gh", "auth", "setup-git").Run()
 	}
 
 	// Final status (may still succeed via workspace creds when token absent)
-	return exec.Command("gh", "auth", "status").Run()
+	return exec.CommandContext(ctx, "gh", "auth", "status").Run()
 }
 
 // PrepareRepo ensures the repository exists at repoDir. If missing, uses gh to clone githubRepo.
-// If branch is provided, it checks out the branch.
-func PrepareRepo(homeDir, repoDir, githubRepo, branch string) error {
+// If branch is provided, it checks out the branch. Failures are returned as a *TaskError of
+// kind FailureAuth when git/gh reported an authentication problem, FailureClone otherwise.
+func PrepareRepo(ctx context.Context, homeDir, repoDir, githubRepo, branch string) error {
+	if err := prepareRepo(ctx, homeDir, repoDir, githubRepo, branch); err != nil {
+		return repoError(ctx, err)
+	}
+	return nil
+}
+
+// repoError classifies a clone or checkout failure.
+func repoError(ctx context.Context, err error) error {
+	kind := FailureClone
+	if ctx.Err() != nil {
+		kind = FailureInterrupted
+	} else if isAuthFailure(err.Error()) {
+		kind = FailureAuth
+	}
+	return &TaskError{Kind: kind, Err: err}
+}
+
+func prepareRepo(ctx context.Context, homeDir, repoDir, githubRepo, branch string) error {
 	if repoDir == "" {
 		repoDir = filepath.Join(homeDir, "claude", "target-repo")
 	}
 	if st, err := os.Stat(repoDir); err == nil && st.IsDir() {
 		// Repo exists; optionally switch branch
 		if branch != "" {
-			if err := runInDir(repoDir, "git", "fetch", "--all", "--quiet"); err != nil {
+			if err := runInDir(ctx, repoDir, "git", "fetch", "--all", "--quiet"); err != nil {
 				return err
 			}
-			if err := runInDir(repoDir, "git", "checkout", branch); err != nil {
+			if err := runInDir(ctx, repoDir, "git", "checkout", branch); err != nil {
 				return err
 			}
 		}
@@ -60,21 +80,71 @@ func PrepareRepo(homeDir, repoDir, githubRepo, branch string) error {
 	if githubRepo == "" {
 		return fmt.Errorf("github repo is required to clone")
 	}
-	if err := runInDir(filepath.Dir(repoDir), "gh", "repo", "clone", githubRepo, filepath.Base(repoDir)); err != nil {
+	if err := runInDir(ctx, filepath.Dir(repoDir), "gh", "repo", "clone", githubRepo, filepath.Base(repoDir)); err != nil {
 		return err
 	}
 	if branch != "" {
-		if err := runInDir(repoDir, "git", "checkout", branch); err != nil {
+		if err := runInDir(ctx, repoDir, "git", "checkout", branch); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func runInDir(dir string, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
+// authFailureMarkers are git/gh stderr fragments that mean credentials are
+// missing or rejected.
+var authFailureMarkers = []string{
+	"authentication failed",
+	"could not read username",
+	"permission denied (publickey)",
+	"bad credentials",
+	"gh auth login",
+	"gh_token environment variable",
+	"http 401",
+	"requires authentication",
+}
+
+func isAuthFailure(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, m := range authFailureMarkers {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// runInDir runs a command quietly; on failure the error includes its stderr
+// (so callers can classify it).
+func runInDir(ctx context.Context, dir string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Dir = dir
+	var stderr strings.Builder
 	cmd.Stdout = nil
-	cmd.Stderr = nil
-	return cmd.Run()
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := truncateForLog(strings.Join(strings.Fields(stderr.String()), " "), 500)
+		if msg != "" {
+			return fmt.Errorf("%s %s: %w: %s", name, args[0], err, msg)
+		}
+		return fmt.Errorf("%s %s: %w", name, args[0], err)
+	}
+	return nil
+}
+
+// outputInDir is runInDir returning stdout.
+func outputInDir(ctx context.Context, dir string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := truncateForLog(strings.Join(strings.Fields(stderr.String()), " "), 500)
+		if msg != "" {
+			return "", fmt.Errorf("%s %s: %w: %s", name, args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s %s: %w", name, args[0], err)
+	}
+	return string(out), nil
 }
@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// legacyCompletionScript is run after successful tasks when no hooks are
+// configured, as start-worker.sh used to do.
+var legacyCompletionScript = "/home/owner/completion.sh"
+
+// Hook events.
+const (
+	HookOnSuccess = "success"
+	HookOnFailure = "failure"
+)
+
+// Hook runs after a task has finished and receives the task as JSON
+// (status, error, session, usage and data, including the result): on stdin
+// for a command, as the POST body for a URL.
+type Hook struct {
+	Name string `json:"name"`
+	// Command is an exec hook. $TASK_ID, $TASK_STATUS and $SESSION_ID in
+	// its arguments are replaced, and are also set in its environment.
+	Command []string `json:"command,omitempty"`
+	// URL is an HTTP hook. ${VAR} in header values expands from the
+	// environment, so secrets need not be written to the file.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout is a duration such as "30s" (default 30s).
+	Timeout string `json:"timeout,omitempty"`
+	// On lists when the hook runs: "success" (status done), "failure"
+	// (anything else). Empty means both.
+	On []string `json:"on,omitempty"`
+
+	timeout time.Duration
+}
+
+// HookResult is the outcome of one hook, recorded in Data["hooks"].
+type HookResult struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+	ExitCode   int    `json:"exitCode,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+// LoadHooks reads the hooks from WORKER_HOOKS, or else <cmdDir>/hooks.json.
+// Without either, the legacy completion script (if present) runs after
+// successful tasks with the task ID as its argument.
+func LoadHooks(cmdDir string) ([]Hook, error) {
+	path := os.Getenv("WORKER_HOOKS")
+	if path == "" {
+		path = filepath.Join(cmdDir, "hooks.json")
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && os.Getenv("WORKER_HOOKS") == "" {
+		if st, err := os.Stat(legacyCompletionScript); err == nil && !st.IsDir() {
+			return []Hook{{
+				Name:    "completion.sh",
+				Command: []string{"bash", legacyCompletionScript, "$TASK_ID"},
+				On:      []string{HookOnSuccess},
+				timeout: 5 * time.Minute,
+			}}, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read hooks: %w", err)
+	}
+	var hooks []Hook
+	if err := json.Unmarshal(b, &hooks); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i := range hooks {
+		if err := hooks[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: hooks[%d]: %w", path, i, err)
+		}
+	}
+	return hooks, nil
+}
+
+func (h *Hook) validate() error {
+	if (len(h.Command) == 0) == (h.URL == "") {
+		return errors.New("set exactly one of command or url")
+	}
+	if h.Name == "" {
+		h.Name = h.URL
+		if len(h.Command) > 0 {
+			h.Name = filepath.Base(h.Command[0])
+		}
+	}
+	h.timeout = 30 * time.Second
+	if h.Timeout != "" {
+		d, err := time.ParseDuration(h.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", h.Timeout)
+		}
+		h.timeout = d
+	}
+	for _, on := range h.On {
+		if on != HookOnSuccess && on != HookOnFailure {
+			return fmt.Errorf("on: %q is not success or failure", on)
+		}
+	}
+	return nil
+}
+
+func (h Hook) runsFor(task taskstate.Task) bool {
+	if len(h.On) == 0 {
+		return true
+	}
+	want := HookOnFailure
+	if task.Status == taskstate.StatusDone {
+		want = HookOnSuccess
+	}
+	for _, on := range h.On {
+		if on == want {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks runs r.Hooks for a finished task, one after another, and records
+// their outcome on it. Hooks still run after the worker was interrupted
+// (bounded by their own timeout); a failing hook does not fail the task.
+func (r *Runner) runHooks(ctx context.Context, mgr *taskstate.Manager, task taskstate.Task) {
+	if len(r.Hooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(task)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] hooks: encode task: %v\n", err)
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	var results []HookResult
+	for _, h := range r.Hooks {
+		if !h.runsFor(task) {
+			continue
+		}
+		res := h.run(ctx, task, payload)
+		if res.OK {
+			fmt.Printf("[INFO] Hook %s succeeded (%dms)\n", res.Name, res.DurationMS)
+		} else {
+			fmt.Fprintf(os.Stderr, "[WARNING] Hook %s failed: %s\n", res.Name, res.Error)
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		return
+	}
+	mgr.SetTaskData(task.ID, "hooks", results)
+	if err := mgr.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] hooks: save state: %v\n", err)
+	}
+}
+
+func (h Hook) run(ctx context.Context, task taskstate.Task, payload []byte) HookResult {
+	timeout := h.timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	started := time.Now()
+	res := HookResult{Name: h.Name}
+	var err error
+	if len(h.Command) > 0 {
+		res.ExitCode, err = h.exec(ctx, task, payload)
+	} else {
+		res.StatusCode, err = h.post(ctx, payload)
+	}
+	res.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		res.Error = err.Error()
+	}
+	res.OK = err == nil
+	return res
+}
+
+func (h Hook) exec(ctx context.Context, task taskstate.Task, payload []byte) (int, error) {
+	vars := map[string]string{"TASK_ID": task.ID, "TASK_STATUS": task.Status, "SESSION_ID": task.SessionID}
+	args := make([]string, len(h.Command))
+	for i, a := range h.Command {
+		args[i] = os.Expand(a, func(k string) string {
+			if v, ok := vars[k]; ok {
+				return v
+			}
+			return "$" + k
+		})
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if msg := truncateForLog(strings.TrimSpace(stderr.String()), 500); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return exitErr.ExitCode(), err
+	}
+	return 0, err
+}
+
+func (h Hook) post(ctx context.Context, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("content-type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return res.StatusCode, fmt.Errorf("POST %s: %s", h.URL, res.Status)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func finishedTask(t *testing.T, status string) *taskstate.Manager {
+	t.Helper()
+	mgr := taskstate.NewManager(filepath.Join(t.TempDir(), "state.json"))
+	mgr.Enqueue(taskstate.Task{ID: "pr-1"})
+	mgr.StartNext()
+	mgr.LinkSessionToCurrent("sess-1")
+	mgr.CompleteCurrent(status)
+	return mgr
+}
+
+func hookResults(t *testing.T, mgr *taskstate.Manager) []HookResult {
+	t.Helper()
+	h := mgr.GetState().History
+	res, _ := h[len(h)-1].Data["hooks"].([]HookResult)
+	return res
+}
+
+func TestRunHooks_ExecAndHTTP(t *testing.T) {
+	dir := t.TempDir()
+	var gotBody, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody, gotAuth = string(b), r.Header.Get("authorization")
+	}))
+	defer srv.Close()
+	t.Setenv("HOOK_TOKEN", "s3cret")
+	out := filepath.Join(dir, "stdin.json")
+	hooks := []Hook{
+		{Name: "script", Command: []string{"sh", "-c", `cat > "$1"; echo "$2 $TASK_STATUS" > "$1.args"`, "sh", out, "$TASK_ID"}},
+		{Name: "webhook", URL: srv.URL, Headers: map[string]string{"authorization": "Bearer ${HOOK_TOKEN}"}},
+		{Name: "on-failure", Command: []string{"false"}, On: []string{HookOnFailure}},
+	}
+	for i := range hooks {
+		if err := hooks[i].validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := finishedTask(t, taskstate.StatusDone)
+	r := &Runner{Hooks: hooks}
+	r.runHooks(context.Background(), mgr, mgr.GetState().History[0])
+
+	var task taskstate.Task
+	if b, err := os.ReadFile(out); err != nil || json.Unmarshal(b, &task) != nil || task.ID != "pr-1" || task.SessionID != "sess-1" {
+		t.Fatalf("exec hook did not get the task on stdin: %q, %v", b, err)
+	}
+	if b, _ := os.ReadFile(out + ".args"); strings.TrimSpace(string(b)) != "pr-1 done" {
+		t.Fatalf("unexpected expanded args: %q", b)
+	}
+	if !strings.Contains(gotBody, `"id":"pr-1"`) || gotAuth != "Bearer s3cret" {
+		t.Fatalf("unexpected webhook request: %q (auth %q)", gotBody, gotAuth)
+	}
+	res := hookResults(t, mgr)
+	if len(res) != 2 || !res[0].OK || !res[1].OK || res[1].StatusCode != 200 {
+		t.Fatalf("expected the failure-only hook to be skipped: %+v", res)
+	}
+}
+
+func TestRunHooks_RecordsFailures(t *testing.T) {
+	hooks := []Hook{
+		{Command: []string{"sh", "-c", "echo nope >&2; exit 4"}},
+		{Name: "slow", Command: []string{"sleep", "5"}, Timeout: "100ms"},
+	}
+	for i := range hooks {
+		if err := hooks[i].validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := finishedTask(t, "claude_failed")
+	(&Runner{Hooks: hooks}).runHooks(context.Background(), mgr, mgr.GetState().History[0])
+
+	res := hookResults(t, mgr)
+	if len(res) != 2 || res[0].Name != "sh" || res[0].OK || res[0].ExitCode != 4 || !strings.Contains(res[0].Error, "nope") {
+		t.Fatalf("unexpected exec failure: %+v", res)
+	}
+	if res[1].OK || !strings.Contains(res[1].Error, "timed out") || res[1].DurationMS > 4000 {
+		t.Fatalf("expected a timeout: %+v", res[1])
+	}
+}
+
+func TestLoadHooks(t *testing.T) {
+	cmdDir := t.TempDir()
+	t.Setenv("WORKER_HOOKS", "")
+	old := legacyCompletionScript
+	t.Cleanup(func() { legacyCompletionScript = old })
+	legacyCompletionScript = filepath.Join(t.TempDir(), "completion.sh")
+
+	if hooks, err := LoadHooks(cmdDir); err != nil || hooks != nil {
+		t.Fatalf("expected no hooks, got %+v, %v", hooks, err)
+	}
+	if err := os.WriteFile(legacyCompletionScript, []byte("exit 0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := LoadHooks(cmdDir)
+	if err != nil || len(hooks) != 1 || hooks[0].Command[1] != legacyCompletionScript || !hooks[0].runsFor(taskstate.Task{Status: "done"}) || hooks[0].runsFor(taskstate.Task{Status: "failed"}) {
+		t.Fatalf("expected the legacy completion hook, got %+v, %v", hooks, err)
+	}
+
+	path := filepath.Join(cmdDir, "hooks.json")
+	if err := os.WriteFile(path, []byte(`[{"url":"http://x","timeout":"2s","on":["failure"]}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, err = LoadHooks(cmdDir); err != nil || len(hooks) != 1 || hooks[0].Name != "http://x" || hooks[0].timeout.Seconds() != 2 {
+		t.Fatalf("unexpected hooks %+v, %v", hooks, err)
+	}
+	for _, bad := range []string{`[{}]`, `[{"url":"http://x","command":["x"]}]`, `[{"url":"http://x","on":["always"]}]`, `[{"url":"http://x","timeout":"soon"}]`} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadHooks(cmdDir); err == nil {
+			t.Fatalf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestRunner_Run_RunsHooksAfterTask(t *testing.T) {
+	fakeclaude.Setup(t, resultScript("sess-h", "all good"))
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	for _, d := range []string{cmdDir, filepath.Join(tmp, "claude", "target-repo")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	if err := os.WriteFile(filepath.Join(cmdDir, "prompt.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(tmp, "hook.json")
+	hook := Hook{Command: []string{"sh", "-c", `cat > "$1"`, "sh", out}}
+	if err := hook.validate(); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(tmp, "state.json")
+	r := NewRunner()
+	r.Hooks = []Hook{hook}
+	if err := r.Run(context.Background(), cmdDir, statePath, ""); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var task taskstate.Task
+	if b, err := os.ReadFile(out); err != nil || json.Unmarshal(b, &task) != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	if task.Status != taskstate.StatusDone || task.DataString("result") != "all good" {
+		t.Fatalf("hook got an unfinished task: %+v", task)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := m.GetState().History; len(h) != 1 || h[0].Data["hooks"] == nil {
+		t.Fatalf("hook outcome not saved: %+v", h)
+	}
+}
@@ -0,0 +1,13 @@
+package worker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+)
+
+func TestMain(m *testing.M) {
+	fakeclaude.RunIfRequested()
+	os.Exit(m.Run())
+}
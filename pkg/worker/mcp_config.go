@@ -4,10 +4,21 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 // WriteCentralMCPConfig reads external_mcp.txt (JSON) and writes ~/.mcp.json. If missing/empty, writes an empty structure.
 func WriteCentralMCPConfig(cmdDir string, homeDir string) error {
+	b, err := CentralMCPConfig(cmdDir)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(homeDir, ".mcp.json"), b, 0o644)
+}
+
+// CentralMCPConfig returns what WriteCentralMCPConfig writes for cmdDir.
+func CentralMCPConfig(cmdDir string) ([]byte, error) {
 	src := filepath.Join(cmdDir, "external_mcp.txt")
 	var obj map[string]any
 	if st, err := os.Stat(src); err == nil && !st.IsDir() {
@@ -22,10 +33,63 @@ func WriteCentralMCPConfig(cmdDir string, homeDir string) error {
 	if obj == nil {
 		obj = map[string]any{"mcpServers": map[string]any{}}
 	}
-	dest := filepath.Join(homeDir, ".mcp.json")
-	b, err := json.MarshalIndent(obj, "", "  ")
+	return json.MarshalIndent(obj, "", "  ")
+}
+
+// redacted replaces secret values in a redacted MCP config.
+const redacted = "***"
+
+// secretKey matches JSON keys whose values are credentials.
+var secretKey = regexp.MustCompile(`(?i)(token|secret|password|passwd|api[-_]?key|auth|credential|cookie)`)
+
+// secretValue matches well-known token formats wherever they appear, e.g.
+// in server args. The prefix must start a word, so "task-42" keeps its "sk-".
+var secretValue = regexp.MustCompile(`\b(ghp_|gho_|ghs_|ghu_|github_pat_|sk-|xox[abpr]-)[A-Za-z0-9_\-]+`)
+
+// RedactMCPConfig masks the secrets of an MCP config (~/.mcp.json): every
+// env and headers value, values of keys that name a credential, and
+// well-known token formats anywhere else. ${VAR} references are kept since
+// they hold no secret.
+func RedactMCPConfig(b []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(redactValue(v, false), "", "  ")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func redactValue(v any, secret bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			s := secret || k == "env" || k == "headers"
+			if _, nested := e.(map[string]any); !nested {
+				// Only scalars: a server may well be named "oauth"
+				s = s || secretKey.MatchString(k)
+			}
+			t[k] = redactValue(e, s)
+		}
+		return t
+	case []any:
+		for i, e := range t {
+			t[i] = redactValue(e, secret)
+		}
+		return t
+	case string:
+		if strings.HasPrefix(t, "${") && strings.HasSuffix(t, "}") {
+			return t
+		}
+		if secret && t != "" {
+			return redacted
+		}
+		return secretValue.ReplaceAllString(t, "${1}"+redacted)
+	}
+	if secret && v != nil {
+		return redacted
 	}
-	return os.WriteFile(dest, b, 0o644)
+	return v
 }
@@ -0,0 +1,208 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/your-org/claude-dev-setup/pkg/github"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// Mode selects the tools a task gets and what the worker does once Claude
+// has finished.
+type Mode string
+
+const (
+	// ModeCreate is what the watcher writes: tools come from the cmd dir
+	// whitelist and the prompt tells Claude how to report back. An empty
+	// mode means the same.
+	ModeCreate Mode = "create"
+	// ModeReview runs with read-only tools and posts the structured review.
+	ModeReview Mode = "review"
+	// ModeFix lets Claude edit files, then commits and pushes them to the
+	// PR branch, or to a new claude/<task-id> branch with a PR of its own.
+	ModeFix Mode = "fix"
+	// ModeResume continues a stored session and posts the reply, if the
+	// task names a PR.
+	ModeResume Mode = "resume"
+	// ModeAsk answers a question with read-only tools and posts the answer
+	// as a comment, in the review thread when the task names one.
+	ModeAsk Mode = "ask"
+)
+
+// ParseMode validates a task mode; "" is ModeCreate.
+func ParseMode(s string) (Mode, error) {
+	m := Mode(strings.ToLower(strings.TrimSpace(s)))
+	switch m {
+	case "":
+		return ModeCreate, nil
+	case ModeCreate, ModeReview, ModeFix, ModeResume, ModeAsk:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown task mode %q (want review, fix, resume, ask or create)", s)
+}
+
+// readOnly modes never get tools that change the checkout.
+func (m Mode) readOnly() bool { return m == ModeReview || m == ModeAsk }
+
+// readTools inspect the checkout and the PR without changing either.
+var readTools = []string{
+	"Read", "Grep", "Glob", "LS",
+	"Bash(gh pr view:*)", "Bash(gh pr diff:*)",
+	"Bash(git log:*)", "Bash(git diff:*)", "Bash(git show:*)",
+}
+
+var writeTools = []string{"Write", "Edit", "MultiEdit", "NotebookEdit"}
+
+// DefaultTools is the whitelist a mode uses when the cmd dir has none.
+// ModeCreate has none, so Claude keeps its own defaults.
+func (m Mode) DefaultTools() []string {
+	switch m {
+	case ModeReview, ModeResume:
+		return slices.Clone(readTools)
+	case ModeAsk:
+		return append(slices.Clone(readTools), "Bash(gh issue view:*)")
+	case ModeFix:
+		return append(slices.Clone(readTools), "Write", "Edit", "MultiEdit", "Bash(git status:*)")
+	}
+	return nil
+}
+
+// Tools derives the allowed and disallowed tools from the cmd dir
+// whitelist (or the mode's default when it is empty). Read-only modes drop
+// editing tools and any Bash the mode's defaults do not list; a whitelist
+// with unrestricted Bash gets those scoped read-only commands instead.
+// Task is disallowed unless allowed explicitly, to force Write/Edit usage.
+func (m Mode) Tools(whitelist []string) (allowed, disallowed []string) {
+	allowed = slices.Clone(whitelist)
+	if len(allowed) == 0 {
+		allowed = m.DefaultTools()
+	}
+	if m.readOnly() {
+		readOnly := m.DefaultTools()
+		kept := allowed[:0]
+		bash := false
+		for _, t := range allowed {
+			switch {
+			case t == "Bash":
+				bash = true
+			case strings.HasPrefix(t, "Bash(") && !slices.Contains(readOnly, t):
+				// Bash(git push:*), Bash(rm:*) and the like change things
+			case !slices.Contains(writeTools, t):
+				kept = append(kept, t)
+			}
+		}
+		allowed = kept
+		if bash {
+			for _, t := range readOnly {
+				if strings.HasPrefix(t, "Bash(") && !slices.Contains(allowed, t) {
+					allowed = append(allowed, t)
+				}
+			}
+		}
+		disallowed = append(disallowed, writeTools...)
+	}
+	if !slices.Contains(allowed, "Task") {
+		disallowed = append(disallowed, "Task")
+	}
+	return allowed, disallowed
+}
+
+// checkSpec reports what a mode needs that spec lacks, before anything runs.
+func (m Mode) checkSpec(spec TaskSpec) error {
+	switch m {
+	case ModeReview, ModeAsk:
+		if spec.Repo == "" || spec.PRNumber == 0 {
+			return fmt.Errorf("%s mode needs a repo and PR number", m)
+		}
+	case ModeFix:
+		cfg, err := FixConfigFromEnv()
+		if err != nil {
+			return err
+		}
+		if spec.Branch != "" && cfg.protected(spec.Branch) {
+			return fmt.Errorf("fix mode refuses to push to protected branch %s", spec.Branch)
+		}
+		dir := ""
+		if st, err := os.Stat(spec.RepoDir); err == nil && st.IsDir() {
+			dir = spec.RepoDir
+		}
+		if cfg.Author == "" && !hasGitIdentity(context.Background(), dir) {
+			return errNoFixAuthor
+		}
+	}
+	return nil
+}
+
+// finish returns the post-processing of mode, nil when it has none.
+func (r *Runner) finish(mode Mode, spec TaskSpec, mgr *taskstate.Manager) func(context.Context, RunResult) error {
+	switch mode {
+	case ModeReview:
+		return func(ctx context.Context, res RunResult) error { return r.postReview(ctx, spec, mgr, res) }
+	case ModeAsk:
+		return func(ctx context.Context, res RunResult) error { return r.postAnswer(ctx, spec, mgr, res) }
+	case ModeResume:
+		if spec.Repo == "" || spec.PRNumber == 0 {
+			return nil
+		}
+		return func(ctx context.Context, res RunResult) error { return r.postAnswer(ctx, spec, mgr, res) }
+	case ModeFix:
+		return func(ctx context.Context, res RunResult) error { return r.pushFixes(ctx, spec, mgr, res) }
+	}
+	return nil
+}
+
+func (r *Runner) github() *github.Client {
+	if r.GitHub != nil {
+		return r.GitHub
+	}
+	return github.NewClientFromEnv()
+}
+
+// postReview submits the structured review, or Claude's final text when
+// there is none, as a COMMENT review; the verdict is part of the body.
+func (r *Runner) postReview(ctx context.Context, spec TaskSpec, mgr *taskstate.Manager, res RunResult) error {
+	body := strings.TrimSpace(res.Result)
+	if res.Review != nil {
+		body = res.Review.Markdown()
+	}
+	if body == "" {
+		return &TaskError{Kind: FailurePublish, Err: errors.New("claude produced no review to post")}
+	}
+	rv, err := r.github().CreateReview(ctx, spec.Repo, spec.PRNumber, github.ReviewRequest{Body: body, Event: github.EventComment})
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: fmt.Errorf("post review: %w", err)}
+	}
+	mgr.SetTaskData(spec.TaskID, "reviewUrl", rv.HTMLURL)
+	fmt.Printf("[INFO] Posted review on %s#%d\n", spec.Repo, spec.PRNumber)
+	return nil
+}
+
+// postAnswer posts Claude's final text as a reply in the review thread of
+// spec.CommentID, or as a PR comment.
+func (r *Runner) postAnswer(ctx context.Context, spec TaskSpec, mgr *taskstate.Manager, res RunResult) error {
+	body := strings.TrimSpace(res.Result)
+	if body == "" {
+		return &TaskError{Kind: FailurePublish, Err: errors.New("claude produced no answer to post")}
+	}
+	var c *github.Comment
+	var err error
+	if spec.CommentID != 0 {
+		c, err = r.github().ReplyToReviewComment(ctx, spec.Repo, spec.PRNumber, spec.CommentID, body)
+	} else {
+		c, err = r.github().CreateIssueComment(ctx, spec.Repo, spec.PRNumber, body)
+	}
+	if err != nil {
+		return &TaskError{Kind: FailurePublish, Err: fmt.Errorf("post comment: %w", err)}
+	}
+	mgr.SetTaskData(spec.TaskID, "commentUrl", c.HTMLURL)
+	fmt.Printf("[INFO] Posted reply on %s#%d\n", spec.Repo, spec.PRNumber)
+	return nil
+}
+
+// worktreeExclude keeps the generated permissions out of fix commits.
+const worktreeExclude = ":(exclude).claude/settings.local.json"
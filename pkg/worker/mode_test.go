@@ -0,0 +1,251 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/github"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": ModeCreate, "create": ModeCreate, "Review": ModeReview, " fix ": ModeFix, "ask": ModeAsk, "resume": ModeResume} {
+		if got, err := ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseMode("deploy"); err == nil {
+		t.Fatal("expected unknown mode to be rejected")
+	}
+}
+
+func TestMode_Tools(t *testing.T) {
+	watcher := []string{"Bash", "Read", "Write", "Edit", "LS", "Grep"}
+
+	allowed, disallowed := ModeReview.Tools(watcher)
+	for _, tool := range []string{"Bash", "Write", "Edit"} {
+		if slices.Contains(allowed, tool) {
+			t.Fatalf("review mode should not allow %s: %v", tool, allowed)
+		}
+	}
+	if !slices.Contains(allowed, "Bash(gh pr diff:*)") || !slices.Contains(allowed, "Read") {
+		t.Fatalf("review mode should keep read-only tools: %v", allowed)
+	}
+	if !slices.Contains(disallowed, "Write") || !slices.Contains(disallowed, "Task") {
+		t.Fatalf("unexpected disallowed tools: %v", disallowed)
+	}
+	scoped := []string{"Read", "Bash(git push:*)", "Bash(rm:*)", "Bash(git diff:*)"}
+	if allowed, _ = ModeAsk.Tools(scoped); !slices.Equal(allowed, []string{"Read", "Bash(git diff:*)"}) {
+		t.Fatalf("ask mode should keep only read-only Bash commands: %v", allowed)
+	}
+
+	if allowed, disallowed = ModeCreate.Tools(watcher); !slices.Equal(allowed, watcher) || !slices.Equal(disallowed, []string{"Task"}) {
+		t.Fatalf("create mode should pass the whitelist through: %v / %v", allowed, disallowed)
+	}
+	if allowed, _ = ModeCreate.Tools(nil); allowed != nil {
+		t.Fatalf("create mode has no default tools, got %v", allowed)
+	}
+	if allowed, _ = ModeFix.Tools(nil); !slices.Contains(allowed, "Edit") || slices.Contains(allowed, "Bash") {
+		t.Fatalf("unexpected fix defaults: %v", allowed)
+	}
+}
+
+// fakeGitHub records the requests it receives and answers them with status.
+type fakeGitHub struct {
+	mu       sync.Mutex
+	requests []string
+	bodies   []map[string]any
+	status   int
+}
+
+func newFakeGitHub(t *testing.T, status int) (*fakeGitHub, *github.Client) {
+	f := &fakeGitHub{status: status}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		f.bodies = append(f.bodies, body)
+		f.mu.Unlock()
+		w.WriteHeader(f.status)
+		w.Write([]byte(`{"id":1,"html_url":"https://github.com/org/app/pull/7#posted"}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := github.NewClient("tok")
+	c.BaseURL = srv.URL
+	return f, c
+}
+
+// drainTasks runs tf through Drain with repoDir as the checkout and returns
+// the finished tasks.
+func drainTasks(t *testing.T, r *Runner, repoDir string, tfs ...TaskFile) []taskstate.Task {
+	t.Helper()
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(cmdDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", repoDir)
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("CLAUDE_RETRIES", "0")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	for _, tf := range tfs {
+		if _, err := WriteTaskFile(cmdDir, tf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statePath := filepath.Join(tmp, "state.json")
+	if err := r.Drain(context.Background(), cmdDir, statePath); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetState().History
+}
+
+func TestRunner_ReviewModePostsReview(t *testing.T) {
+	rec := fakeclaude.Setup(t, resultScript("sess-r", "```json\n{\"summary\":\"Needs work\",\"verdict\":\"request_changes\",\"findings\":[]}\n```"))
+	gh, client := newFakeGitHub(t, http.StatusOK)
+	r := NewRunner()
+	r.GitHub = client
+
+	h := drainTasks(t, r, t.TempDir(), TaskFile{ID: "pr-7", Prompt: "review it", Mode: "review", Repo: "org/app", PRNumber: 7})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone || h[0].DataString("reviewUrl") == "" {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+	inv := fakeclaude.Invocations(t, rec)[0]
+	if slices.Contains(inv.AllowedTools, "Write") || !slices.Contains(inv.DisallowedTools, "Write") {
+		t.Fatalf("review mode must run read-only: %+v", inv)
+	}
+	if len(gh.requests) != 1 || gh.requests[0] != "POST /repos/org/app/pulls/7/reviews" {
+		t.Fatalf("unexpected GitHub requests: %v", gh.requests)
+	}
+	if body, _ := gh.bodies[0]["body"].(string); !strings.Contains(body, "request changes") || !strings.Contains(body, "Needs work") {
+		t.Fatalf("unexpected review body: %q", body)
+	}
+}
+
+func TestRunner_AskModeRepliesInThread(t *testing.T) {
+	fakeclaude.Setup(t, resultScript("sess-a", "It is called from main."))
+	gh, client := newFakeGitHub(t, http.StatusCreated)
+	r := NewRunner()
+	r.GitHub = client
+
+	h := drainTasks(t, r, t.TempDir(), TaskFile{ID: "q", Prompt: "who calls this?", Mode: "ask", Repo: "org/app", PRNumber: 7, CommentID: 99})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+	if len(gh.requests) != 1 || gh.requests[0] != "POST /repos/org/app/pulls/7/comments/99/replies" || gh.bodies[0]["body"] != "It is called from main." {
+		t.Fatalf("unexpected GitHub requests: %v %v", gh.requests, gh.bodies)
+	}
+}
+
+func TestRunner_ModeFailures(t *testing.T) {
+	rec := fakeclaude.Setup(t, resultScript("sess-x", "answer"))
+	_, client := newFakeGitHub(t, http.StatusInternalServerError)
+	r := NewRunner()
+	r.GitHub = client
+
+	h := drainTasks(t, r, t.TempDir(),
+		TaskFile{ID: "no-pr", Prompt: "x", Mode: "ask", Repo: "org/app"},
+		TaskFile{ID: "post-fails", Prompt: "x", Mode: "ask", Repo: "org/app", PRNumber: 7},
+	)
+	if len(h) != 2 || h[0].Status != string(FailureOther) || !strings.Contains(h[0].Error, "PR number") {
+		t.Fatalf("expected the task without PR to fail before running: %+v", h)
+	}
+	if h[1].Status != string(FailurePublish) || h[1].ExitCode != 0 {
+		t.Fatalf("expected publish_failed: %+v", h[1])
+	}
+	if n := len(fakeclaude.Invocations(t, rec)); n != 1 {
+		t.Fatalf("expected only the second task to run Claude, got %d runs", n)
+	}
+}
+
+func TestRunner_RejectsUnknownMode(t *testing.T) {
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(cmdDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"prompt.txt": "x", "task_mode.txt": "deploy"} {
+		if err := os.WriteFile(filepath.Join(cmdDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := NewRunner().Run(context.Background(), cmdDir, filepath.Join(tmp, "state.json"), "")
+	if err == nil || !strings.Contains(err.Error(), "unknown task mode") || ExitCode(err) != 23 {
+		t.Fatalf("expected unknown mode failure, got %v", err)
+	}
+}
+
+// gitRepo creates a clone of a new bare repo with one commit on main and
+// returns the clone and the bare remote.
+func gitRepo(t *testing.T) (clone, remote string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	remote, clone = filepath.Join(tmp, "remote.git"), filepath.Join(tmp, "clone")
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git(tmp, "init", "-q", "--bare", "-b", "main", remote)
+	git(tmp, "clone", "-q", remote, clone)
+	git(clone, "config", "user.email", "dev@example.com")
+	git(clone, "config", "user.name", "Dev")
+	if err := os.WriteFile(filepath.Join(clone, "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(clone, "add", ".")
+	git(clone, "commit", "-q", "-m", "init")
+	git(clone, "push", "-q", "origin", "HEAD:main")
+	return clone, remote
+}
+
+func TestRunner_FixModePushesChanges(t *testing.T) {
+	clone, remote := gitRepo(t)
+	edit := fakeclaude.DefaultScript("sess-f")
+	edit.Steps = append([]fakeclaude.Step{{WriteFile: &fakeclaude.FileWrite{Path: "a.txt", Content: "fixed\n"}}}, edit.Steps...)
+	fakeclaude.Setup(t, edit, fakeclaude.DefaultScript("sess-g"))
+	// Generated permissions must not end up in the commit
+	if err := WriteRepoPermissions(clone, []string{"Read"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := drainTasks(t, NewRunner(), clone,
+		TaskFile{ID: "fix-1", Prompt: "fix it", Mode: "fix", Branch: "feature"},
+		TaskFile{ID: "fix-2", Prompt: "nothing to do", Mode: "fix", Branch: "feature"},
+	)
+	if len(h) != 2 || h[0].Status != taskstate.StatusDone || h[0].DataString("pushedTo") != "feature" || h[0].DataString("commit") == "" {
+		t.Fatalf("unexpected first task: %+v", h)
+	}
+	if h[1].Status != taskstate.StatusDone || h[1].Data["noChanges"] != true {
+		t.Fatalf("expected the second run to be a no-op: %+v", h[1])
+	}
+	out, err := exec.Command("git", "-C", remote, "show", "--name-only", "--format=%s", "feature").CombinedOutput()
+	if err != nil {
+		t.Fatalf("feature branch not pushed: %v: %s", err, out)
+	}
+	if got := strings.Fields(string(out)); !slices.Contains(got, "a.txt") || slices.Contains(got, ".claude/settings.local.json") {
+		t.Fatalf("unexpected pushed commit: %s", out)
+	}
+}
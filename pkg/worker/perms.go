@@ -60,6 +60,14 @@ func GenerateRepoPermissions(cmdDir, repoDir string) error {
 	if err != nil {
 		return err
 	}
+	return WriteRepoPermissions(repoDir, tools)
+}
+
+// WriteRepoPermissions writes settings.local.json under <repoDir>/.claude/ allowing tools.
+func WriteRepoPermissions(repoDir string, tools []string) error {
+	if repoDir == "" {
+		return errors.New("repoDir is required")
+	}
 	// Ensure .claude dir
 	targetDir := filepath.Join(repoDir, ".claude")
 	if err := os.MkdirAll(targetDir, 0o755); err != nil {
@@ -0,0 +1,242 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+	"github.com/your-org/claude-dev-setup/pkg/config"
+	"github.com/your-org/claude-dev-setup/pkg/permissions"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// planPromptLen is how much of the prompt a plan shows.
+const planPromptLen = 120
+
+// Plan is what Run would do for the next task, resolved from the cmd dir,
+// state and environment without changing any of them.
+type Plan struct {
+	TaskID   string
+	Mode     Mode
+	Repo     string
+	Branch   string
+	PRNumber int
+	// Checkout says how RepoDir would be prepared.
+	Checkout string
+	RepoDir  string
+	Backend  string
+	// Argv is the `claude` command line with the prompt shortened; empty
+	// for the API backend.
+	Argv   []string
+	Prompt string
+	// PromptTemplate is the template Prompt was rendered from.
+	PromptTemplate  string
+	AllowedTools    []string
+	DisallowedTools []string
+	PermissionMode  string
+	ResumeSessionID string
+	// MCPConfig is ~/.mcp.json as the run would write it, secrets masked.
+	MCPConfig string
+	// Settings is the .claude/settings.local.json the run would write.
+	Settings string
+	// Problems would fail the task or change how it runs.
+	Problems []string
+}
+
+// Plan resolves what Run would do for cmdDir, statePath and sessionPath:
+// the task it would pick, where it would check the repo out and how it
+// would run Claude. Nothing is cloned, run or written; a prompt template
+// may read the PR from GitHub. It returns an error only when config or state
+// cannot be read; a task that would fail is reported in Problems.
+func (r *Runner) Plan(ctx context.Context, cmdDir, statePath, sessionPath string) (*Plan, error) {
+	if cmdDir == "" || statePath == "" {
+		return nil, errors.New("missing cmdDir or statePath")
+	}
+	cfg, err := config.LoadFromDir(cmdDir)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	// Changes to mgr stay in memory: it is never saved
+	mgr, err := taskstate.Load(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+	if st := mgr.GetState(); st.Current == nil && len(st.Queue) > 0 {
+		mgr.StartNext()
+	}
+	defaults := runDefaults(cfg, readRunPrompt(cfg))
+	if mgr.GetState().Current == nil && (defaults.Prompt != "" || defaults.PromptTemplate != "") {
+		mgr.Enqueue(taskstate.Task{ID: newRunTaskID(cfg)})
+		mgr.StartNext()
+	}
+	cur := mgr.GetState().Current
+	if cur == nil {
+		return &Plan{Problems: []string{"no current task, queued task or prompt: nothing to run"}}, nil
+	}
+
+	spec := resolveTaskSpec(*cur, defaults)
+	spec.TaskID = cur.ID
+	p := &Plan{TaskID: spec.TaskID, Repo: spec.Repo, Branch: spec.Branch, PRNumber: spec.PRNumber, PromptTemplate: spec.PromptTemplate}
+	problem := func(err error) { p.Problems = append(p.Problems, err.Error()) }
+	if spec.Prompt == "" && spec.PromptTemplate == "" {
+		problem(errors.New("the task has no prompt; it would be left as is"))
+	}
+	mode, err := ParseMode(spec.Mode)
+	if err == nil {
+		err = mode.checkSpec(spec)
+	}
+	if err != nil {
+		problem(err)
+	}
+	p.Mode = mode
+	whitelist, _ := ParseToolsFromWhitelist(cmdDir)
+	spec.AllowedTools, spec.DisallowedTools = mode.Tools(whitelist)
+	p.AllowedTools, p.DisallowedTools = spec.AllowedTools, spec.DisallowedTools
+
+	home := os.Getenv("HOME")
+	if r.Worktrees != nil && spec.Repo != "" && os.Getenv("CUSTOM_REPO_PATH") == "" {
+		ref := "the default branch"
+		switch {
+		case spec.HeadSHA != "":
+			ref = spec.HeadSHA
+		case spec.Branch != "":
+			ref = "branch " + spec.Branch
+		case spec.PRNumber > 0:
+			ref = "the head of PR #" + strconv.Itoa(spec.PRNumber)
+		}
+		mirror := r.Worktrees.mirrorDir(spec.Repo)
+		action := "fetch"
+		if _, err := os.Stat(filepath.Join(mirror, "HEAD")); err != nil {
+			action = "clone"
+		}
+		spec.RepoDir = r.Worktrees.worktreeDir(spec.TaskID)
+		p.Checkout = fmt.Sprintf("%s the mirror %s of %s, then add a worktree at %s", action, mirror, spec.Repo, ref)
+	} else if st, err := os.Stat(spec.RepoDir); err == nil && st.IsDir() {
+		p.Checkout = "use the existing checkout"
+		if spec.Repo == "" && spec.Branch != "" {
+			p.Checkout += ", switched to branch " + spec.Branch
+		}
+	} else if spec.Repo != "" {
+		p.Checkout = "clone " + spec.Repo + " with gh"
+	} else {
+		p.Checkout = "none"
+		problem(fmt.Errorf("repoDir not found and no repo to clone: %s", spec.RepoDir))
+	}
+	p.RepoDir = spec.RepoDir
+	if spec.PromptTemplate != "" {
+		rendered, err := r.renderPrompt(ctx, cmdDir, spec, mode)
+		if err != nil {
+			problem(err)
+		}
+		spec.Prompt = rendered
+	}
+
+	opts, err := r.streamOptions(spec, mode, sessionPath, mgr)
+	if err != nil {
+		problem(err)
+	}
+	p.PermissionMode = opts.PermissionMode
+	p.ResumeSessionID = opts.ResumeSessionID
+	if mode == ModeResume && opts.ResumeSessionID == "" {
+		problem(errors.New("resume requested but no stored session found; a fresh session would start"))
+	}
+	opts.Prompt = finalPrompt(opts)
+	p.Prompt = shortenPrompt(opts.Prompt, planPromptLen)
+	if opts.Backend != nil {
+		p.Backend = opts.Backend.Name()
+	}
+	if _, ok := opts.Backend.(*claude.CLIBackend); ok {
+		req := claudeRequest(opts)
+		// The worker writes ~/.mcp.json before every run
+		req.MCPConfigPath = filepath.Join(home, ".mcp.json")
+		req.Prompt = p.Prompt
+		p.Argv = append([]string{"claude"}, claude.CLIArgs(req)...)
+	}
+
+	if b, err := CentralMCPConfig(cmdDir); err != nil {
+		problem(fmt.Errorf("mcp config: %w", err))
+	} else if red, err := RedactMCPConfig(b); err != nil {
+		problem(fmt.Errorf("mcp config: %w", err))
+	} else {
+		p.MCPConfig = string(red)
+	}
+	if b, err := permissions.Render(spec.AllowedTools); err != nil {
+		problem(fmt.Errorf("settings.local.json: %w", err))
+	} else {
+		p.Settings = string(b) + "\n"
+	}
+	return p, nil
+}
+
+// shortenPrompt keeps the first n runes of s on one line and says how much
+// was cut.
+func shortenPrompt(s string, n int) string {
+	s = strings.TrimSpace(s)
+	r := []rune(s)
+	if len(r) <= n {
+		return strings.ReplaceAll(s, "\n", `\n`)
+	}
+	return strings.ReplaceAll(string(r[:n]), "\n", `\n`) + fmt.Sprintf("… (%d chars)", len(r))
+}
+
+// Write prints p for people.
+func (p *Plan) Write(w io.Writer) error {
+	var b strings.Builder
+	field := func(name, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "%-17s %s\n", name+":", v)
+		}
+	}
+	list := func(v []string) string { return strings.Join(v, ", ") }
+	field("Task", p.TaskID)
+	field("Mode", string(p.Mode))
+	field("Repo", p.Repo)
+	field("Branch", p.Branch)
+	if p.PRNumber > 0 {
+		field("PR", "#"+strconv.Itoa(p.PRNumber))
+	}
+	field("Checkout", p.Checkout)
+	field("Repo dir", p.RepoDir)
+	field("Backend", p.Backend)
+	field("Permission mode", p.PermissionMode)
+	field("Allowed tools", list(p.AllowedTools))
+	field("Disallowed tools", list(p.DisallowedTools))
+	field("Resume session", p.ResumeSessionID)
+	field("Prompt template", p.PromptTemplate)
+	field("Prompt", p.Prompt)
+	if len(p.Argv) > 0 {
+		quoted := make([]string, len(p.Argv))
+		for i, a := range p.Argv {
+			quoted[i] = shellQuote(a)
+		}
+		field("Command", strings.Join(quoted, " "))
+	}
+	if p.MCPConfig != "" {
+		fmt.Fprintf(&b, "\n~/.mcp.json:\n%s", p.MCPConfig)
+	}
+	if p.Settings != "" {
+		fmt.Fprintf(&b, "\n.claude/settings.local.json:\n%s", p.Settings)
+	}
+	if len(p.Problems) > 0 {
+		b.WriteString("\nProblems:\n")
+		for _, pr := range p.Problems {
+			fmt.Fprintf(&b, "  - %s\n", pr)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// shellQuote quotes a for a POSIX shell when it needs it.
+func shellQuote(a string) string {
+	if a != "" && !strings.ContainsAny(a, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+		return a
+	}
+	return "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunner_PlanWritesAndRunsNothing(t *testing.T) {
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(cmdDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"prompt.txt":         "Review the change\n" + strings.Repeat("x", 300),
+		"task_mode.txt":      "review",
+		"github_repo.txt":    "org/app",
+		"tool_whitelist.txt": "Read\nWrite\n",
+		"external_mcp.txt":   `{"mcpServers":{"gh":{"command":"gh-mcp","env":{"GITHUB_TOKEN":"ghp_supersecret"}}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cmdDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("PR_NUMBER", "7")
+	t.Setenv("CLAUDE_BACKEND", "")
+	t.Setenv("CLAUDE_PERMISSION_MODE", "acceptEdits")
+
+	r := NewRunner()
+	r.Worktrees = NewWorktrees(filepath.Join(tmp, "claude"))
+	statePath := filepath.Join(tmp, "state", "state.json")
+	p, err := r.Plan(context.Background(), cmdDir, statePath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != ModeReview || p.Repo != "org/app" || p.PRNumber != 7 || len(p.Problems) != 0 {
+		t.Fatalf("unexpected plan: %+v", p)
+	}
+	if slices.Contains(p.AllowedTools, "Write") || !slices.Contains(p.DisallowedTools, "Write") {
+		t.Fatalf("review mode must stay read-only: %v / %v", p.AllowedTools, p.DisallowedTools)
+	}
+	if !strings.Contains(p.Checkout, "clone the mirror") || p.RepoDir != r.Worktrees.worktreeDir(p.TaskID) {
+		t.Fatalf("unexpected checkout %q in %s", p.Checkout, p.RepoDir)
+	}
+	i := slices.Index(p.Argv, "-p")
+	if i < 0 || !strings.HasPrefix(p.Argv[i+1], "Review the change") || len(p.Argv[i+1]) > planPromptLen+30 ||
+		!slices.Contains(p.Argv, "acceptEdits") || !slices.Contains(p.Argv, filepath.Join(tmp, ".mcp.json")) {
+		t.Fatalf("unexpected argv: %q", p.Argv)
+	}
+	if strings.Contains(p.MCPConfig, "supersecret") || !strings.Contains(p.MCPConfig, "gh-mcp") {
+		t.Fatalf("mcp config not masked: %s", p.MCPConfig)
+	}
+	if !strings.Contains(p.Settings, `"Read"`) {
+		t.Fatalf("unexpected settings: %s", p.Settings)
+	}
+	var out strings.Builder
+	if err := p.Write(&out); err != nil || !strings.Contains(out.String(), "Command:") {
+		t.Fatalf("unexpected output %v:\n%s", err, out.String())
+	}
+
+	// Nothing was written: no state, MCP config, checkout or mirror
+	for _, path := range []string{statePath, filepath.Dir(statePath), filepath.Join(tmp, ".mcp.json"), filepath.Join(tmp, "claude")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("dry run created %s", path)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/your-org/claude-dev-setup/pkg/config"
+	"github.com/your-org/claude-dev-setup/pkg/prompt"
+)
+
+// PromptTemplateDirs are where prompt templates are loaded from, on top of
+// the built-in library: <cmdDir>/prompts, then PROMPT_TEMPLATE_DIR, a later
+// template replacing an earlier one of the same name.
+func PromptTemplateDirs(cmdDir string) []string {
+	return []string{filepath.Join(cmdDir, "prompts"), strings.TrimSpace(os.Getenv("PROMPT_TEMPLATE_DIR"))}
+}
+
+// promptFileName is the name prompt_filename.txt holds, "" without one.
+func promptFileName(cfg *config.Config) string {
+	if cfg.PromptFilenameRef == "" {
+		return ""
+	}
+	b, err := os.ReadFile(cfg.PromptFilenameRef)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// promptTemplateName is the template prompt_filename.txt names, "" when it
+// names a plain prompt file.
+func promptTemplateName(cfg *config.Config) string {
+	if name := promptFileName(cfg); isPromptTemplate(name) {
+		return name
+	}
+	return ""
+}
+
+func isPromptTemplate(name string) bool { return prompt.IsTemplateName(name) }
+
+func cmdDirPath(cmdDir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(cmdDir, name)
+}
+
+// checkPromptTemplate refuses template names that are paths: a template is
+// looked up by name in the library, never read from elsewhere on disk.
+func checkPromptTemplate(name string) error {
+	slash := filepath.ToSlash(name)
+	if filepath.IsAbs(name) || strings.HasPrefix(slash, "/") || slices.Contains(strings.Split(slash, "/"), "..") {
+		return fmt.Errorf("prompt template %q: want a template name, not a path", name)
+	}
+	return nil
+}
+
+// renderPrompt renders library template spec.PromptTemplate (e.g. "review",
+// or one from <cmdDir>/prompts or PROMPT_TEMPLATE_DIR). Unknown variables
+// and templates fail the task before Claude runs.
+func (r *Runner) renderPrompt(ctx context.Context, cmdDir string, spec TaskSpec, mode Mode) (string, error) {
+	if err := checkPromptTemplate(spec.PromptTemplate); err != nil {
+		return "", err
+	}
+	lib, err := prompt.Load(PromptTemplateDirs(cmdDir)...)
+	if err != nil {
+		return "", err
+	}
+	vars, err := r.promptVars(ctx, spec, mode)
+	if err != nil {
+		return "", err
+	}
+	out, err := lib.Render(spec.PromptTemplate, vars)
+	if err != nil {
+		return "", fmt.Errorf("render prompt: %w", err)
+	}
+	return out, nil
+}
+
+// promptVars are the template variables of spec. The PR's refs, URL and
+// changed files come from GitHub when the task names a PR.
+func (r *Runner) promptVars(ctx context.Context, spec TaskSpec, mode Mode) (prompt.Vars, error) {
+	v := prompt.Vars{
+		TaskID:   spec.TaskID,
+		Mode:     string(mode),
+		Repo:     spec.Repo,
+		PRNumber: spec.PRNumber,
+		HeadRef:  spec.Branch,
+		HeadSHA:  spec.HeadSHA,
+		Prompt:   spec.Prompt,
+	}
+	if spec.Repo == "" || spec.PRNumber == 0 {
+		return v, nil
+	}
+	gh := r.github()
+	pr, err := gh.GetPullRequest(ctx, spec.Repo, spec.PRNumber)
+	if err != nil {
+		return v, fmt.Errorf("prompt variables: get PR #%d: %w", spec.PRNumber, err)
+	}
+	v.PRURL, v.HeadRef, v.BaseRef = pr.HTMLURL, pr.Head.Ref, pr.Base.Ref
+	if v.HeadSHA == "" {
+		v.HeadSHA = pr.Head.SHA
+	}
+	if v.ChangedFiles, err = gh.PullRequestFiles(ctx, spec.Repo, spec.PRNumber); err != nil {
+		return v, fmt.Errorf("prompt variables: list files of PR #%d: %w", spec.PRNumber, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func TestRunner_RendersPromptTemplates(t *testing.T) {
+	rec := fakeclaude.Setup(t, resultScript("sess-t", "```json\n{\"summary\":\"ok\",\"verdict\":\"approve\",\"findings\":[]}\n```"))
+	_, client := newFakeRepoAPI(t, map[string]string{
+		"GET /repos/org/app/pulls/7":          `{"number":7,"html_url":"https://github.com/org/app/pull/7","head":{"ref":"feature","sha":"abc123"},"base":{"ref":"main"}}`,
+		"GET /repos/org/app/pulls/7/files":    `[{"filename":"cmd/main.go"},{"filename":"pkg/x.go"}]`,
+		"POST /repos/org/app/pulls/7/reviews": `{"id":1,"html_url":"https://github.com/org/app/pull/7#r1"}`,
+	})
+	r := NewRunner()
+	r.GitHub = client
+
+	h := drainTasks(t, r, t.TempDir(), TaskFile{ID: "pr-7", Prompt: "Look at the parser.", PromptTemplate: "review", Mode: "review", Repo: "org/app", PRNumber: 7})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone || h[0].DataString("reviewUrl") == "" {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+	inv := fakeclaude.Invocations(t, rec)
+	if len(inv) != 1 {
+		t.Fatalf("expected one run, got %d", len(inv))
+	}
+	for _, want := range []string{"Pull request: #7 (https://github.com/org/app/pull/7)", "Branch: feature into main", "Head commit: abc123", "- pkg/x.go", "any files.\n\nAdditional instructions:\nLook at the parser."} {
+		if !strings.Contains(inv[0].Prompt, want) {
+			t.Fatalf("rendered prompt misses %q:\n%s", want, inv[0].Prompt)
+		}
+	}
+}
+
+func TestRunner_PromptTemplateErrorsFailTheTask(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-e"))
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(filepath.Join(cmdDir, "prompts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"prompts/typo.tmpl": "Review {{.Repository}}",
+		"prompts/mine.tmpl": "Task {{.TaskID}} in {{.Mode}} mode\n{{include \"partials/extra-instructions\" .}}",
+	} {
+		if err := os.WriteFile(filepath.Join(cmdDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", t.TempDir())
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("CLAUDE_RETRIES", "0")
+	for _, name := range []string{"../github_token.txt", "/etc/passwd.tmpl"} {
+		if _, err := WriteTaskFile(cmdDir, TaskFile{ID: "path", PromptTemplate: name}); err == nil || !strings.Contains(err.Error(), "not a path") {
+			t.Fatalf("expected template path %s to be refused, got %v", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "github_token.txt"), []byte("ghp_secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tf := range []TaskFile{
+		{ID: "typo", PromptTemplate: "typo"},
+		{ID: "missing", PromptTemplate: "nope"},
+		{ID: "own", Prompt: "Be brief.", PromptTemplate: "mine.tmpl"},
+	} {
+		if _, err := WriteTaskFile(cmdDir, tf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The host can copy task files in without going through WriteTaskFile
+	escape := `{"id":"escape","promptTemplate":"../../github_token.txt"}`
+	if err := os.WriteFile(filepath.Join(queueDir(cmdDir), "99999999T999999.999999999-escape.json"), []byte(escape), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(tmp, "state.json")
+	if err := NewRunner().Drain(context.Background(), cmdDir, statePath); err != nil {
+		t.Fatal(err)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m.GetState().History
+	if len(h) != 3 || h[0].Status != string(FailureOther) || !strings.Contains(h[0].Error, "Repository") ||
+		h[1].Status != string(FailureOther) || !strings.Contains(h[1].Error, `unknown prompt template "nope"`) {
+		t.Fatalf("expected template errors to fail the tasks: %+v", h)
+	}
+	inv := fakeclaude.Invocations(t, rec)
+	if h[2].Status != taskstate.StatusDone || len(inv) != 1 || inv[0].Prompt != "Task own in create mode\nAdditional instructions:\nBe brief.\n" {
+		t.Fatalf("unexpected run of the prompts dir template: %+v %+v", h[2], inv)
+	}
+	if b, err := os.ReadFile(ResultPath(cmdDir, "escape")); err != nil || !strings.Contains(string(b), "not a path") {
+		t.Fatalf("expected a template path to be rejected: %v %s", err, b)
+	}
+}
@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+// TaskFile is a queued task dropped into <cmdDir>/queue by `worker enqueue`.
+// Files are picked up by Drain between tasks, so new work can be queued while
+// a task is running without touching state.json.
+type TaskFile struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	// PromptTemplate renders the prompt from a template, with Prompt as
+	// its .Prompt (see the prompt package).
+	PromptTemplate  string `json:"promptTemplate,omitempty"`
+	Repo            string `json:"repo,omitempty"`
+	Branch          string `json:"branch,omitempty"`
+	Mode            string `json:"mode,omitempty"`
+	ResumeSessionID string `json:"resumeSessionId,omitempty"`
+	PRNumber        int    `json:"prNumber,omitempty"`
+	CommentID       int64  `json:"commentId,omitempty"`
+	HeadSHA         string `json:"headSha,omitempty"`
+}
+
+func queueDir(cmdDir string) string { return filepath.Join(cmdDir, "queue") }
+
+// WriteTaskFile writes tf into the queue dir and returns its path. Files are
+// named by time so they are ingested in the order they were written.
+func WriteTaskFile(cmdDir string, tf TaskFile) (string, error) {
+	if strings.TrimSpace(tf.Prompt) == "" && strings.TrimSpace(tf.PromptTemplate) == "" {
+		return "", errors.New("task has no prompt or prompt template")
+	}
+	if _, err := ParseMode(tf.Mode); err != nil {
+		return "", err
+	}
+	if err := checkPromptTemplate(tf.PromptTemplate); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if strings.TrimSpace(tf.ID) == "" {
+		tf.ID = fmt.Sprintf("task-%d", now.UnixNano())
+	}
+	dir := queueDir(cmdDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("ensure queue dir: %w", err)
+	}
+	b, err := json.MarshalIndent(tf, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.json", now.Format("20060102T150405.000000000"), safeFileComponent(tf.ID))
+	path := filepath.Join(dir, name)
+	// Write then rename so Drain never reads a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// IngestTaskFiles moves the task files in the queue dir onto the state queue
+// and returns how many were added. State is saved before the files are
+// removed, so a crash in between queues a task twice rather than losing it.
+// Files that cannot be run are reported and moved to queue/rejected (see
+// rejectTaskFile).
+func IngestTaskFiles(cmdDir string, mgr *taskstate.Manager) (int, error) {
+	dir := queueDir(cmdDir)
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(paths) == 0 {
+		return 0, err
+	}
+	sort.Strings(paths)
+	var ingested []string
+	var errs []error
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var tf TaskFile
+		err = json.Unmarshal(b, &tf)
+		switch {
+		case err != nil:
+		case strings.TrimSpace(tf.ID) == "" || strings.TrimSpace(tf.Prompt) == "" && strings.TrimSpace(tf.PromptTemplate) == "":
+			err = errors.New("missing id or prompt")
+		default:
+			if _, err = ParseMode(tf.Mode); err == nil {
+				err = checkPromptTemplate(tf.PromptTemplate)
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", filepath.Base(p), err)
+			errs = append(errs, err, rejectTaskFile(cmdDir, p, strings.TrimSpace(tf.ID), err))
+			continue
+		}
+		data := map[string]any{}
+		for k, v := range map[string]string{
+			DataPrompt:          tf.Prompt,
+			DataPromptTemplate:  tf.PromptTemplate,
+			DataRepo:            tf.Repo,
+			DataBranch:          tf.Branch,
+			DataMode:            tf.Mode,
+			DataResumeSessionID: tf.ResumeSessionID,
+			DataHeadSHA:         tf.HeadSHA,
+		} {
+			if v != "" {
+				data[k] = v
+			}
+		}
+		if tf.PRNumber > 0 {
+			data[DataPRNumber] = tf.PRNumber
+		}
+		if tf.CommentID > 0 {
+			data[DataCommentID] = tf.CommentID
+		}
+		mgr.Enqueue(taskstate.Task{ID: tf.ID, Data: data})
+		ingested = append(ingested, p)
+	}
+	if len(ingested) > 0 {
+		if err := mgr.Save(); err != nil {
+			return 0, fmt.Errorf("save state: %w", err)
+		}
+		for _, p := range ingested {
+			if err := os.Remove(p); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return len(ingested), errors.Join(errs...)
+}
+
+// rejectTaskFile moves a task file that cannot be run to queue/rejected, so
+// it is reported once rather than on every poll. A file with an ID gets a
+// failed result file carrying err, so the host waiting for it hears back.
+func rejectTaskFile(cmdDir, path, id string, err error) error {
+	dir := filepath.Join(queueDir(cmdDir), "rejected")
+	if mkErr := os.MkdirAll(dir, 0o755); mkErr != nil {
+		return fmt.Errorf("ensure rejected dir: %w", mkErr)
+	}
+	if mvErr := os.Rename(path, filepath.Join(dir, filepath.Base(path))); mvErr != nil {
+		return mvErr
+	}
+	if id == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	return WriteTaskResult(cmdDir, taskstate.Task{
+		ID: id, Status: string(FailureOther), Error: err.Error(), ExitCode: exitCodes[FailureOther],
+		CreatedAt: now, UpdatedAt: now,
+	})
+}
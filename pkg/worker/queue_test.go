@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func TestIngestTaskFiles(t *testing.T) {
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	for _, tf := range []TaskFile{
+		{ID: "one", Prompt: "p1", Repo: "org/a", Branch: "dev"},
+		{ID: "two", Prompt: "p2", Mode: "resume", ResumeSessionID: "sess-1"},
+	} {
+		if _, err := WriteTaskFile(cmdDir, tf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := WriteTaskFile(cmdDir, TaskFile{ID: "empty"}); err == nil {
+		t.Fatal("expected a task without prompt to be rejected")
+	}
+	bad := filepath.Join(cmdDir, "queue", "zz-bad.json")
+	if err := os.WriteFile(bad, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	badMode := filepath.Join(cmdDir, "queue", "zz-mode.json")
+	if err := os.WriteFile(badMode, []byte(`{"id":"m","prompt":"p","mode":"deploy"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := taskstate.NewManager(filepath.Join(tmp, "state.json"))
+	n, err := IngestTaskFiles(cmdDir, mgr)
+	if n != 2 || err == nil {
+		t.Fatalf("expected 2 tasks and an error for the bad files, got %d, %v", n, err)
+	}
+	q := mgr.GetState().Queue
+	if len(q) != 2 || q[0].ID != "one" || q[1].ID != "two" {
+		t.Fatalf("unexpected queue: %+v", q)
+	}
+	if q[0].DataString(DataPrompt) != "p1" || q[0].DataString(DataRepo) != "org/a" || q[0].DataString(DataBranch) != "dev" {
+		t.Fatalf("unexpected data: %+v", q[0].Data)
+	}
+	if q[1].DataString(DataMode) != "resume" || q[1].DataString(DataResumeSessionID) != "sess-1" || q[1].DataString(DataRepo) != "" {
+		t.Fatalf("unexpected data: %+v", q[1].Data)
+	}
+	// Ingested tasks are saved before their files are removed
+	saved, err := taskstate.Load(mgr.Path())
+	if err != nil || len(saved.GetState().Queue) != 2 {
+		t.Fatalf("expected saved queue, got %v", err)
+	}
+	left, _ := filepath.Glob(filepath.Join(cmdDir, "queue", "*.json"))
+	rejected, _ := filepath.Glob(filepath.Join(cmdDir, "queue", "rejected", "*"))
+	if len(left) != 0 || len(rejected) != 2 {
+		t.Fatalf("expected the bad files to be moved to rejected, got %v and %v", left, rejected)
+	}
+	// The host hears back about a rejected task it can name
+	b, err := os.ReadFile(ResultPath(cmdDir, "m"))
+	if err != nil || !strings.Contains(string(b), `unknown task mode`) || !strings.Contains(string(b), `"status": "failed"`) {
+		t.Fatalf("expected a failed result for the rejected task: %v\n%s", err, b)
+	}
+	if n, err := IngestTaskFiles(cmdDir, mgr); n != 0 || err != nil {
+		t.Fatalf("rejected files should not be read again: %d, %v", n, err)
+	}
+}
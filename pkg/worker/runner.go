@@ -1,47 +1,123 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/your-org/claude-dev-setup/pkg/claude"
 	"github.com/your-org/claude-dev-setup/pkg/config"
+	"github.com/your-org/claude-dev-setup/pkg/github"
 	"github.com/your-org/claude-dev-setup/pkg/taskstate"
 )
 
-type Runner struct{}
+// Task.Data keys describing what a queued task runs. Tasks without them
+// fall back to the cmd dir files (prompt.txt, github_repo.txt, ...).
+const (
+	DataPrompt          = "prompt"
+	DataPromptTemplate  = "promptTemplate"
+	DataRepo            = "repo"
+	DataBranch          = "branch"
+	DataMode            = "mode"
+	DataResumeSessionID = "resumeSessionId"
+	DataPRNumber        = "prNumber"
+	// DataHeadSHA is the commit the task's worktree checks out; when unset
+	// the tip of the branch (or PR) is used and recorded here.
+	DataHeadSHA = "headSha"
+	// DataCommentID is the review comment an ask task replies to.
+	DataCommentID = "commentId"
+)
 
-func NewRunner() *Runner { return &Runner{} }
+type Runner struct {
+	// Prepare, when set, runs after the task is started and before Claude
+	// (GitHub auth, clone, permissions).
+	Prepare func(ctx context.Context, spec TaskSpec) error
+	// GitHub posts reviews and comments; nil means a client from
+	// GITHUB_TOKEN.
+	GitHub *github.Client
+	// Hooks run after each task has finished (see LoadHooks).
+	Hooks []Hook
+	// Worktrees, when set, checks every task that names a repo out into a
+	// worktree of its own (see Worktrees); CUSTOM_REPO_PATH still wins.
+	Worktrees *Worktrees
+	// Backend runs Claude; nil means one from BackendFromEnv, created on
+	// first use and kept for every task, so the API backend can resume the
+	// sessions of earlier tasks.
+	Backend claude.Backend
 
-type SessionFile struct {
-	SessionID string `json:"sessionId"`
+	// dirs serializes tasks that run in the same directory (the shared
+	// checkout or CUSTOM_REPO_PATH) when tasks run in parallel.
+	dirs keyedMutex
+
+	backendMu  sync.Mutex
+	envBackend claude.Backend
 }
 
-// Run performs worker orchestration: load config, ensure repo, write MCP config, generate permissions, start/complete task, persist state.
-func (r *Runner) Run(cmdDir, statePath, sessionPath string) error {
-	if cmdDir == "" || statePath == "" {
-		return errors.New("missing cmdDir or statePath")
+// backend is r.Backend, else the one backend built from the environment.
+func (r *Runner) backend() (claude.Backend, error) {
+	if r.Backend != nil {
+		return r.Backend, nil
 	}
-
-	// Load config (safe summary printed by caller if needed)
-	cfg, err := config.LoadFromDir(cmdDir)
-	if err != nil {
-		return fmt.Errorf("load config: %w", err)
+	r.backendMu.Lock()
+	defer r.backendMu.Unlock()
+	if r.envBackend == nil {
+		b, err := BackendFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		r.envBackend = b
 	}
+	return r.envBackend, nil
+}
 
-	// Ensure state directory exists
-	if err := os.MkdirAll(filepath.Dir(statePath), 0o755); err != nil {
-		return fmt.Errorf("ensure state dir: %w", err)
-	}
+func NewRunner() *Runner { return &Runner{} }
 
-	// Load state
-	mgr, err := taskstate.Load(statePath)
+type SessionFile struct {
+	SessionID string `json:"sessionId"`
+}
+
+// TaskSpec is what one task runs, resolved from its Data and the defaults
+// of the cmd dir.
+type TaskSpec struct {
+	// TaskID is the task being run.
+	TaskID string
+	Prompt string
+	// PromptTemplate names the template the prompt is rendered from, with
+	// Prompt available to it as .Prompt (see renderPrompt).
+	PromptTemplate string
+	// Repo is owner/name; Branch is checked out before the run.
+	Repo   string
+	Branch string
+	// Mode is the task mode (see ParseMode).
+	Mode            string
+	ResumeSessionID string
+	// PRNumber is the PR a review or answer is posted to; CommentID the
+	// review comment an answer replies to.
+	PRNumber  int
+	CommentID int64
+	// HeadSHA pins the commit checked out; empty means the tip of Branch.
+	HeadSHA string
+	// RepoDir is where the repository is checked out.
+	RepoDir string
+	// AllowedTools and DisallowedTools are what Claude runs with, derived
+	// from the whitelist and the mode.
+	AllowedTools    []string
+	DisallowedTools []string
+}
+
+// Run performs worker orchestration: load config, ensure repo, write MCP config, generate permissions, start/complete task, persist state.
+// Cancelling ctx stops Claude, marks the current task interrupted and saves state before returning.
+func (r *Runner) Run(ctx context.Context, cmdDir, statePath, sessionPath string) error {
+	cfg, mgr, err := loadRun(cmdDir, statePath)
 	if err != nil {
-		return fmt.Errorf("load state: %w", err)
+		return err
 	}
 
 	// Start next if none; if queue empty and we have a prompt, enqueue a task in create mode
@@ -62,7 +138,43 @@ func (r *Runner) Run(cmdDir, statePath, sessionPath string) error {
 		}
 	}
 
-	// If a prompt file exists use it; otherwise attempt to read prompt.txt
+	defaults := runDefaults(cfg, readRunPrompt(cfg))
+
+	// If no current task and we have a prompt, enqueue and start
+	st = mgr.GetState()
+	if st.Current == nil && (defaults.Prompt != "" || defaults.PromptTemplate != "") {
+		mgr.Enqueue(taskstate.Task{ID: newRunTaskID(cfg)})
+		mgr.StartNext()
+	}
+
+	var id string
+	if cur := mgr.GetState().Current; cur != nil {
+		id = cur.ID
+		err = r.runTask(ctx, cmdDir, sessionPath, mgr, defaults, id)
+	}
+	r.afterTask(ctx, mgr, id)
+	if err != nil {
+		return err
+	}
+
+	// Persist
+	if err := mgr.Save(); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+
+	return nil
+}
+
+// readRunPrompt reads the prompt of the cmd dir: the plain file
+// prompt_filename.txt names, else the first prompt file present, otherwise
+// attempt to read prompt.txt.
+func readRunPrompt(cfg *config.Config) string {
+	cmdDir := cfg.BaseDir
+	if name := promptFileName(cfg); name != "" && !isPromptTemplate(name) {
+		if b, err := os.ReadFile(cmdDirPath(cmdDir, name)); err == nil {
+			return string(b)
+		}
+	}
 	prompt := config.ReadPromptFrom(cmdDir)
 	if prompt == "" {
 		// fallback to reading prompt.txt
@@ -71,60 +183,404 @@ func (r *Runner) Run(cmdDir, statePath, sessionPath string) error {
 			prompt = string(b)
 		}
 	}
+	return prompt
+}
 
-	// If no current task and we have a prompt, enqueue and start
-	st = mgr.GetState()
-	if st.Current == nil && prompt != "" {
-		// Prefer provided task ID when present; otherwise generate one
-		id := cfg.TaskID
-		if strings.TrimSpace(id) == "" {
-			id = fmt.Sprintf("task-%d", time.Now().Unix())
+// newRunTaskID prefers the provided task ID when present; otherwise it
+// generates one.
+func newRunTaskID(cfg *config.Config) string {
+	if id := cfg.TaskID; strings.TrimSpace(id) != "" {
+		return id
+	}
+	return fmt.Sprintf("task-%d", time.Now().Unix())
+}
+
+// runDefaults is what Run's task falls back to: the cmd dir files and env.
+func runDefaults(cfg *config.Config, prompt string) TaskSpec {
+	return TaskSpec{
+		Prompt:          prompt,
+		PromptTemplate:  promptTemplateName(cfg),
+		Repo:            defaultRepo(cfg),
+		Branch:          defaultBranch(cfg),
+		Mode:            cfg.TaskMode,
+		ResumeSessionID: cfg.ResumeSessionID,
+		PRNumber:        envInt("PR_NUMBER"),
+	}
+}
+
+// Drain runs queued tasks one after another until the queue is empty: a
+// leftover current task first, then the state queue, picking up task files
+// dropped into <cmdDir>/queue between tasks. Each task's result is saved to
+// state and to <cmdDir>/results as it finishes and a failed task does not
+// stop the loop. Queued tasks carry their own prompt; prompt.txt is not used.
+// Only repo and branch fall back to the cmd dir.
+func (r *Runner) Drain(ctx context.Context, cmdDir, statePath string) error {
+	cfg, mgr, err := loadRun(cmdDir, statePath)
+	if err != nil {
+		return err
+	}
+	defaults := TaskSpec{Repo: defaultRepo(cfg), Branch: defaultBranch(cfg)}
+	done, failed, err := r.drainQueue(ctx, cmdDir, mgr, defaults, 1, defaultPollInterval)
+	fmt.Printf("[INFO] Drained %d task(s): %d done, %d failed\n", done+failed, done, failed)
+	if err != nil {
+		return err
+	}
+	if err := mgr.Save(); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("drain interrupted: %w", ctx.Err())
+	}
+	return nil
+}
+
+// drainQueue runs queued tasks, up to concurrency at a time, until the queue
+// is empty and no task is running, or ctx is done. While tasks run the queue
+// dir is checked every poll for work to fill free slots. Tasks left running
+// by an earlier worker start first. It returns an error only when state
+// cannot be saved or a task was interrupted; either way it waits for the
+// tasks already started.
+func (r *Runner) drainQueue(ctx context.Context, cmdDir string, mgr *taskstate.Manager, defaults TaskSpec, concurrency int, poll time.Duration) (done, failed int, err error) {
+	if n := mgr.RequeueRunning(); n > 0 {
+		fmt.Printf("[INFO] Requeued %d task(s) left running by an earlier worker\n", n)
+	}
+	type finished struct {
+		id  string
+		err error
+	}
+	results := make(chan finished)
+	running := 0
+	for {
+		for err == nil && ctx.Err() == nil && running < concurrency {
+			if _, ierr := IngestTaskFiles(cmdDir, mgr); ierr != nil {
+				fmt.Fprintf(os.Stderr, "[WARNING] reading queued task files: %v\n", ierr)
+			}
+			task, ok := mgr.StartTask()
+			if !ok {
+				break
+			}
+			if serr := mgr.Save(); serr != nil {
+				err = fmt.Errorf("save state: %w", serr)
+			}
+			running++
+			fmt.Printf("[INFO] Starting task %s (%d running, %d queued)\n", task.ID, running, len(mgr.GetState().Queue))
+			go func(id string) {
+				results <- finished{id, r.runQueued(ctx, cmdDir, mgr, defaults, id)}
+			}(task.ID)
+		}
+		if running == 0 {
+			return done, failed, err
+		}
+		var tick <-chan time.Time
+		if err == nil && ctx.Err() == nil {
+			tick = time.After(poll)
+		}
+		select {
+		case f := <-results:
+			running--
+			switch {
+			case ctx.Err() != nil:
+				if err == nil {
+					err = f.err
+				}
+			case f.err != nil:
+				failed++
+				fmt.Fprintf(os.Stderr, "[ERROR] task %s failed: %v\n", f.id, f.err)
+			default:
+				done++
+			}
+		case <-tick:
+		}
+	}
+}
+
+// runQueued runs in-flight task id, then its hooks, and writes its result.
+func (r *Runner) runQueued(ctx context.Context, cmdDir string, mgr *taskstate.Manager, defaults TaskSpec, id string) error {
+	// Each task has its own session file; session.json belongs to `worker run`
+	sessionPath := filepath.Join(os.Getenv("HOME"), "claude", "sessions", safeFileComponent(id)+".json")
+	if err := os.MkdirAll(filepath.Dir(sessionPath), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] ensure session dir: %v\n", err)
+	}
+	runErr := r.runTask(ctx, cmdDir, sessionPath, mgr, defaults, id)
+	if _, ok := mgr.Task(id); runErr == nil && ok {
+		// runTask leaves a task without prompt in place; fail it so the
+		// loop moves on
+		runErr = failTask(mgr, id, errors.New("task has no prompt"))
+	}
+	if task, ok := r.afterTask(ctx, mgr, id); ok {
+		if err := WriteTaskResult(cmdDir, task); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARNING] writing result of task %s: %v\n", id, err)
 		}
-		mgr.Enqueue(taskstate.Task{ID: id})
-		mgr.StartNext()
 	}
+	return runErr
+}
+
+// afterTask runs the hooks of task id if runTask finished it, and returns
+// the finished task.
+func (r *Runner) afterTask(ctx context.Context, mgr *taskstate.Manager, id string) (taskstate.Task, bool) {
+	if id == "" {
+		return taskstate.Task{}, false
+	}
+	if _, running := mgr.Task(id); running {
+		return taskstate.Task{}, false
+	}
+	task, ok := mgr.LastFinished(id)
+	if !ok {
+		return task, false
+	}
+	r.runHooks(ctx, mgr, task)
+	return mgr.LastFinished(id)
+}
+
+func loadRun(cmdDir, statePath string) (*config.Config, *taskstate.Manager, error) {
+	if cmdDir == "" || statePath == "" {
+		return nil, nil, errors.New("missing cmdDir or statePath")
+	}
+
+	// Load config (safe summary printed by caller if needed)
+	cfg, err := config.LoadFromDir(cmdDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+
+	// Ensure state directory exists
+	if err := os.MkdirAll(filepath.Dir(statePath), 0o755); err != nil {
+		return nil, nil, fmt.Errorf("ensure state dir: %w", err)
+	}
+
+	// Load state
+	mgr, err := taskstate.Load(statePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load state: %w", err)
+	}
+	return cfg, mgr, nil
+}
+
+func defaultRepo(cfg *config.Config) string {
+	if cfg.GitHub.Repo != "" {
+		return cfg.GitHub.Repo
+	}
+	return os.Getenv("GITHUB_REPO")
+}
+
+func envInt(key string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	return n
+}
+
+func defaultBranch(cfg *config.Config) string {
+	if cfg.GitHub.Branch != "" {
+		return cfg.GitHub.Branch
+	}
+	return os.Getenv("GITHUB_BRANCH")
+}
+
+// resolveTaskSpec fills defaults with what task carries in Data.
+func resolveTaskSpec(task taskstate.Task, defaults TaskSpec) TaskSpec {
+	spec := defaults
+	set := func(dst *string, key string) {
+		if v := strings.TrimSpace(task.DataString(key)); v != "" {
+			*dst = v
+		}
+	}
+	set(&spec.Repo, DataRepo)
+	set(&spec.Branch, DataBranch)
+	set(&spec.Mode, DataMode)
+	set(&spec.PromptTemplate, DataPromptTemplate)
+	set(&spec.ResumeSessionID, DataResumeSessionID)
+	set(&spec.HeadSHA, DataHeadSHA)
+	if n := task.DataInt(DataPRNumber); n > 0 {
+		spec.PRNumber = int(n)
+	}
+	if n := task.DataInt(DataCommentID); n > 0 {
+		spec.CommentID = n
+	}
+	if p := task.DataString(DataPrompt); strings.TrimSpace(p) != "" {
+		spec.Prompt = p
+	}
+	ownRepo := spec.Repo != "" && spec.Repo != defaults.Repo
 
 	// Determine repo directory: CUSTOM_REPO_PATH (absolute or HOME-relative),
-	// or default to /home/owner/claude/target-repo
-	repoDir := os.Getenv("CUSTOM_REPO_PATH")
-	if repoDir != "" && !filepath.IsAbs(repoDir) {
-		repoDir = filepath.Join(os.Getenv("HOME"), repoDir)
+	// a per-repo checkout for tasks naming another repo, or default to
+	// /home/owner/claude/target-repo
+	home := os.Getenv("HOME")
+	spec.RepoDir = os.Getenv("CUSTOM_REPO_PATH")
+	if spec.RepoDir != "" && !filepath.IsAbs(spec.RepoDir) {
+		spec.RepoDir = filepath.Join(home, spec.RepoDir)
+	}
+	if spec.RepoDir == "" && ownRepo {
+		spec.RepoDir = filepath.Join(home, "claude", "repos", filepath.FromSlash(safeRepoPath(spec.Repo)))
 	}
-	if repoDir == "" {
-		repoDir = filepath.Join(os.Getenv("HOME"), "claude", "target-repo")
+	if spec.RepoDir == "" {
+		spec.RepoDir = filepath.Join(home, "claude", "target-repo")
+	}
+	return spec
+}
+
+// safeRepoPath maps owner/name to a relative path that cannot escape its parent.
+func safeRepoPath(repo string) string {
+	part := func(s string) string {
+		s = safeFileComponent(s)
+		if s == "" || s == "." || s == ".." {
+			return "_"
+		}
+		return s
+	}
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return part(repo)
+	}
+	return part(owner) + "/" + part(name)
+}
+
+// runTask runs in-flight task id to completion. A task without a prompt is
+// left in flight.
+func (r *Runner) runTask(ctx context.Context, cmdDir, sessionPath string, mgr *taskstate.Manager, defaults TaskSpec, id string) error {
+	task, ok := mgr.Task(id)
+	if !ok {
+		return nil
+	}
+	spec := resolveTaskSpec(task, defaults)
+	spec.TaskID = id
+
+	// Record the repo on the task so usage can be totalled per repo
+	if task.DataString(DataRepo) == "" && spec.Repo != "" {
+		mgr.SetTaskData(id, DataRepo, spec.Repo)
 	}
 
 	// Execute Claude stream-json in the repo directory
-	if st := mgr.GetState(); st.Current != nil && prompt != "" {
-		debug := os.Getenv("DEBUG_MODE") == "true"
-		// Derive allowed/disallowed tools from whitelist
-		allowedTools, _ := ParseToolsFromWhitelist(cmdDir)
-		// If Task is not explicitly allowed, disallow it to force Write/Edit usage
-		disallowed := []string{}
-		hasTask := false
-		for _, t := range allowedTools {
-			if t == "Task" {
-				hasTask = true
-				break
+	if spec.Prompt == "" && spec.PromptTemplate == "" {
+		return nil
+	}
+	var (
+		wt     *Worktree
+		unlock func()
+		opts   StreamOptions
+	)
+	defer func() {
+		// Collect artifacts while the checkout is still there
+		collectArtifacts(cmdDir, mgr, spec, opts)
+		if unlock != nil {
+			unlock()
+		}
+		if wt != nil {
+			if err := r.Worktrees.Remove(ctx, wt); err != nil {
+				fmt.Fprintf(os.Stderr, "[WARNING] removing worktree %s: %v\n", wt.Dir, err)
 			}
 		}
-		if !hasTask {
-			disallowed = append(disallowed, "Task")
+	}()
+	mode, err := ParseMode(spec.Mode)
+	if err == nil {
+		err = mode.checkSpec(spec)
+	}
+	if err != nil {
+		return failTask(mgr, id, err)
+	}
+	mgr.SetTaskData(id, DataMode, string(mode))
+	// Derive allowed/disallowed tools from the whitelist and the mode
+	whitelist, _ := ParseToolsFromWhitelist(cmdDir)
+	spec.AllowedTools, spec.DisallowedTools = mode.Tools(whitelist)
+	if r.Worktrees != nil && spec.Repo != "" && os.Getenv("CUSTOM_REPO_PATH") == "" {
+		ref := Ref{SHA: spec.HeadSHA, Branch: spec.Branch, PRNumber: spec.PRNumber}
+		wt, err = r.Worktrees.Add(ctx, id, spec.Repo, ref)
+		if err != nil {
+			return failTask(mgr, id, repoError(ctx, err))
 		}
-		permMode := os.Getenv("CLAUDE_PERMISSION_MODE")
-		if permMode == "" {
-			permMode = "default"
+		spec.RepoDir, spec.HeadSHA = wt.Dir, wt.HeadSHA
+		mgr.SetTaskData(id, DataHeadSHA, wt.HeadSHA)
+		fmt.Printf("[INFO] Checked out %s at %.12s in %s\n", spec.Repo, wt.HeadSHA, wt.Dir)
+	} else {
+		// Tasks sharing a checkout take turns
+		unlock = r.dirs.lock(spec.RepoDir)
+	}
+	if r.Prepare != nil {
+		if err := r.Prepare(ctx, spec); err != nil {
+			return failTask(mgr, id, err)
 		}
-		if err := RunClaudeStream(os.Getenv("HOME"), repoDir, prompt, mgr, debug, allowedTools, disallowed, permMode); err != nil {
-			// If Claude is unavailable in unit tests, fall back to completing current
-			mgr.CompleteCurrent("done")
+	}
+	if spec.PromptTemplate != "" {
+		if spec.Prompt, err = r.renderPrompt(ctx, cmdDir, spec, mode); err != nil {
+			return failTask(mgr, id, err)
 		}
 	}
+	opts, err = r.streamOptions(spec, mode, sessionPath, mgr)
+	if err != nil {
+		return failTask(mgr, id, err)
+	}
+	opts.Finish = r.finish(mode, spec, mgr)
+	if mode == ModeResume && opts.ResumeSessionID == "" {
+		fmt.Fprintln(os.Stderr, "[WARNING] resume requested but no stored session found; starting a fresh session")
+	}
+	// RunClaudeStream completes (or fails) the task and saves state
+	return RunClaudeStream(ctx, opts, mgr)
+}
 
-	// Persist
-	if err := mgr.Save(); err != nil {
-		return fmt.Errorf("save state: %w", err)
+// streamOptions is how the task of spec runs Claude in mode, read from the
+// environment; Finish is left to the caller.
+func (r *Runner) streamOptions(spec TaskSpec, mode Mode, sessionPath string, mgr *taskstate.Manager) (StreamOptions, error) {
+	debug := os.Getenv("DEBUG_MODE") == "true"
+	permMode := os.Getenv("CLAUDE_PERMISSION_MODE")
+	if permMode == "" {
+		permMode = "default"
+	}
+	backend, err := r.backend()
+	if err != nil {
+		return StreamOptions{}, err
+	}
+	limits, err := LimitsFromEnv()
+	if err != nil {
+		return StreamOptions{}, err
 	}
+	retry, err := RetryPolicyFromEnv()
+	if err != nil {
+		return StreamOptions{}, err
+	}
+	opts := StreamOptions{
+		TaskID:          spec.TaskID,
+		Backend:         backend,
+		HomeDir:         os.Getenv("HOME"),
+		SessionPath:     sessionPath,
+		RepoDir:         spec.RepoDir,
+		Prompt:          spec.Prompt,
+		Debug:           debug,
+		AllowedTools:    spec.AllowedTools,
+		DisallowedTools: spec.DisallowedTools,
+		PermissionMode:  permMode,
+		// Review mode and STRUCTURED_REVIEW=true ask Claude for a JSON review document
+		StructuredReview: mode == ModeReview || os.Getenv("STRUCTURED_REVIEW") == "true",
+		Limits:           limits,
+		Retry:            retry,
+	}
+	if mode == ModeResume {
+		cur, _ := mgr.Task(spec.TaskID)
+		opts.ResumeSessionID = resolveResumeSession(spec.ResumeSessionID, cur, mgr.GetState(), sessionPath)
+	}
+	return opts, nil
+}
 
-	return nil
+// resolveResumeSession picks the session follow-up task cur continues, in
+// order: the explicit session (resume_session_id.txt or the task's
+// resumeSessionId), the latest finished task with the same ID (e.g. a second
+// comment on the same PR), the task's linked session, then the session file.
+func resolveResumeSession(explicit string, cur taskstate.Task, st taskstate.State, sessionPath string) string {
+	if explicit != "" {
+		return explicit
+	}
+	for i := len(st.History) - 1; i >= 0; i-- {
+		if h := st.History[i]; h.ID == cur.ID && h.SessionID != "" {
+			return h.SessionID
+		}
+	}
+	if cur.SessionID != "" {
+		return cur.SessionID
+	}
+	if sessionPath != "" {
+		if b, err := os.ReadFile(sessionPath); err == nil {
+			var s SessionFile
+			if json.Unmarshal(b, &s) == nil {
+				return s.SessionID
+			}
+		}
+	}
+	return ""
 }
@@ -1,20 +1,35 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
 	"github.com/your-org/claude-dev-setup/pkg/taskstate"
 )
 
 func TestRunner_Run_StartsNextAndLinksSession(t *testing.T) {
+	fakeclaude.Setup(t)
 	tmp := t.TempDir()
 	cmdDir := filepath.Join(tmp, "cmd")
-	if err := os.MkdirAll(cmdDir, 0o755); err != nil {
-		t.Fatal(err)
+	for _, d := range []string{cmdDir, filepath.Join(tmp, "claude", "target-repo")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
 	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
 	// minimal required file
 	if err := os.WriteFile(filepath.Join(cmdDir, "prompt.txt"), []byte("x\n"), 0o644); err != nil {
 		t.Fatal(err)
@@ -37,7 +52,7 @@ func TestRunner_Run_StartsNextAndLinksSession(t *testing.T) {
 
 	r := NewRunner()
 	t.Setenv("DEBUG_MODE", "false")
-	if err := r.Run(cmdDir, statePath, sessPath); err != nil {
+	if err := r.Run(context.Background(), cmdDir, statePath, sessPath); err != nil {
 		t.Fatalf("run: %v", err)
 	}
 
@@ -50,7 +65,305 @@ func TestRunner_Run_StartsNextAndLinksSession(t *testing.T) {
 	if st.Current != nil {
 		t.Fatalf("expected current to be cleared after run; got: %+v", st.Current)
 	}
-	if len(st.History) != 1 || st.History[0].ID != "t1" || st.History[0].SessionID != "sess-1" || st.History[0].Status == "" {
+	if len(st.History) != 1 || st.History[0].ID != "t1" || st.History[0].SessionID != "sess-1" || st.History[0].Status != taskstate.StatusDone {
 		t.Fatalf("unexpected history: %+v", st.History)
 	}
 }
+
+func TestRunner_Run_PassesWhitelistToClaude(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-run"))
+	tmp := t.TempDir()
+	home := filepath.Join(tmp, "home")
+	cmdDir := filepath.Join(tmp, "cmd")
+	repoDir := filepath.Join(home, "claude", "target-repo")
+	for _, d := range []string{cmdDir, repoDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	if err := os.WriteFile(filepath.Join(cmdDir, "prompt.txt"), []byte("review please"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cmdDir, "task_id.txt"), []byte("pr-9"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cmdDir, "tool_whitelist.txt"), []byte(`["Read","Bash(gh pr diff:*)"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	statePath := filepath.Join(tmp, "state.json")
+	if err := NewRunner().Run(context.Background(), cmdDir, statePath, ""); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	inv := fakeclaude.Invocations(t, rec)
+	if len(inv) != 1 || inv[0].Dir != repoDir || inv[0].Prompt != "review please" {
+		t.Fatalf("unexpected invocations: %+v", inv)
+	}
+	if got := inv[0].AllowedTools; len(got) != 2 || got[1] != "Bash(gh pr diff:*)" {
+		t.Fatalf("unexpected allowed tools: %v", got)
+	}
+	if got := inv[0].DisallowedTools; len(got) != 1 || got[0] != "Task" {
+		t.Fatalf("expected Task to be disallowed, got %v", got)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := m.GetState().History; len(h) != 1 || h[0].ID != "pr-9" || h[0].SessionID != "sess-run" {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+}
+
+func TestResolveResumeSession(t *testing.T) {
+	sessPath := filepath.Join(t.TempDir(), "session.json")
+	if err := os.WriteFile(sessPath, []byte(`{"sessionId":"from-file"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cur := taskstate.Task{ID: "pr-1"}
+	st := taskstate.State{
+		History: []taskstate.Task{{ID: "pr-1", SessionID: "first"}, {ID: "pr-2", SessionID: "other"}, {ID: "pr-1", SessionID: "latest"}},
+	}
+	if got := resolveResumeSession("", cur, st, sessPath); got != "latest" {
+		t.Fatalf("expected latest session of same task, got %q", got)
+	}
+	if got := resolveResumeSession("explicit", cur, st, sessPath); got != "explicit" {
+		t.Fatalf("expected explicit session, got %q", got)
+	}
+	cur.ID = "pr-3"
+	if got := resolveResumeSession("", cur, st, sessPath); got != "from-file" {
+		t.Fatalf("expected session.json fallback, got %q", got)
+	}
+}
+
+func TestRunner_Run_RecordsPrepareFailure(t *testing.T) {
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(cmdDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cmdDir, "prompt.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(tmp, "state.json")
+	r := NewRunner()
+	r.Prepare = func(ctx context.Context, spec TaskSpec) error {
+		return &TaskError{Kind: FailureAuth, Err: errors.New("gh repo clone: exit status 1: fatal: Authentication failed")}
+	}
+
+	err := r.Run(context.Background(), cmdDir, statePath, "")
+	if ExitCode(err) != 11 {
+		t.Fatalf("expected auth_failed exit code 11, got %d (%v)", ExitCode(err), err)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := m.GetState()
+	if st.Current != nil || len(st.History) != 1 || st.History[0].Status != "auth_failed" || !strings.Contains(st.History[0].Error, "Authentication failed") {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+}
+
+func TestRunner_Drain_RunsQueuedTasksInOrder(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-a"), fakeclaude.DefaultScript("sess-b"))
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	repoDir := filepath.Join(tmp, "claude", "target-repo")
+	for _, d := range []string{cmdDir, repoDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	// prompt.txt belongs to single runs and must not leak into queued tasks
+	if err := os.WriteFile(filepath.Join(cmdDir, "prompt.txt"), []byte("legacy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tf := range []TaskFile{{ID: "a", Prompt: "first"}, {ID: "b", Prompt: "second"}} {
+		if _, err := WriteTaskFile(cmdDir, tf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statePath := filepath.Join(tmp, "state.json")
+	var prepared []string
+	r := NewRunner()
+	r.Prepare = func(ctx context.Context, spec TaskSpec) error {
+		prepared = append(prepared, spec.RepoDir)
+		return nil
+	}
+	if err := r.Drain(context.Background(), cmdDir, statePath); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+
+	inv := fakeclaude.Invocations(t, rec)
+	if len(inv) != 2 || inv[0].Prompt != "first" || inv[1].Prompt != "second" {
+		t.Fatalf("unexpected invocations: %+v", inv)
+	}
+	if len(prepared) != 2 || prepared[0] != repoDir {
+		t.Fatalf("unexpected prepared repo dirs: %v", prepared)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := m.GetState()
+	if st.Current != nil || len(st.Queue) != 0 || len(st.History) != 2 {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+	for i, want := range []string{"a", "b"} {
+		if h := st.History[i]; h.ID != want || h.Status != taskstate.StatusDone {
+			t.Fatalf("history[%d] = %+v, want %s done", i, h, want)
+		}
+	}
+	if left, _ := filepath.Glob(filepath.Join(cmdDir, "queue", "*")); len(left) != 0 {
+		t.Fatalf("expected queue dir to be emptied, got %v", left)
+	}
+}
+
+func TestRunner_Drain_ContinuesAfterFailure(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-b"))
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(filepath.Join(tmp, "claude", "target-repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	for _, tf := range []TaskFile{{ID: "a", Prompt: "first", Repo: "org/gone"}, {ID: "b", Prompt: "second"}} {
+		if _, err := WriteTaskFile(cmdDir, tf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statePath := filepath.Join(tmp, "state.json")
+	r := NewRunner()
+	r.Prepare = func(ctx context.Context, spec TaskSpec) error {
+		if spec.Repo == "org/gone" {
+			return &TaskError{Kind: FailureClone, Err: errors.New("repository not found")}
+		}
+		return nil
+	}
+	if err := r.Drain(context.Background(), cmdDir, statePath); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if inv := fakeclaude.Invocations(t, rec); len(inv) != 1 || inv[0].Prompt != "second" {
+		t.Fatalf("unexpected invocations: %+v", inv)
+	}
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m.GetState().History
+	if len(h) != 2 || h[0].Status != string(FailureClone) || h[1].Status != taskstate.StatusDone {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+}
+
+func TestRunner_Drain_FailsTaskWithoutPrompt(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-b"))
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(filepath.Join(tmp, "claude", "target-repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	if _, err := WriteTaskFile(cmdDir, TaskFile{ID: "b", Prompt: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	// A task Run started from prompt.txt and left behind by a crash
+	statePath := filepath.Join(tmp, "state.json")
+	m, err := taskstate.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Enqueue(taskstate.Task{ID: "stale"})
+	m.StartNext()
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := NewRunner().Drain(ctx, cmdDir, statePath); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if inv := fakeclaude.Invocations(t, rec); len(inv) != 1 || inv[0].Prompt != "second" {
+		t.Fatalf("unexpected invocations: %+v", inv)
+	}
+	if m, err = taskstate.Load(statePath); err != nil {
+		t.Fatal(err)
+	}
+	h := m.GetState().History
+	if len(h) != 2 || h[0].ID != "stale" || h[0].Status == taskstate.StatusDone || !strings.Contains(h[0].Error, "no prompt") ||
+		h[1].Status != taskstate.StatusDone {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+}
+
+func TestRunner_APIBackendResumesEarlierTask(t *testing.T) {
+	var mu sync.Mutex
+	var counts []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []json.RawMessage `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		counts = append(counts, len(req.Messages))
+		mu.Unlock()
+		io.WriteString(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"end_turn",
+			"content":[{"type":"text","text":"done"}],"usage":{"input_tokens":10,"output_tokens":5}}`)
+	}))
+	defer srv.Close()
+	t.Setenv("CLAUDE_BACKEND", "api")
+	t.Setenv("ANTHROPIC_API_KEY", "k")
+	t.Setenv("ANTHROPIC_BASE_URL", srv.URL)
+
+	h := drainTasks(t, NewRunner(), t.TempDir(),
+		TaskFile{ID: "t", Prompt: "first"},
+		TaskFile{ID: "t", Prompt: "follow up", Mode: "resume"},
+	)
+	if len(h) != 2 || h[1].Status != taskstate.StatusDone || h[1].Data["resumeFallback"] != nil || h[1].SessionID != h[0].SessionID {
+		t.Fatalf("expected the follow-up to resume the first session: %+v", h)
+	}
+	if len(counts) != 2 || counts[1] != 3 {
+		t.Fatalf("expected the follow-up to send the earlier conversation, got message counts %v", counts)
+	}
+}
+
+func TestResolveTaskSpec(t *testing.T) {
+	t.Setenv("HOME", "/home/owner")
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	defaults := TaskSpec{Prompt: "default", Repo: "org/main", Branch: "main"}
+
+	spec := resolveTaskSpec(taskstate.Task{ID: "t"}, defaults)
+	if spec.Prompt != "default" || spec.RepoDir != "/home/owner/claude/target-repo" {
+		t.Fatalf("unexpected default spec: %+v", spec)
+	}
+	task := taskstate.Task{ID: "t", Data: map[string]any{DataPrompt: "p", DataRepo: "org/other", DataBranch: "dev", DataMode: "resume"}}
+	spec = resolveTaskSpec(task, defaults)
+	if spec.Prompt != "p" || spec.Repo != "org/other" || spec.Branch != "dev" || spec.Mode != "resume" || spec.RepoDir != "/home/owner/claude/repos/org/other" {
+		t.Fatalf("unexpected spec: %+v", spec)
+	}
+	task.Data[DataRepo] = "../.."
+	if spec = resolveTaskSpec(task, defaults); !strings.HasPrefix(spec.RepoDir, "/home/owner/claude/repos/") {
+		t.Fatalf("repo dir escaped the repos dir: %s", spec.RepoDir)
+	}
+	t.Setenv("CUSTOM_REPO_PATH", "work/repo")
+	if spec = resolveTaskSpec(task, defaults); spec.RepoDir != "/home/owner/work/repo" {
+		t.Fatalf("expected CUSTOM_REPO_PATH to win, got %s", spec.RepoDir)
+	}
+}
@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// ServeOptions configures Runner.Serve.
+type ServeOptions struct {
+	// PollInterval is how often the queue dir is checked while idle
+	// (default 2s).
+	PollInterval time.Duration
+	// Concurrency is the number of tasks run at once (default 1). Tasks
+	// with a worktree of their own run in parallel; tasks sharing a
+	// directory take turns.
+	Concurrency int
+}
+
+// Serve keeps the worker running: it watches <cmdDir>/queue for task files
+// written by `worker enqueue` (or copied in by the host), runs them like
+// Drain and writes a result file per task to <cmdDir>/results. Cancelling
+// ctx while idle returns nil; cancelling it during a task marks the task
+// interrupted and returns its error.
+func (r *Runner) Serve(ctx context.Context, cmdDir, statePath string, opts ServeOptions) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d: must be at least 1", opts.Concurrency)
+	}
+	cfg, mgr, err := loadRun(cmdDir, statePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(queueDir(cmdDir), 0o755); err != nil {
+		return fmt.Errorf("ensure queue dir: %w", err)
+	}
+	defaults := TaskSpec{Repo: defaultRepo(cfg), Branch: defaultBranch(cfg)}
+	fmt.Printf("[INFO] Watching %s for tasks\n", queueDir(cmdDir))
+	for {
+		done, failed, err := r.drainQueue(ctx, cmdDir, mgr, defaults, opts.Concurrency, opts.PollInterval)
+		if done+failed > 0 {
+			fmt.Printf("[INFO] Ran %d task(s): %d done, %d failed; waiting for tasks\n", done+failed, done, failed)
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("[INFO] Stopping worker")
+			if err := mgr.Save(); err != nil {
+				return fmt.Errorf("save state: %w", err)
+			}
+			return nil
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+func resultsDir(cmdDir string) string { return filepath.Join(cmdDir, "results") }
+
+// ResultPath is where the result of task id is written.
+func ResultPath(cmdDir, id string) string {
+	return filepath.Join(resultsDir(cmdDir), safeFileComponent(id)+".json")
+}
+
+// WriteTaskResult writes the finished task (status, error, exit code,
+// session, usage and data) to <cmdDir>/results/<id>.json. A later task with
+// the same ID replaces the file. The file is renamed into place so the host
+// never reads a partial result.
+func WriteTaskResult(cmdDir string, task taskstate.Task) error {
+	if task.ID == "" {
+		return errors.New("task has no ID")
+	}
+	if err := os.MkdirAll(resultsDir(cmdDir), 0o755); err != nil {
+		return fmt.Errorf("ensure results dir: %w", err)
+	}
+	b, err := json.MarshalIndent(task, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := ResultPath(cmdDir, task.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
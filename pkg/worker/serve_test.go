@@ -0,0 +1,155 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func TestRunner_Serve_RunsDroppedTasksAndWritesResults(t *testing.T) {
+	rec := fakeclaude.Setup(t, fakeclaude.DefaultScript("sess-served"))
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	for _, d := range []string{cmdDir, filepath.Join(tmp, "claude", "target-repo")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	statePath := filepath.Join(tmp, "state.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- NewRunner().Serve(ctx, cmdDir, statePath, ServeOptions{PollInterval: 10 * time.Millisecond})
+	}()
+
+	// Dropped after the worker started
+	if _, err := WriteTaskFile(cmdDir, TaskFile{ID: "pr-7", Prompt: "review"}); err != nil {
+		t.Fatal(err)
+	}
+	resultPath := ResultPath(cmdDir, "pr-7")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(resultPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the result file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	b, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res taskstate.Task
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != "pr-7" || res.Status != taskstate.StatusDone || res.SessionID != "sess-served" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if inv := fakeclaude.Invocations(t, rec); len(inv) != 1 || inv[0].Prompt != "review" {
+		t.Fatalf("unexpected invocations: %+v", inv)
+	}
+}
+
+func TestRunner_Serve_RejectsInvalidConcurrency(t *testing.T) {
+	tmp := t.TempDir()
+	err := NewRunner().Serve(context.Background(), tmp, filepath.Join(tmp, "state.json"), ServeOptions{Concurrency: -1})
+	if err == nil {
+		t.Fatal("expected a negative concurrency to be rejected")
+	}
+}
+
+func TestRunner_Serve_RunsTasksInParallel(t *testing.T) {
+	_, remote := gitRepo(t)
+	slow := fakeclaude.DefaultScript("sess-p")
+	slow.Steps = append([]fakeclaude.Step{{SleepMS: 1500}}, slow.Steps...)
+	rec := fakeclaude.Setup(t, slow)
+	tmp := t.TempDir()
+	cmdDir := filepath.Join(tmp, "cmd")
+	if err := os.MkdirAll(cmdDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("CUSTOM_REPO_PATH", "")
+	t.Setenv("GITHUB_REPO", "")
+	t.Setenv("CLAUDE_RETRIES", "0")
+	t.Setenv("TRANSCRIPT_DIR", filepath.Join(tmp, "transcripts"))
+	statePath := filepath.Join(tmp, "state.json")
+	ids := []string{"pr-1", "pr-2"}
+	for _, id := range ids {
+		if _, err := WriteTaskFile(cmdDir, TaskFile{ID: id, Prompt: "review " + id, Repo: "org/app"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRunner()
+	r.Worktrees = NewWorktrees(filepath.Join(tmp, "claude"))
+	r.Worktrees.CloneURL = func(string) string { return remote }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Serve(ctx, cmdDir, statePath, ServeOptions{PollInterval: 10 * time.Millisecond, Concurrency: 2})
+	}()
+
+	sawBoth := false
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		m, err := taskstate.Load(statePath)
+		if err != nil {
+			t.Fatalf("state.json must never be read mid-write: %v", err)
+		}
+		if len(m.GetState().Running) == 2 {
+			sawBoth = true
+		}
+		_, err1 := os.Stat(ResultPath(cmdDir, ids[0]))
+		_, err2 := os.Stat(ResultPath(cmdDir, ids[1]))
+		if err1 == nil && err2 == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the result files")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if !sawBoth {
+		t.Fatal("expected both tasks to be running at the same time")
+	}
+	inv := fakeclaude.Invocations(t, rec)
+	if len(inv) != 2 || inv[0].Dir == inv[1].Dir {
+		t.Fatalf("expected two runs in separate worktrees: %+v", inv)
+	}
+	for _, id := range ids {
+		b, err := os.ReadFile(filepath.Join(tmp, "claude", "sessions", id+".json"))
+		if err != nil || !strings.Contains(string(b), "sess-p") {
+			t.Fatalf("session file of %s: %v %s", id, err, b)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "session.json")); !os.IsNotExist(err) {
+		t.Fatal("parallel tasks should not write the shared session.json")
+	}
+}
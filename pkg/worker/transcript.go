@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/your-org/claude-dev-setup/pkg/claude"
+)
+
+// TranscriptWriter records every raw stream-json line of a task to
+// <dir>/<taskID>-<sessionID>.jsonl. Lines that arrive before the session ID
+// is known are buffered; if no session ID ever appears the file is named
+// <taskID>.jsonl instead.
+type TranscriptWriter struct {
+	dir     string
+	taskID  string
+	path    string
+	f       *os.File
+	w       *bufio.Writer
+	pending [][]byte
+}
+
+func NewTranscriptWriter(dir, taskID string) *TranscriptWriter {
+	if strings.TrimSpace(taskID) == "" {
+		taskID = "task"
+	}
+	return &TranscriptWriter{dir: dir, taskID: taskID}
+}
+
+// TranscriptDir returns TRANSCRIPT_DIR or ~/transcripts.
+func TranscriptDir(homeDir string) string {
+	if d := strings.TrimSpace(os.Getenv("TRANSCRIPT_DIR")); d != "" {
+		return d
+	}
+	return filepath.Join(homeDir, "transcripts")
+}
+
+// Write appends one raw line. sessionID may be empty until the init event has been seen.
+func (t *TranscriptWriter) Write(sessionID string, raw []byte) error {
+	line := append(append([]byte(nil), raw...), '\n')
+	if t.f == nil {
+		if sessionID == "" {
+			t.pending = append(t.pending, line)
+			return nil
+		}
+		if err := t.open(sessionID); err != nil {
+			return err
+		}
+	}
+	_, err := t.w.Write(line)
+	return err
+}
+
+func (t *TranscriptWriter) open(sessionID string) error {
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return err
+	}
+	name := safeFileComponent(t.taskID)
+	if sessionID != "" {
+		name += "-" + safeFileComponent(sessionID)
+	}
+	t.path = filepath.Join(t.dir, name+".jsonl")
+	// Append so follow-up runs in the same session (repairs, retries) extend
+	// the transcript instead of replacing it.
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	t.f = f
+	t.w = bufio.NewWriter(f)
+	for _, l := range t.pending {
+		if _, err := t.w.Write(l); err != nil {
+			return err
+		}
+	}
+	t.pending = nil
+	return nil
+}
+
+// Close flushes the transcript and returns its path. Nothing is written when
+// no lines were recorded.
+func (t *TranscriptWriter) Close() (string, error) {
+	if t.f == nil {
+		if len(t.pending) == 0 {
+			return "", nil
+		}
+		if err := t.open(""); err != nil {
+			return "", err
+		}
+	}
+	err := t.w.Flush()
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	return t.path, err
+}
+
+func safeFileComponent(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Replay feeds a saved transcript through the same renderers used while
+// streaming. format uses the CSCC_STREAM_FORMAT syntax and defaults to concise.
+func Replay(path, format string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if format == "" {
+		format = claude.FormatConcise
+	}
+	renderer, err := claude.ParseRenderers(format, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer renderer.Close()
+	dec := claude.NewDecoder(f)
+	for {
+		ev, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var lineErr *claude.LineError
+		if err != nil && !errors.As(err, &lineErr) {
+			return err
+		}
+		if err := renderer.Render(ev); err != nil {
+			return err
+		}
+	}
+}
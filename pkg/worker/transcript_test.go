@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscriptWriter_NamesFileBySession(t *testing.T) {
+	dir := t.TempDir()
+	tw := NewTranscriptWriter(dir, "pr-7")
+	if err := tw.Write("", []byte(`not json`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Write("sess-1", []byte(`{"type":"system","session_id":"sess-1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Write("sess-1", []byte(`{"type":"result"}`)); err != nil {
+		t.Fatal(err)
+	}
+	path, err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "pr-7-sess-1.jsonl"); path != want {
+		t.Fatalf("path = %q, want %q", path, want)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "not json\n{\"type\":\"system\",\"session_id\":\"sess-1\"}\n{\"type\":\"result\"}\n"
+	if string(b) != want {
+		t.Fatalf("unexpected transcript:\n%s", b)
+	}
+	if err := Replay(path, "concise"); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+}
+
+func TestTranscriptWriter_NoSession(t *testing.T) {
+	dir := t.TempDir()
+	tw := NewTranscriptWriter(dir, "t1")
+	if err := tw.Write("", []byte(`{"type":"result"}`)); err != nil {
+		t.Fatal(err)
+	}
+	path, err := tw.Close()
+	if err != nil || path != filepath.Join(dir, "t1.jsonl") {
+		t.Fatalf("unexpected close result: %q %v", path, err)
+	}
+}
@@ -0,0 +1,212 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Worktrees gives every task a fresh checkout instead of the shared
+// target-repo: one bare mirror per repo under <Root>/mirrors, fetched before
+// each task, and a detached git worktree per task under <Root>/worktrees,
+// removed when the task ends. Edits left by one task never reach the next,
+// and tasks on the same repo can run side by side.
+type Worktrees struct {
+	// Root holds mirrors/ and worktrees/, normally ~/claude.
+	Root string
+	// CloneURL maps owner/name to the URL a mirror is cloned from; nil
+	// clones with gh, which uses the worker's GitHub credentials.
+	CloneURL func(repo string) string
+
+	mirrors keyedMutex // serializes git commands per mirror
+	mu      sync.Mutex
+	active  map[string]bool // worktree dirs in use
+}
+
+func NewWorktrees(root string) *Worktrees { return &Worktrees{Root: root} }
+
+// Ref selects the commit a worktree checks out: SHA when set, else the tip
+// of Branch, else the head of PR PRNumber, else the default branch.
+type Ref struct {
+	SHA      string
+	Branch   string
+	PRNumber int
+}
+
+// Worktree is the checkout of one task.
+type Worktree struct {
+	Dir     string
+	Mirror  string
+	HeadSHA string
+}
+
+func (w *Worktrees) mirrorDir(repo string) string {
+	return filepath.Join(w.Root, "mirrors", filepath.FromSlash(safeRepoPath(repo))+".git")
+}
+
+// worktreeDir is keyed by task ID, so a follow-up task with the same ID runs
+// in the same directory and can resume the earlier Claude session.
+func (w *Worktrees) worktreeDir(taskID string) string {
+	return filepath.Join(w.Root, "worktrees", safeRepoPath(safeFileComponent(taskID)))
+}
+
+// keyedMutex is a set of mutexes created on first use.
+type keyedMutex struct {
+	mu sync.Mutex
+	m  map[string]*sync.Mutex
+}
+
+// lock locks key and returns its unlock function.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.m == nil {
+		k.m = map[string]*sync.Mutex{}
+	}
+	m := k.m[key]
+	if m == nil {
+		m = &sync.Mutex{}
+		k.m[key] = m
+	}
+	k.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// Add fetches (or clones) the mirror of repo and checks out ref, detached,
+// in a new worktree for taskID. A directory left behind by a crashed run of
+// the same task is replaced.
+func (w *Worktrees) Add(ctx context.Context, taskID, repo string, ref Ref) (*Worktree, error) {
+	if repo == "" {
+		return nil, errors.New("github repo is required for a worktree")
+	}
+	wt := &Worktree{Dir: w.worktreeDir(taskID), Mirror: w.mirrorDir(repo)}
+	w.mu.Lock()
+	if w.active[wt.Dir] {
+		w.mu.Unlock()
+		return nil, fmt.Errorf("worktree for task %s is in use", taskID)
+	}
+	if w.active == nil {
+		w.active = map[string]bool{}
+	}
+	w.active[wt.Dir] = true
+	w.mu.Unlock()
+
+	unlock := w.mirrors.lock(wt.Mirror)
+	defer unlock()
+	sha, err := w.checkout(ctx, repo, wt, ref)
+	if err != nil {
+		w.release(wt.Dir)
+		return nil, err
+	}
+	wt.HeadSHA = sha
+	return wt, nil
+}
+
+func (w *Worktrees) checkout(ctx context.Context, repo string, wt *Worktree, ref Ref) (string, error) {
+	if err := w.syncMirror(ctx, repo, wt.Mirror); err != nil {
+		return "", err
+	}
+	sha, err := resolveRef(ctx, wt.Mirror, ref)
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(wt.Dir); err != nil {
+		return "", err
+	}
+	if err := runInDir(ctx, wt.Mirror, "git", "worktree", "prune"); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(wt.Dir), 0o755); err != nil {
+		return "", err
+	}
+	if err := runInDir(ctx, wt.Mirror, "git", "worktree", "add", "--detach", "--quiet", wt.Dir, sha); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// syncMirror fetches the mirror, cloning it first when missing. Clones go
+// to a temporary directory so an interrupted clone is never mistaken for a
+// mirror.
+func (w *Worktrees) syncMirror(ctx context.Context, repo, mirror string) error {
+	if _, err := os.Stat(filepath.Join(mirror, "HEAD")); err == nil {
+		return runInDir(ctx, mirror, "git", "fetch", "--prune", "--quiet", "origin")
+	}
+	parent := filepath.Dir(mirror)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return err
+	}
+	tmp := mirror + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	var err error
+	if w.CloneURL != nil {
+		err = runInDir(ctx, parent, "git", "clone", "--mirror", "--quiet", w.CloneURL(repo), tmp)
+	} else {
+		err = runInDir(ctx, parent, "gh", "repo", "clone", repo, tmp, "--", "--mirror", "--quiet")
+	}
+	if err == nil {
+		// A mirror remote refuses pushes with a refspec, which fix mode needs
+		err = runInDir(ctx, tmp, "git", "config", "--unset", "remote.origin.mirror")
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.RemoveAll(mirror); err != nil {
+		return err
+	}
+	return os.Rename(tmp, mirror)
+}
+
+func resolveRef(ctx context.Context, mirror string, ref Ref) (string, error) {
+	name := "HEAD"
+	switch {
+	case ref.SHA != "":
+		name = ref.SHA
+	case ref.Branch != "":
+		name = "refs/heads/" + ref.Branch
+	case ref.PRNumber > 0:
+		name = "refs/pull/" + strconv.Itoa(ref.PRNumber) + "/head"
+	}
+	out, err := outputInDir(ctx, mirror, "git", "rev-parse", "--verify", "--quiet", name+"^{commit}")
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%s not found in %s", strings.TrimPrefix(name, "refs/heads/"), filepath.Base(mirror))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Remove deletes the worktree and its metadata in the mirror. It runs even
+// when ctx is cancelled, so an interrupted task is cleaned up too.
+func (w *Worktrees) Remove(ctx context.Context, wt *Worktree) error {
+	ctx = context.WithoutCancel(ctx)
+	defer w.release(wt.Dir)
+	unlock := w.mirrors.lock(wt.Mirror)
+	defer unlock()
+	if err := runInDir(ctx, wt.Mirror, "git", "worktree", "remove", "--force", wt.Dir); err == nil {
+		return nil
+	}
+	// Fall back to deleting the directory, e.g. when the mirror was removed
+	if err := os.RemoveAll(wt.Dir); err != nil {
+		return err
+	}
+	if _, err := os.Stat(wt.Mirror); err != nil {
+		return nil
+	}
+	return runInDir(ctx, wt.Mirror, "git", "worktree", "prune")
+}
+
+func (w *Worktrees) release(dir string) {
+	w.mu.Lock()
+	delete(w.active, dir)
+	w.mu.Unlock()
+}
@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/claude-dev-setup/pkg/fakeclaude"
+	"github.com/your-org/claude-dev-setup/pkg/taskstate"
+)
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestWorktrees_FreshCheckoutPerTask(t *testing.T) {
+	clone, remote := gitRepo(t)
+	first := gitOutput(t, clone, "rev-parse", "HEAD")
+	w := NewWorktrees(t.TempDir())
+	w.CloneURL = func(string) string { return remote }
+	ctx := context.Background()
+
+	wt, err := w.Add(ctx, "t1", "org/app", Ref{Branch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.HeadSHA != first || gitOutput(t, wt.Dir, "rev-parse", "HEAD") != first {
+		t.Fatalf("expected %s checked out, got %+v", first, wt)
+	}
+	if _, err := w.Add(ctx, "t1", "org/app", Ref{}); err == nil {
+		t.Fatal("expected a second worktree for a running task to be refused")
+	}
+	if err := os.WriteFile(filepath.Join(wt.Dir, "leftover.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove(ctx, wt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wt.Dir); !os.IsNotExist(err) {
+		t.Fatalf("worktree not removed: %v", err)
+	}
+
+	// A new commit upstream is fetched; leftovers of t1 are gone
+	if err := os.WriteFile(filepath.Join(clone, "b.txt"), []byte("b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitOutput(t, clone, "add", ".")
+	gitOutput(t, clone, "commit", "-q", "-m", "second")
+	gitOutput(t, clone, "push", "-q", "origin", "HEAD:main")
+	second := gitOutput(t, clone, "rev-parse", "HEAD")
+	wt, err = w.Add(ctx, "t1", "org/app", Ref{Branch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.HeadSHA != second {
+		t.Fatalf("expected the fetched tip %s, got %s", second, wt.HeadSHA)
+	}
+	if _, err := os.Stat(filepath.Join(wt.Dir, "leftover.txt")); !os.IsNotExist(err) {
+		t.Fatal("edits of an earlier task leaked into the new worktree")
+	}
+	w.Remove(ctx, wt)
+
+	// An explicit SHA wins over the branch
+	wt, err = w.Add(ctx, "t2", "org/app", Ref{SHA: first, Branch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gitOutput(t, wt.Dir, "rev-parse", "HEAD") != first {
+		t.Fatal("expected the pinned commit to be checked out")
+	}
+	w.Remove(ctx, wt)
+
+	if _, err := w.Add(ctx, "t3", "org/app", Ref{Branch: "nope"}); err == nil || !strings.Contains(err.Error(), "nope not found") {
+		t.Fatalf("expected a missing branch to fail, got %v", err)
+	}
+}
+
+func TestRunner_FixModeInWorktree(t *testing.T) {
+	_, remote := gitRepo(t)
+	base := gitOutput(t, remote, "rev-parse", "main")
+	edit := fakeclaude.DefaultScript("sess-w")
+	edit.Steps = append([]fakeclaude.Step{{WriteFile: &fakeclaude.FileWrite{Path: "a.txt", Content: "fixed\n"}}}, edit.Steps...)
+	rec := fakeclaude.Setup(t, edit)
+	// The mirror's worktrees have no git identity of their own
+	t.Setenv("FIX_AUTHOR", "Fix Bot <fix@example.com>")
+
+	_, client := newFakeRepoAPI(t, map[string]string{
+		"GET /repos/org/app":        fakeRepoJSON,
+		"GET /repos/org/app/pulls":  `[]`,
+		"POST /repos/org/app/pulls": `{"number":3,"html_url":"https://github.com/org/app/pull/3"}`,
+	})
+	r := NewRunner()
+	r.GitHub = client
+	r.Worktrees = NewWorktrees(t.TempDir())
+	r.Worktrees.CloneURL = func(string) string { return remote }
+	h := drainTasks(t, r, "", TaskFile{ID: "fix-w", Prompt: "fix it", Mode: "fix", Repo: "org/app"})
+	if len(h) != 1 || h[0].Status != taskstate.StatusDone || h[0].DataString(DataHeadSHA) != base {
+		t.Fatalf("unexpected task: %+v", h)
+	}
+	inv := fakeclaude.Invocations(t, rec)
+	if len(inv) != 1 || !strings.HasPrefix(inv[0].Dir, filepath.Join(r.Worktrees.Root, "worktrees")) {
+		t.Fatalf("claude did not run in a worktree: %+v", inv)
+	}
+	if _, err := os.Stat(inv[0].Dir); !os.IsNotExist(err) {
+		t.Fatalf("worktree left behind: %v", err)
+	}
+	if parent := gitOutput(t, remote, "rev-parse", "claude/fix-w^"); parent != base {
+		t.Fatalf("fix commit should sit on %s, got parent %s", base, parent)
+	}
+}